@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"runtime"
 
 	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/game"
 	"github.com/adsozuan/wipeout-rw-go/system"
 
 	"github.com/veandco/go-sdl2/sdl"
@@ -19,6 +21,11 @@ func main() {
 }
 
 func run() error {
+	record := flag.String("record", "", "record every frame into a PNG sequence directory, or a .y4m video")
+	recordFps := flag.Int("record-fps", system.RecordFps, "simulated frame rate of the recording")
+	replay := flag.String("replay", "", "play back a race replay file")
+	flag.Parse()
+
 	runtime.LockOSThread()
 
 	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_AUDIO | sdl.INIT_JOYSTICK | sdl.INIT_GAMECONTROLLER); err != nil {
@@ -40,27 +47,38 @@ func run() error {
 		return err
 	}
 
-	system, err := system.New(platform)
+	system, err := system.New(platform, engine.NewRender())
 	if err != nil {
 		return err
 	}
-
-
-	for !platform.ExitWanted() {
-		err := platform.PumpEvents()
+	if *replay != "" {
+		rp, err := game.ReplayLoad(*replay)
+		if err != nil {
+			return err
+		}
+		system.Game.PlayReplay(rp)
+	}
+	if *record != "" {
+		w, err := engine.CreateFrameWriter(*record, *recordFps)
 		if err != nil {
 			return err
 		}
-		err = platform.PrepareFrame()
+		err = system.StartRecording(w, *recordFps)
 		if err != nil {
 			return err
 		}
-		system.Update()
-		err = platform.EndFrame()
+	}
+
+	for !platform.ExitWanted() {
+		err := system.Frame()
 		if err != nil {
 			return err
 		}
 	}
+	err = system.StopRecording()
+	if err != nil {
+		return err
+	}
 	system.Cleanup()
 
 	platform.VideoCleanup()
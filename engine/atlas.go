@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// atlasPixels is the width and height of an atlas page in pixels
+const atlasPixels = AtlasSize * AtlasGrid
+
+// atlasPage marks the used grid cells of an atlas page, one row of cells
+// per word
+type atlasPage [AtlasSize]uint64
+
+// atlasBlock returns the grid cells covered by a bw×bh block
+func atlasBlock(bw, bh int) (int, int) {
+	return (bw + AtlasGrid - 1) / AtlasGrid, (bh + AtlasGrid - 1) / AtlasGrid
+}
+
+// atlasRowMask returns the bits of gridWidth cells from gridX on
+func atlasRowMask(gridX, gridWidth int) uint64 {
+	return (uint64(1)<<gridWidth - 1) << gridX
+}
+
+// place finds the first free spot for a bw×bh block, scanning rows top to
+// bottom, and marks it as used. It returns the pixel position of the block.
+func (a *atlasPage) place(bw, bh int) (int, int, bool) {
+	gridWidth, gridHeight := atlasBlock(bw, bh)
+	for gridY := 0; gridY+gridHeight <= AtlasSize; gridY++ {
+		for gridX := 0; gridX+gridWidth <= AtlasSize; gridX++ {
+			mask := atlasRowMask(gridX, gridWidth)
+			free := true
+			for y := gridY; y < gridY+gridHeight; y++ {
+				if a[y]&mask != 0 {
+					free = false
+					break
+				}
+			}
+			if free {
+				a.mark(gridX, gridY, gridWidth, gridHeight, true)
+				return gridX * AtlasGrid, gridY * AtlasGrid, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func (a *atlasPage) mark(gridX, gridY, gridWidth, gridHeight int, used bool) {
+	mask := atlasRowMask(gridX, gridWidth)
+	for y := gridY; y < gridY+gridHeight; y++ {
+		if used {
+			a[y] |= mask
+		} else {
+			a[y] &^= mask
+		}
+	}
+}
+
+// atlasAlloc places a bw×bh block on the first atlas page with room for it,
+// adding a page when none has. It returns the page and the pixel position
+// of the block on it.
+func atlasAlloc(pages *[]atlasPage, bw, bh int) (int, int, int, error) {
+	if bw > atlasPixels || bh > atlasPixels {
+		return 0, 0, 0, fmt.Errorf("texture of %dx%d does not fit an atlas page", bw, bh)
+	}
+
+	for page := range *pages {
+		x, y, ok := (*pages)[page].place(bw, bh)
+		if ok {
+			return page, x, y, nil
+		}
+	}
+
+	if len(*pages) >= AtlasPagesMax {
+		return 0, 0, 0, fmt.Errorf("render atlas full, all %d pages used", AtlasPagesMax)
+	}
+	*pages = append(*pages, atlasPage{})
+	page := len(*pages) - 1
+	x, y, _ := (*pages)[page].place(bw, bh)
+
+	return page, x, y, nil
+}
+
+// atlasFree returns the cells of t to its page
+func atlasFree(pages []atlasPage, t *RenderTexture) {
+	gridWidth, gridHeight := atlasBlock(int(t.size.X)+AtlasBorder*2, int(t.size.Y)+AtlasBorder*2)
+	gridX := (int(t.offset.X) - AtlasBorder) / AtlasGrid
+	gridY := (int(t.offset.Y) - AtlasBorder) / AtlasGrid
+	pages[t.page].mark(gridX, gridY, gridWidth, gridHeight, false)
+}
+
+// atlasDefrag packs the live textures anew, tallest first, and moves their
+// pixels from the old pages to the returned ones. The textures keep their
+// handles, only their page and offset change.
+func atlasDefrag(textures []RenderTexture, pixels [][]RGBA) ([]atlasPage, [][]RGBA, error) {
+	var live []int
+	for i := range textures {
+		if textures[i].refs > 0 {
+			live = append(live, i)
+		}
+	}
+	sort.SliceStable(live, func(i, j int) bool {
+		a, b := &textures[live[i]], &textures[live[j]]
+		if a.size.Y != b.size.Y {
+			return a.size.Y > b.size.Y
+		}
+		return a.size.X > b.size.X
+	})
+
+	var pages []atlasPage
+	var newPixels [][]RGBA
+	moved := make([]RenderTexture, len(textures))
+	copy(moved, textures)
+	for _, i := range live {
+		t := &moved[i]
+		bw, bh := int(t.size.X)+AtlasBorder*2, int(t.size.Y)+AtlasBorder*2
+		page, x, y, err := atlasAlloc(&pages, bw, bh)
+		if err != nil {
+			return nil, nil, err
+		}
+		for len(newPixels) <= page {
+			newPixels = append(newPixels, make([]RGBA, atlasPixels*atlasPixels))
+		}
+
+		src := pixels[t.page]
+		sx, sy := int(t.offset.X)-AtlasBorder, int(t.offset.Y)-AtlasBorder
+		for row := 0; row < bh; row++ {
+			copy(newPixels[page][(y+row)*atlasPixels+x:(y+row)*atlasPixels+x+bw], src[(sy+row)*atlasPixels+sx:(sy+row)*atlasPixels+sx+bw])
+		}
+		t.page = page
+		t.offset = Vec2i{int32(x + AtlasBorder), int32(y + AtlasBorder)}
+	}
+	copy(textures, moved)
+
+	return pages, newPixels, nil
+}
+
+// atlasBorder returns the pixels of a tw×th texture surrounded by
+// AtlasBorder pixels repeating its edges, so filtering never bleeds into
+// the neighbours in the atlas
+func atlasBorder(tw, th int, pixels []RGBA) []RGBA {
+	bw := tw + AtlasBorder*2
+	bh := th + AtlasBorder*2
+	pb := make([]RGBA, bw*bh)
+	if tw <= 0 || th <= 0 {
+		return pb
+	}
+
+	// Top and bottom border
+	for y := 0; y < AtlasBorder; y++ {
+		copy(pb[y*bw+AtlasBorder:y*bw+AtlasBorder+tw], pixels[:tw])
+		by := bh - AtlasBorder + y
+		copy(pb[by*bw+AtlasBorder:by*bw+AtlasBorder+tw], pixels[(th-1)*tw:th*tw])
+	}
+
+	// Left and right border
+	for y := 0; y < bh; y++ {
+		row := Clamp(y-AtlasBorder, 0, th-1) * tw
+		for x := 0; x < AtlasBorder; x++ {
+			pb[y*bw+x] = pixels[row]
+			pb[y*bw+bw-AtlasBorder+x] = pixels[row+tw-1]
+		}
+	}
+
+	// Texture
+	for y := 0; y < th; y++ {
+		copy(pb[(y+AtlasBorder)*bw+AtlasBorder:(y+AtlasBorder)*bw+AtlasBorder+tw], pixels[y*tw:(y+1)*tw])
+	}
+
+	return pb
+}
@@ -0,0 +1,111 @@
+package engine
+
+import "testing"
+
+func TestAtlasAlloc(t *testing.T) {
+	var pages []atlasPage
+
+	// Each quarter of a page fills one corner
+	for i := 0; i < 5; i++ {
+		p, x, y, err := atlasAlloc(&pages, atlasPixels/2, atlasPixels/2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i / 4; p != want {
+			t.Errorf("block %d on page %d at %d,%d, want page %d", i, p, x, y, want)
+		}
+	}
+	if len(pages) != 2 {
+		t.Errorf("%d pages", len(pages))
+	}
+
+	// With a quarter freed on the first page small blocks go there again
+	atlasFree(pages, &RenderTexture{
+		page:   0,
+		offset: Vec2i{atlasPixels/2 + AtlasBorder, AtlasBorder},
+		size:   Vec2i{atlasPixels/2 - AtlasBorder*2, atlasPixels/2 - AtlasBorder*2},
+	})
+	if p, x, y, err := atlasAlloc(&pages, 8, 8); p != 0 || x != atlasPixels/2 || y != 0 || err != nil {
+		t.Errorf("small block on page %d at %d,%d, %v", p, x, y, err)
+	}
+
+	if _, _, _, err := atlasAlloc(&pages, atlasPixels+1, 8); err == nil {
+		t.Errorf("block wider than a page placed")
+	}
+
+	for len(pages) < AtlasPagesMax {
+		if _, _, _, err := atlasAlloc(&pages, atlasPixels, atlasPixels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, _, err := atlasAlloc(&pages, atlasPixels, atlasPixels); err == nil {
+		t.Errorf("block placed with all pages full")
+	}
+}
+
+// atlasTexture allocates a texture of tw×th and fills its bordered block
+// with color
+func atlasTexture(t *testing.T, pages *[]atlasPage, pixels *[][]RGBA, tw, th int, color RGBA) RenderTexture {
+	bw, bh := tw+AtlasBorder*2, th+AtlasBorder*2
+	p, x, y, err := atlasAlloc(pages, bw, bh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(*pixels) <= p {
+		*pixels = append(*pixels, make([]RGBA, atlasPixels*atlasPixels))
+	}
+	for row := y; row < y+bh; row++ {
+		for col := x; col < x+bw; col++ {
+			(*pixels)[p][row*atlasPixels+col] = color
+		}
+	}
+	return RenderTexture{
+		page:   p,
+		offset: Vec2i{int32(x + AtlasBorder), int32(y + AtlasBorder)},
+		size:   Vec2i{int32(tw), int32(th)},
+		refs:   1,
+	}
+}
+
+func TestAtlasDefrag(t *testing.T) {
+	var pages []atlasPage
+	var pixels [][]RGBA
+	const size = atlasPixels/2 - AtlasBorder*2
+
+	// Five quarters take two pages, freeing three of them leaves two
+	// textures that fit on one
+	colors := []RGBA{{1, 0, 0, 255}, {2, 0, 0, 255}, {3, 0, 0, 255}, {4, 0, 0, 255}, {5, 0, 0, 255}}
+	var textures []RenderTexture
+	for _, c := range colors {
+		textures = append(textures, atlasTexture(t, &pages, &pixels, size, size, c))
+	}
+	for _, i := range []int{0, 2, 3} {
+		atlasFree(pages, &textures[i])
+		textures[i].refs = 0
+	}
+
+	newPages, newPixels, err := atlasDefrag(textures, pixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newPages) != 1 || len(newPixels) != 1 {
+		t.Fatalf("%d pages after defrag", len(newPages))
+	}
+	for _, i := range []int{1, 4} {
+		tex := &textures[i]
+		got := newPixels[tex.page][int(tex.offset.Y)*atlasPixels+int(tex.offset.X)]
+		if tex.page != 0 || got != colors[i] {
+			t.Errorf("texture %d on page %d reads %v, want %v", i, tex.page, got, colors[i])
+		}
+	}
+	if textures[1].offset == textures[4].offset {
+		t.Errorf("textures share the spot %v", textures[1].offset)
+	}
+
+	// The packed page has room for the freed quarters again
+	for i := 0; i < 2; i++ {
+		if p, _, _, err := atlasAlloc(&newPages, size, size); p != 0 || err != nil {
+			t.Errorf("quarter on page %d, %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"sync"
+)
+
+const (
+	// AudioSampleRate is the output rate of the mixer in frames per second
+	AudioSampleRate = 44100
+	// AudioChannels is the number of interleaved output channels
+	AudioChannels = 2
+	// AudioMaxVoices is the number of sounds that can play at once
+	AudioMaxVoices = 32
+)
+
+// Sound is a mono sample buffer played by the mixer's voices. A looping
+// voice repeats the samples from LoopStart to LoopEnd, or all samples when
+// LoopEnd is 0.
+type Sound struct {
+	Samples   []float32
+	Rate      int
+	LoopStart int
+	LoopEnd   int
+}
+
+// loopRange returns the part of the samples a looping voice repeats
+func (s *Sound) loopRange() (start, end int) {
+	if s.LoopEnd > s.LoopStart && s.LoopEnd <= len(s.Samples) && s.LoopStart >= 0 {
+		return s.LoopStart, s.LoopEnd
+	}
+	return 0, len(s.Samples)
+}
+
+// MusicSource streams interleaved stereo samples at AudioSampleRate. Read
+// fills out and returns the number of frames written, fewer than requested
+// are padded with silence.
+type MusicSource interface {
+	Read(out []float32) int
+}
+
+// Voice identifies a playing sound. Handles of finished or stopped voices
+// are ignored, even when their slot was reused.
+type Voice uint32
+
+// VoiceNone is never returned for a playing sound
+const VoiceNone Voice = 0
+
+type voice struct {
+	sound      *Sound
+	pos        float64
+	volume     float32
+	pan        float32
+	pitch      float32
+	loop       bool
+	generation uint32
+}
+
+// Mixer sums the sound effect voices and the music channel into an
+// interleaved stereo buffer. Mix is called from the audio output, all other
+// methods from the game; they are safe to use concurrently.
+type Mixer struct {
+	mu          sync.Mutex
+	voices      [AudioMaxVoices]voice
+	generation  uint32
+	music       MusicSource
+	musicBuffer []float32
+	sfxVolume   float32
+	musicVolume float32
+	listener    Listener
+}
+
+func NewMixer() *Mixer {
+	return &Mixer{
+		sfxVolume:   1,
+		musicVolume: 1,
+	}
+}
+
+// Play starts sound on a free voice. Volume goes from 0 to 1, pan from -1
+// (left) to 1 (right) and pitch scales the playback rate. It returns
+// VoiceNone when all voices are busy.
+func (m *Mixer) Play(sound *Sound, volume, pan, pitch float32, loop bool) Voice {
+	if sound == nil || len(sound.Samples) == 0 || sound.Rate <= 0 {
+		return VoiceNone
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.voices {
+		v := &m.voices[i]
+		if v.sound != nil {
+			continue
+		}
+		m.generation++
+		if m.generation >= 1<<(32-voiceIndexBits) {
+			m.generation = 1
+		}
+		*v = voice{
+			sound:      sound,
+			volume:     volume,
+			pan:        Clamp(pan, -1, 1),
+			pitch:      max(pitch, 0),
+			loop:       loop,
+			generation: m.generation,
+		}
+		return Voice(m.generation<<voiceIndexBits | uint32(i))
+	}
+
+	return VoiceNone
+}
+
+// Playing reports whether v still plays
+func (m *Mixer) Playing(v Voice) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.voice(v) != nil
+}
+
+// Stop ends v
+func (m *Mixer) Stop(v Voice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if vc := m.voice(v); vc != nil {
+		vc.sound = nil
+	}
+}
+
+// StopAll ends all sound effect voices, the music keeps playing
+func (m *Mixer) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.voices {
+		m.voices[i].sound = nil
+	}
+}
+
+// SetVolume changes the volume of v
+func (m *Mixer) SetVolume(v Voice, volume float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if vc := m.voice(v); vc != nil {
+		vc.volume = volume
+	}
+}
+
+// SetPan changes the stereo position of v
+func (m *Mixer) SetPan(v Voice, pan float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if vc := m.voice(v); vc != nil {
+		vc.pan = Clamp(pan, -1, 1)
+	}
+}
+
+// SetPitch changes the playback rate of v
+func (m *Mixer) SetPitch(v Voice, pitch float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if vc := m.voice(v); vc != nil {
+		vc.pitch = max(pitch, 0)
+	}
+}
+
+// SetMusic replaces the source of the music channel, nil stops the music
+func (m *Mixer) SetMusic(src MusicSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.music = src
+}
+
+// SetSfxVolume sets the global volume of all sound effect voices
+func (m *Mixer) SetSfxVolume(volume float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sfxVolume = Clamp(volume, 0, 1)
+}
+
+// SetMusicVolume sets the global volume of the music channel
+func (m *Mixer) SetMusicVolume(volume float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.musicVolume = Clamp(volume, 0, 1)
+}
+
+// Mix renders the next len(out)/AudioChannels frames into out
+func (m *Mixer) Mix(out []float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range out {
+		out[i] = 0
+	}
+	frames := len(out) / AudioChannels
+
+	if m.music != nil {
+		if cap(m.musicBuffer) < len(out) {
+			m.musicBuffer = make([]float32, len(out))
+		}
+		buffer := m.musicBuffer[:frames*AudioChannels]
+		read := m.music.Read(buffer)
+		if read > frames {
+			read = frames
+		}
+		for i := 0; i < read*AudioChannels; i++ {
+			out[i] = buffer[i] * m.musicVolume
+		}
+	}
+
+	for i := range m.voices {
+		v := &m.voices[i]
+		if v.sound != nil {
+			m.mixVoice(v, out[:frames*AudioChannels])
+		}
+	}
+
+	for i := range out {
+		out[i] = Clamp(out[i], -1, 1)
+	}
+}
+
+func (m *Mixer) mixVoice(v *voice, out []float32) {
+	samples := v.sound.Samples
+	step := float64(v.pitch) * float64(v.sound.Rate) / AudioSampleRate
+	volume := v.volume * m.sfxVolume
+	left := volume * min(1, 1-v.pan)
+	right := volume * min(1, 1+v.pan)
+
+	end := len(samples)
+	loopStart, loopEnd := v.sound.loopRange()
+	if v.loop {
+		end = loopEnd
+	}
+
+	for i := 0; i < len(out); i += AudioChannels {
+		for v.pos >= float64(end) {
+			if !v.loop {
+				v.sound = nil
+				return
+			}
+			v.pos -= float64(loopEnd - loopStart)
+		}
+
+		index := int(v.pos)
+		frac := float32(v.pos - float64(index))
+		next := index + 1
+		if next >= end {
+			next = index
+			if v.loop {
+				next = loopStart
+			}
+		}
+		s := samples[index] + (samples[next]-samples[index])*frac
+
+		out[i] += s * left
+		out[i+1] += s * right
+		v.pos += step
+	}
+}
+
+const voiceIndexBits = 8
+
+// voice returns the slot of a handle or nil if it no longer plays
+func (m *Mixer) voice(v Voice) *voice {
+	index := int(v & (1<<voiceIndexBits - 1))
+	if v == VoiceNone || index >= AudioMaxVoices {
+		return nil
+	}
+	vc := &m.voices[index]
+	if vc.sound == nil || vc.generation != uint32(v)>>voiceIndexBits {
+		return nil
+	}
+	return vc
+}
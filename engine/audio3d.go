@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"math"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	// AudioSpeedOfSound in world units per second, a unit is about 1cm
+	AudioSpeedOfSound = 34300
+	// AudioMinDistance is the distance up to which emitters play at full
+	// volume
+	AudioMinDistance = 512
+	// AudioMaxDistance is the distance at which emitters become silent
+	AudioMaxDistance = 32768
+	// AudioPitchMin and AudioPitchMax limit the Doppler shift
+	AudioPitchMin = 0.5
+	AudioPitchMax = 2.0
+)
+
+// Listener is the point sounds are heard from, usually the camera. Right
+// points to the listener's right in world space.
+type Listener struct {
+	Position Vec3
+	Velocity Vec3
+	Right    Vec3
+}
+
+// Emitter is a sound source in the world
+type Emitter struct {
+	Position Vec3
+	Velocity Vec3
+	Volume   float32
+}
+
+// Spatial is how an emitter is heard by a listener
+type Spatial struct {
+	Volume float32
+	Pan    float32
+	Pitch  float32
+}
+
+// Spatialize computes the attenuation, stereo pan and Doppler pitch of e
+// as heard by l
+func Spatialize(l Listener, e Emitter) Spatial {
+	offset := Vec3Sub(e.Position, l.Position)
+	distance := float64(Vec3Len(offset))
+
+	s := Spatial{
+		Volume: e.Volume * float32(Clamp(Scale(distance, AudioMinDistance, AudioMaxDistance, 1, 0), 0, 1)),
+		Pitch:  1,
+	}
+	if distance < 1 {
+		return s
+	}
+
+	dir := Vec3DivF(offset, gl.Float(distance))
+	s.Pan = Clamp(float32(Vec3Dot(dir, l.Right)), -1, 1)
+
+	// Speeds along the line from the listener to the emitter
+	listenerToward := float64(Vec3Dot(l.Velocity, dir))
+	emitterAway := float64(Vec3Dot(e.Velocity, dir))
+	pitch := (AudioSpeedOfSound + listenerToward) / math.Max(AudioSpeedOfSound+emitterAway, 1)
+	s.Pitch = float32(Clamp(pitch, AudioPitchMin, AudioPitchMax))
+
+	return s
+}
+
+// SetListener places the listener used by Play3d and Update3d
+func (m *Mixer) SetListener(l Listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listener = l
+}
+
+// Play3d starts sound at the position of e. pitch is multiplied with the
+// Doppler shift.
+func (m *Mixer) Play3d(sound *Sound, e Emitter, pitch float32, loop bool) Voice {
+	m.mu.Lock()
+	s := Spatialize(m.listener, e)
+	m.mu.Unlock()
+
+	return m.Play(sound, s.Volume, s.Pan, s.Pitch*pitch, loop)
+}
+
+// Update3d moves v to e, looping voices like engines call it every frame
+func (m *Mixer) Update3d(v Voice, e Emitter, pitch float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vc := m.voice(v)
+	if vc == nil {
+		return
+	}
+	s := Spatialize(m.listener, e)
+	vc.volume = s.Volume
+	vc.pan = s.Pan
+	vc.pitch = max(s.Pitch*pitch, 0)
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestSpatialize(t *testing.T) {
+	listener := Listener{Right: NewVec3(1, 0, 0)}
+
+	tests := []struct {
+		name     string
+		listener Listener
+		emitter  Emitter
+		want     Spatial
+	}{
+		{"at the listener", listener, Emitter{Volume: 1}, Spatial{1, 0, 1}},
+		{"right", listener, Emitter{Position: NewVec3(AudioMinDistance, 0, 0), Volume: 0.5}, Spatial{0.5, 1, 1}},
+		{"left", listener, Emitter{Position: NewVec3(-AudioMinDistance, 0, 0), Volume: 1}, Spatial{1, -1, 1}},
+		{"ahead right", listener, Emitter{Position: NewVec3(300, 0, 300), Volume: 1}, Spatial{1, 0.7071, 1}},
+		{"halfway", listener, Emitter{Position: NewVec3(0, 0, (AudioMinDistance+AudioMaxDistance)/2), Volume: 1}, Spatial{0.5, 0, 1}},
+		{"out of range", listener, Emitter{Position: NewVec3(0, 0, AudioMaxDistance+1), Volume: 1}, Spatial{0, 0, 1}},
+		{
+			"approaching", listener,
+			Emitter{Position: NewVec3(0, 0, 1000), Velocity: NewVec3(0, 0, -AudioSpeedOfSound/10), Volume: 1},
+			Spatial{0.9848, 0, 1.1111},
+		},
+		{
+			"receding", listener,
+			Emitter{Position: NewVec3(0, 0, 1000), Velocity: NewVec3(0, 0, AudioSpeedOfSound/10), Volume: 1},
+			Spatial{0.9848, 0, 0.9091},
+		},
+		{
+			"listener approaching", Listener{Velocity: NewVec3(0, 0, AudioSpeedOfSound/10), Right: NewVec3(1, 0, 0)},
+			Emitter{Position: NewVec3(0, 0, 1000), Volume: 1},
+			Spatial{0.9848, 0, 1.1},
+		},
+		{
+			"passing velocity is no shift", listener,
+			Emitter{Position: NewVec3(0, 0, 1000), Velocity: NewVec3(5000, 0, 0), Volume: 1},
+			Spatial{0.9848, 0, 1},
+		},
+		{
+			"shift is limited", listener,
+			Emitter{Position: NewVec3(0, 0, 1000), Velocity: NewVec3(0, 0, -AudioSpeedOfSound*0.9), Volume: 1},
+			Spatial{0.9848, 0, AudioPitchMax},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Spatialize(tt.listener, tt.emitter)
+			if !near(got.Volume, tt.want.Volume) || !near(got.Pan, tt.want.Pan) || !near(got.Pitch, tt.want.Pitch) {
+				t.Errorf("Spatialize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixer3d(t *testing.T) {
+	m := NewMixer()
+	m.SetListener(Listener{Position: NewVec3(0, 0, 100), Right: NewVec3(1, 0, 0)})
+
+	v := m.Play3d(constSound(100, 1), Emitter{Position: NewVec3(200, 0, 100), Volume: 1}, 1, true)
+	out := make([]float32, 2*AudioChannels)
+	m.Mix(out)
+	if !near(out[0], 0) || !near(out[1], 1) {
+		t.Errorf("right emitter: left %.2f right %.2f", out[0], out[1])
+	}
+
+	m.Update3d(v, Emitter{Position: NewVec3(-200, 0, 100), Volume: 0.5}, 1)
+	m.Mix(out)
+	if !near(out[0], 0.5) || !near(out[1], 0) {
+		t.Errorf("moved left: left %.2f right %.2f", out[0], out[1])
+	}
+}
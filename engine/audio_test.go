@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+// constSound returns a sound of n samples of value v at the mixer's rate
+func constSound(n int, v float32) *Sound {
+	s := &Sound{Samples: make([]float32, n), Rate: AudioSampleRate}
+	for i := range s.Samples {
+		s.Samples[i] = v
+	}
+	return s
+}
+
+type constMusic struct {
+	value  float32
+	frames int
+}
+
+func (c *constMusic) Read(out []float32) int {
+	n := min(len(out)/AudioChannels, c.frames)
+	for i := 0; i < n*AudioChannels; i++ {
+		out[i] = c.value
+	}
+	c.frames -= n
+	return n
+}
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestMixerPan(t *testing.T) {
+	tests := []struct {
+		pan         float32
+		left, right float32
+	}{
+		{0, 0.5, 0.5},
+		{-1, 0.5, 0},
+		{1, 0, 0.5},
+		{0.5, 0.25, 0.5},
+		{-2, 0.5, 0},
+	}
+
+	for _, tt := range tests {
+		m := NewMixer()
+		m.Play(constSound(100, 1), 0.5, tt.pan, 1, false)
+		out := make([]float32, 4*AudioChannels)
+		m.Mix(out)
+		if !near(out[0], tt.left) || !near(out[1], tt.right) {
+			t.Errorf("pan %.1f: left %.2f right %.2f, want %.2f %.2f", tt.pan, out[0], out[1], tt.left, tt.right)
+		}
+	}
+}
+
+func TestMixerPitch(t *testing.T) {
+	ramp := &Sound{Samples: make([]float32, 64), Rate: AudioSampleRate / 2}
+	for i := range ramp.Samples {
+		ramp.Samples[i] = float32(i) / 64
+	}
+
+	tests := []struct {
+		pitch float32
+		step  float32
+	}{
+		{1, 0.5},
+		{2, 1},
+		{0.5, 0.25},
+	}
+
+	for _, tt := range tests {
+		m := NewMixer()
+		m.Play(ramp, 1, 0, tt.pitch, false)
+		out := make([]float32, 8*AudioChannels)
+		m.Mix(out)
+		for frame := 0; frame < 8; frame++ {
+			want := float32(frame) * tt.step / 64
+			if !near(out[frame*AudioChannels], want) {
+				t.Errorf("pitch %.1f frame %d: %.4f, want %.4f", tt.pitch, frame, out[frame*AudioChannels], want)
+			}
+		}
+	}
+}
+
+func TestMixerVoiceEnds(t *testing.T) {
+	m := NewMixer()
+	once := m.Play(constSound(10, 0.25), 1, 0, 1, false)
+	loop := m.Play(constSound(10, 0.25), 1, 0, 1, true)
+
+	out := make([]float32, 16*AudioChannels)
+	m.Mix(out)
+	if !near(out[9*AudioChannels], 0.5) || !near(out[10*AudioChannels], 0.25) {
+		t.Errorf("frames 9, 10 = %.2f, %.2f, want 0.5, 0.25", out[9*AudioChannels], out[10*AudioChannels])
+	}
+	if m.Playing(once) || !m.Playing(loop) {
+		t.Errorf("playing once %v loop %v", m.Playing(once), m.Playing(loop))
+	}
+
+	m.Stop(loop)
+	m.Mix(out)
+	for i, v := range out {
+		if v != 0 {
+			t.Fatalf("sample %d = %.2f after stop", i, v)
+		}
+	}
+}
+
+func TestMixerHandles(t *testing.T) {
+	m := NewMixer()
+	sound := constSound(10, 1)
+
+	first := m.Play(sound, 1, 0, 1, true)
+	m.Stop(first)
+	second := m.Play(sound, 1, 0, 1, true)
+	if first == second || first == VoiceNone {
+		t.Fatalf("reused slot returned the same handle %d", first)
+	}
+
+	// A stale handle must not touch the voice now in its slot
+	m.SetVolume(first, 0)
+	m.Stop(first)
+	if !m.Playing(second) {
+		t.Fatalf("stale handle stopped the new voice")
+	}
+
+	for i := 1; i < AudioMaxVoices; i++ {
+		m.Play(sound, 1, 0, 1, true)
+	}
+	if v := m.Play(sound, 1, 0, 1, true); v != VoiceNone {
+		t.Errorf("play with all voices busy = %d, want none", v)
+	}
+	m.StopAll()
+	if m.Playing(second) {
+		t.Errorf("voice playing after StopAll")
+	}
+}
+
+func TestMixerVolumes(t *testing.T) {
+	m := NewMixer()
+	m.SetSfxVolume(0.5)
+	m.SetMusicVolume(0.25)
+	m.SetMusic(&constMusic{value: 0.8, frames: 2})
+	v := m.Play(constSound(100, 0.5), 1, 0, 1, true)
+
+	out := make([]float32, 4*AudioChannels)
+	m.Mix(out)
+	// Music ran out after two frames
+	want := []float32{0.45, 0.45, 0.45, 0.45, 0.25, 0.25, 0.25, 0.25}
+	for i := range want {
+		if !near(out[i], want[i]) {
+			t.Errorf("sample %d = %.3f, want %.3f", i, out[i], want[i])
+		}
+	}
+
+	// The output is clipped
+	m.SetSfxVolume(1)
+	m.SetVolume(v, 4)
+	m.Mix(out)
+	if out[0] != 1 {
+		t.Errorf("sample = %.2f, want clipped to 1", out[0])
+	}
+}
+
+func TestMixerLoopPoints(t *testing.T) {
+	s := &Sound{Samples: []float32{0.1, 0.2, 0.3, 0.4}, Rate: AudioSampleRate, LoopStart: 2, LoopEnd: 4}
+	m := NewMixer()
+	m.Play(s, 1, 0, 1, true)
+
+	out := make([]float32, 8*AudioChannels)
+	m.Mix(out)
+	want := []float32{0.1, 0.2, 0.3, 0.4, 0.3, 0.4, 0.3, 0.4}
+	for i, w := range want {
+		if !near(out[i*AudioChannels], w) {
+			t.Errorf("frame %d = %.2f, want %.2f", i, out[i*AudioChannels], w)
+		}
+	}
+}
@@ -63,3 +63,21 @@ func GetI32LE(bytes []byte, p *uint32) int32 {
 	return int32(GetU32LE(bytes, p))
 }
 
+func PutU8(bytes []byte, p *uint32, v byte) {
+	bytes[*p] = v
+	*p++
+}
+
+func PutU16LE(bytes []byte, p *uint32, v uint16) {
+	bytes[*p] = byte(v)
+	bytes[*p+1] = byte(v >> 8)
+	*p += 2
+}
+
+func PutU32LE(bytes []byte, p *uint32, v uint32) {
+	bytes[*p] = byte(v)
+	bytes[*p+1] = byte(v >> 8)
+	bytes[*p+2] = byte(v >> 16)
+	bytes[*p+3] = byte(v >> 24)
+	*p += 4
+}
@@ -21,4 +21,21 @@ func TestGetU8(t *testing.T) {
             t.Errorf("GetU8(%v, %v) = %v, pos %v; want %v, pos %v", tt.bytes, tt.pos, got, pos, tt.want, tt.pos+1)
         }
     }
-}
\ No newline at end of file
+}
+func TestPutU32LE(t *testing.T) {
+	tests := []uint32{0, 1, 0x64736f77, 0xffffffff}
+
+	for _, want := range tests {
+		bytes := make([]byte, 4)
+		var p uint32
+		PutU32LE(bytes, &p, want)
+		if p != 4 {
+			t.Errorf("PutU32LE(%#x) advanced pos to %v; want 4", want, p)
+		}
+		p = 0
+		got := GetU32LE(bytes, &p)
+		if got != want {
+			t.Errorf("GetU32LE(PutU32LE(%#x)) = %#x", want, got)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+var (
+	_ Platform      = (*PlatformSdl)(nil)
+	_ Platform      = (*PlatformHeadless)(nil)
+	_ RenderBackend = (*Render)(nil)
+	_ RenderBackend = (*RenderHeadless)(nil)
+	_ RenderBackend = (*RenderSoftware)(nil)
+)
+
+// headlessInput is a scripted input event. A non empty text is typed,
+// otherwise the state of button is set.
+type headlessInput struct {
+	button Button
+	state  float32
+	text   string
+}
+
+// PlatformHeadless runs the game without a window. Its clock advances by a
+// fixed step with every frame and the input is scripted per frame, so a run
+// is the same every time.
+type PlatformHeadless struct {
+	screenSize  Vec2i
+	step        float64
+	time        float64
+	frame       int
+	fullscreen  bool
+	wantToExit  bool
+	input       map[int][]headlessInput
+	audioMix    func(out []float32)
+	audioFrames int
+	audioBuffer []float32
+}
+
+// NewPlatformHeadless creates a platform with a screen of size whose clock
+// advances by step seconds per frame
+func NewPlatformHeadless(size Vec2i, step float64) *PlatformHeadless {
+	return &PlatformHeadless{
+		screenSize: size,
+		step:       step,
+		input:      make(map[int][]headlessInput),
+	}
+}
+
+// Frame returns the number of finished frames
+func (p *PlatformHeadless) Frame() int {
+	return p.frame
+}
+
+// SetButton sets the state of button at the start of frame
+func (p *PlatformHeadless) SetButton(frame int, button Button, state float32) {
+	p.input[frame] = append(p.input[frame], headlessInput{button: button, state: state})
+}
+
+// Press presses button in frame and releases it in the next one
+func (p *PlatformHeadless) Press(frame int, button Button) {
+	p.SetButton(frame, button, 1)
+	p.SetButton(frame+1, button, 0)
+}
+
+// Type sends text to the input capture in frame
+func (p *PlatformHeadless) Type(frame int, text string) {
+	p.input[frame] = append(p.input[frame], headlessInput{text: text})
+}
+
+func (p *PlatformHeadless) Now() float64 {
+	return p.time
+}
+
+// PumpEvents applies the input scripted for the current frame
+func (p *PlatformHeadless) PumpEvents() error {
+	for _, in := range p.input[p.frame] {
+		if in.text == "" {
+			InputSetButtonState(in.button, in.state)
+			continue
+		}
+		for _, c := range in.text {
+			InputTextInput(int32(c))
+		}
+	}
+	delete(p.input, p.frame)
+
+	return nil
+}
+
+func (p *PlatformHeadless) Exit() {
+	p.wantToExit = true
+}
+
+func (p *PlatformHeadless) ExitWanted() bool {
+	return p.wantToExit
+}
+
+func (p *PlatformHeadless) ScreenSize() Vec2i {
+	return p.screenSize
+}
+
+func (p *PlatformHeadless) SetFullscreen(fullscreen bool) error {
+	p.fullscreen = fullscreen
+	return nil
+}
+
+func (p *PlatformHeadless) IsFullScreen() bool {
+	return p.fullscreen
+}
+
+func (p *PlatformHeadless) PrepareFrame() error {
+	return nil
+}
+
+// EndFrame advances the clock to the next frame
+func (p *PlatformHeadless) EndFrame() error {
+	p.frame++
+	p.time = float64(p.frame) * p.step
+
+	return nil
+}
+
+func (p *PlatformHeadless) AudioInit(mix func(out []float32)) error {
+	p.audioMix = mix
+	return nil
+}
+
+// AudioUpdate mixes and drops the samples played up to the current time,
+// keeping voices and music streams going at the pace of the clock
+func (p *PlatformHeadless) AudioUpdate() error {
+	if p.audioMix == nil {
+		return nil
+	}
+
+	frames := int(math.Round(p.time*AudioSampleRate)) - p.audioFrames
+	if frames <= 0 {
+		return nil
+	}
+	p.audioFrames += frames
+
+	samples := frames * AudioChannels
+	if cap(p.audioBuffer) < samples {
+		p.audioBuffer = make([]float32, samples)
+	}
+	p.audioMix(p.audioBuffer[:samples])
+
+	return nil
+}
+
+func (p *PlatformHeadless) AudioCleanup() {
+	p.audioMix = nil
+}
+
+// RenderHeadless is a renderer that draws nothing. It keeps track of the
+// textures and sizes like Render and counts what is pushed to it.
+type RenderHeadless struct {
+	screenSize     Vec2i
+	backBufferSize Vec2i
+	resolution     RenderResolution
+	postEffect     string
+	psx            RenderPsx
+	fov            RenderFov
+	fovDegrees     float32
+	viewportSize   Vec2i
+	blendMode      RenderBlendMode
+	textures       textureTable
+	noTexture      int
+
+	// Frames is the number of finished frames, Tris the number of triangles
+	// pushed in the current frame
+	Frames int
+	Tris   int
+}
+
+func NewRenderHeadless() *RenderHeadless {
+	return &RenderHeadless{fovDegrees: RenderFovDefault}
+}
+
+func (r *RenderHeadless) Init(screenSize Vec2i) {
+	t, err := r.TextureCreate(2, 2, nil)
+	if err != nil {
+		panic(err)
+	}
+	r.noTexture = t
+	r.SetScreenSize(screenSize)
+}
+
+func (r *RenderHeadless) Cleanup() {
+}
+
+func (r *RenderHeadless) SetScreenSize(size Vec2i) {
+	r.screenSize = size
+	r.SetResolution(r.resolution)
+}
+
+func (r *RenderHeadless) Size() Vec2i {
+	return r.viewportSize
+}
+
+func (r *RenderHeadless) SafeArea() (Vec2i, Vec2i) {
+	return renderSafeArea(r.viewportSize)
+}
+
+func (r *RenderHeadless) SetResolution(res RenderResolution) {
+	r.resolution = res
+	r.backBufferSize = renderBackBufferSize(r.screenSize, res)
+	_, r.viewportSize = renderViewport(r.backBufferSize, r.fov)
+}
+
+func (r *RenderHeadless) SetFov(mode RenderFov, degrees float32) {
+	r.fov = mode
+	r.fovDegrees = degrees
+	r.SetResolution(r.resolution)
+}
+
+func (r *RenderHeadless) SetPsx(mode RenderPsx) {
+	r.psx = mode
+}
+
+func (r *RenderHeadless) SetPostEffect(name string) error {
+	if postEffectFind(postEffectBuiltins(), name) < 0 {
+		return fmt.Errorf("invalid post effect %q", name)
+	}
+	r.postEffect = name
+
+	return nil
+}
+
+func (r *RenderHeadless) PostEffects() []string {
+	return postEffectNames(postEffectBuiltins())
+}
+
+func (r *RenderHeadless) FramePrepare() {
+	r.Tris = 0
+}
+
+func (r *RenderHeadless) FrameEnd(cycleTime float64) {
+	r.Frames++
+}
+
+func (r *RenderHeadless) SetView(pos Vec3, angles Vec3) {
+}
+
+func (r *RenderHeadless) SetView2d() {
+}
+
+func (r *RenderHeadless) SetModelMat(m *Mat4) {
+}
+
+func (r *RenderHeadless) SetDepthWrite(enable bool) {
+}
+
+func (r *RenderHeadless) SetDepthTest(enable bool) {
+}
+
+func (r *RenderHeadless) SetDepthOffset(offset float32) {
+}
+
+func (r *RenderHeadless) SetScreenPosition(pos Vec2i) {
+}
+
+func (r *RenderHeadless) SetBlendMode(newMode RenderBlendMode) {
+	r.blendMode = newMode
+}
+
+func (r *RenderHeadless) SetCullBackface(enable bool) {
+}
+
+// Capture returns a black image of the size of source
+func (r *RenderHeadless) Capture(source RenderCapture) (*image.RGBA, error) {
+	size := r.screenSize
+	if source == RenderCaptureBackBuffer {
+		size = r.backBufferSize
+	} else if source != RenderCaptureScreen {
+		return nil, fmt.Errorf("invalid capture source %d", source)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, int(size.X), int(size.Y)))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img, nil
+}
+
+func (r *RenderHeadless) PushTris(tris Tris, textureIndex int) error {
+	if _, err := r.textures.get(textureIndex); err != nil {
+		return err
+	}
+	r.Tris++
+
+	return nil
+}
+
+func (r *RenderHeadless) PushSprite(pos Vec3, size Vec2i, color RGBA, textureIndex int) error {
+	return r.pushQuad(textureIndex)
+}
+
+func (r *RenderHeadless) Push2d(pos Vec2i, size Vec2i, color RGBA, textureIndex int) error {
+	return r.pushQuad(textureIndex)
+}
+
+func (r *RenderHeadless) Push2dTile(pos Vec2i, uvOffset Vec2i, uvSize Vec2i, size Vec2i, color RGBA, textureIndex int) error {
+	return r.pushQuad(textureIndex)
+}
+
+func (r *RenderHeadless) pushQuad(textureIndex int) error {
+	err := r.PushTris(Tris{}, textureIndex)
+	if err != nil {
+		return err
+	}
+	return r.PushTris(Tris{}, textureIndex)
+}
+
+func (r *RenderHeadless) TextureCreate(tw int, th int, pixels []RGBA) (int, error) {
+	return r.textures.add(RenderTexture{size: Vec2i{X: int32(tw), Y: int32(th)}})
+}
+
+func (r *RenderHeadless) TextureSize(textureIndex int) (Vec2i, error) {
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return Vec2i{}, err
+	}
+
+	return t.size, nil
+}
+
+func (r *RenderHeadless) TextureReplacePixels(textureIndex uint16, pixels []RGBA) error {
+	_, err := r.textures.get(int(textureIndex))
+	return err
+}
+
+func (r *RenderHeadless) TextureRetain(textureIndex int) error {
+	return r.textures.retain(textureIndex)
+}
+
+func (r *RenderHeadless) TextureRelease(textureIndex int) error {
+	if textureIndex == r.noTexture {
+		return nil
+	}
+	_, err := r.textures.release(textureIndex)
+	return err
+}
+
+// TexturesDefrag has no atlas to pack
+func (r *RenderHeadless) TexturesDefrag() error {
+	return nil
+}
+
+func (r *RenderHeadless) NoTexture() int {
+	return r.noTexture
+}
+
+func (r *RenderHeadless) TexturesLen() int {
+	return r.textures.len()
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+// headlessFrame runs one frame of the main loop on p
+func headlessFrame(p *PlatformHeadless) {
+	p.PumpEvents()
+	p.AudioUpdate()
+	p.EndFrame()
+	InputClear()
+}
+
+func TestPlatformHeadlessClock(t *testing.T) {
+	p := NewPlatformHeadless(NewVec2i(320, 240), 0.5)
+	var mixed int
+	p.AudioInit(func(out []float32) {
+		mixed += len(out)
+	})
+
+	for i := 0; i < 3; i++ {
+		if p.Now() != float64(i)*0.5 || p.Frame() != i {
+			t.Fatalf("frame %d: now %.2f frame %d", i, p.Now(), p.Frame())
+		}
+		headlessFrame(p)
+	}
+	// The audio of the first two frames is mixed by the end of the third
+	if mixed != AudioSampleRate*AudioChannels {
+		t.Errorf("mixed %d samples, want %d", mixed, AudioSampleRate*AudioChannels)
+	}
+}
+
+func TestPlatformHeadlessInput(t *testing.T) {
+	InputInit()
+	defer InputInit()
+	InputBind(InputLayerUser, InputKeyA, 3)
+
+	p := NewPlatformHeadless(NewVec2i(320, 240), 1.0/60)
+	p.Press(1, InputKeyA)
+	p.SetButton(3, InputKeyA, 0.5)
+
+	want := []struct {
+		state   float32
+		pressed bool
+	}{{0, false}, {1, true}, {0, false}, {0.5, true}}
+	for i, w := range want {
+		p.PumpEvents()
+		if InputState(3) != w.state || InputPressed(3) != w.pressed {
+			t.Errorf("frame %d: state %.1f pressed %v", i, InputState(3), InputPressed(3))
+		}
+		p.EndFrame()
+		InputClear()
+	}
+
+	var typed []int32
+	InputCapture(func(user interface{}, button Button, ascii int32) {
+		if ascii != 0 {
+			typed = append(typed, ascii)
+		}
+	}, nil)
+	defer InputCapture(nil, nil)
+	p.Type(p.Frame(), "AB")
+	headlessFrame(p)
+	if len(typed) != 2 || typed[0] != 'A' || typed[1] != 'B' {
+		t.Errorf("typed %v", typed)
+	}
+}
+
+func TestRenderHeadless(t *testing.T) {
+	r := NewRenderHeadless()
+	r.Init(NewVec2i(1280, 720))
+	if r.TexturesLen() != 1 || r.NoTexture() != 0 {
+		t.Fatalf("%d textures after init, no texture %d", r.TexturesLen(), r.NoTexture())
+	}
+
+	r.SetResolution(RenderResolution240p)
+	if r.Size() != NewVec2i(426, 240) {
+		t.Errorf("240p size %v", r.Size())
+	}
+
+	tex, _ := r.TextureCreate(16, 8, nil)
+	if size, err := r.TextureSize(tex); err != nil || size != NewVec2i(16, 8) {
+		t.Errorf("texture size %v, %v", size, err)
+	}
+
+	r.FramePrepare()
+	r.Push2d(NewVec2i(0, 0), NewVec2i(16, 8), NewRGBA(128, 128, 128, 255), tex)
+	if err := r.PushTris(Tris{}, tex+1); err == nil {
+		t.Errorf("push with an invalid texture")
+	}
+	r.FrameEnd(0)
+	if r.Tris != 2 || r.Frames != 1 {
+		t.Errorf("%d tris in %d frames", r.Tris, r.Frames)
+	}
+
+	if err := r.TextureRelease(tex); err != nil || r.TexturesLen() != 1 {
+		t.Errorf("release: %d textures, %v", r.TexturesLen(), err)
+	}
+	if err := r.TextureRelease(tex); err == nil {
+		t.Errorf("texture released twice")
+	}
+	if err := r.TextureRelease(r.NoTexture()); err != nil || r.TexturesLen() != 1 {
+		t.Errorf("white texture released: %d textures, %v", r.TexturesLen(), err)
+	}
+	if again, _ := r.TextureCreate(4, 4, nil); again != tex {
+		t.Errorf("new texture got handle %d, want the released %d", again, tex)
+	}
+}
+
+func TestRenderHeadlessFov(t *testing.T) {
+	r := NewRenderHeadless()
+	r.Init(NewVec2i(2560, 1080))
+
+	for _, c := range []struct {
+		mode              RenderFov
+		size              Vec2i
+		safePos, safeSize Vec2i
+	}{
+		{RenderFovHorPlus, NewVec2i(2560, 1080), NewVec2i(320, 0), NewVec2i(1920, 1080)},
+		{RenderFovVertical, NewVec2i(2560, 1080), NewVec2i(320, 0), NewVec2i(1920, 1080)},
+		{RenderFov4by3, NewVec2i(1440, 1080), NewVec2i(0, 0), NewVec2i(1440, 1080)},
+	} {
+		r.SetFov(c.mode, RenderFovDefault)
+		pos, size := r.SafeArea()
+		if r.Size() != c.size || pos != c.safePos || size != c.safeSize {
+			t.Errorf("fov mode %d: size %v, safe area %v %v", c.mode, r.Size(), pos, size)
+		}
+	}
+
+	// The 4:3 area follows the resolution and letterboxes tall screens
+	r.SetResolution(RenderResolution240p)
+	if r.Size() != NewVec2i(320, 240) {
+		t.Errorf("4:3 at 240p: size %v", r.Size())
+	}
+	r.SetResolution(RenderResolutionNative)
+	r.SetScreenSize(NewVec2i(600, 800))
+	if r.Size() != NewVec2i(600, 450) {
+		t.Errorf("4:3 of a tall screen: size %v", r.Size())
+	}
+}
+
+func TestRenderProjectionFov(t *testing.T) {
+	near := func(a, b gl.Float) bool {
+		return math.Abs(float64(a-b)) < 1e-4
+	}
+
+	// The default is the framing of the original game
+	m := renderProjection3d(NewVec2i(320, 240), RenderFovHorPlus, RenderFovDefault)
+	if !near(m[0], 1) || !near(m[5], 4.0/3) {
+		t.Errorf("default 4:3 scale %.4f %.4f", m[0], m[5])
+	}
+
+	// Hor+ widens the view of wide screens and keeps its height
+	wide := renderProjection3d(NewVec2i(1920, 1080), RenderFovHorPlus, RenderFovDefault)
+	if !near(wide[5], m[5]) || !near(wide[0], m[5]*9/16) {
+		t.Errorf("hor+ 16:9 scale %.4f %.4f", wide[0], wide[5])
+	}
+
+	vertical := renderProjection3d(NewVec2i(1920, 1080), RenderFovVertical, 90)
+	if !near(vertical[5], 1) {
+		t.Errorf("vertical fov of 90 degrees scales by %.4f", vertical[5])
+	}
+}
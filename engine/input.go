@@ -387,6 +387,20 @@ func InputSetLayerButtonState(layer InputLayer, button Button, state float32) {
 	}
 }
 
+// InputSetActionState sets the state of an action directly, bypassing the
+// bindings, and raises its pressed and released events like a button would
+func InputSetActionState(action byte, state float32) {
+	if action >= InputActionMax {
+		return
+	}
+	if state > 0 && ActionsState[action] == 0 {
+		ActionsPressed[action] = true
+	} else if state == 0 && ActionsState[action] != 0 {
+		ActionsReleased[action] = true
+	}
+	ActionsState[action] = state
+}
+
 func InputSetButtonState(button Button, state float32) {
 	if button < 0 || button >= InputButtonMax {
 		return
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// PCMDecoder decodes a stream chunk by chunk into interleaved 16 bit samples
+type PCMDecoder interface {
+	Channels() int
+	SampleRate() int
+	// Decode returns the next chunk, reusing buf, or io.EOF after the last
+	Decode(buf []int16) ([]int16, error)
+}
+
+// MusicStream plays a PCMDecoder on the mixer's music channel. Mono is
+// played on both sides, channels past the second are dropped and other
+// sample rates are resampled to AudioSampleRate.
+type MusicStream struct {
+	decoder  PCMDecoder
+	channels int
+	step     float64
+	chunk    []int16
+	pos      float64
+	done     atomic.Bool
+	err      error
+}
+
+func NewMusicStream(decoder PCMDecoder) *MusicStream {
+	return &MusicStream{
+		decoder:  decoder,
+		channels: decoder.Channels(),
+		step:     float64(decoder.SampleRate()) / AudioSampleRate,
+	}
+}
+
+// Read implements MusicSource
+func (m *MusicStream) Read(out []float32) int {
+	frames := len(out) / AudioChannels
+	if m.done.Load() || m.channels <= 0 {
+		return 0
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		chunkFrames := len(m.chunk) / m.channels
+		for int(m.pos) >= chunkFrames {
+			m.pos -= float64(chunkFrames)
+			chunk, err := m.decoder.Decode(m.chunk)
+			m.chunk = chunk
+			chunkFrames = len(chunk) / m.channels
+			if err != nil || chunkFrames == 0 {
+				m.err = err
+				m.done.Store(true)
+				return frame
+			}
+		}
+
+		i := int(m.pos) * m.channels
+		left := float32(m.chunk[i]) / 32768
+		right := left
+		if m.channels > 1 {
+			right = float32(m.chunk[i+1]) / 32768
+		}
+		out[frame*AudioChannels] = left
+		out[frame*AudioChannels+1] = right
+		m.pos += m.step
+	}
+
+	return frames
+}
+
+// Done reports whether the stream reached its end or failed
+func (m *MusicStream) Done() bool {
+	return m.done.Load()
+}
+
+// Err returns the error that ended the stream, nil at the regular end. It
+// must only be read once Done returned true.
+func (m *MusicStream) Err() error {
+	if errors.Is(m.err, io.EOF) {
+		return nil
+	}
+	return m.err
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// chunkDecoder returns its chunks in order and then err
+type chunkDecoder struct {
+	channels int
+	rate     int
+	chunks   [][]int16
+	err      error
+}
+
+func (c *chunkDecoder) Channels() int {
+	return c.channels
+}
+
+func (c *chunkDecoder) SampleRate() int {
+	return c.rate
+}
+
+func (c *chunkDecoder) Decode(buf []int16) ([]int16, error) {
+	if len(c.chunks) == 0 {
+		return buf[:0], c.err
+	}
+	chunk := c.chunks[0]
+	c.chunks = c.chunks[1:]
+	return append(buf[:0], chunk...), nil
+}
+
+func TestMusicStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		decoder *chunkDecoder
+		want    []float32
+	}{
+		{
+			"stereo across chunks",
+			&chunkDecoder{channels: 2, rate: AudioSampleRate, chunks: [][]int16{{8192, -8192}, {16384, 0, 0, 16384}}, err: io.EOF},
+			[]float32{0.25, -0.25, 0.5, 0, 0, 0.5},
+		},
+		{
+			"mono on both sides",
+			&chunkDecoder{channels: 1, rate: AudioSampleRate, chunks: [][]int16{{8192, 16384}}, err: io.EOF},
+			[]float32{0.25, 0.25, 0.5, 0.5},
+		},
+		{
+			"half rate",
+			&chunkDecoder{channels: 1, rate: AudioSampleRate / 2, chunks: [][]int16{{8192, 16384}}, err: io.EOF},
+			[]float32{0.25, 0.25, 0.25, 0.25, 0.5, 0.5, 0.5, 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMusicStream(tt.decoder)
+			out := make([]float32, len(tt.want)+4*AudioChannels)
+			n := s.Read(out)
+			if n != len(tt.want)/AudioChannels {
+				t.Fatalf("read %d frames, want %d", n, len(tt.want)/AudioChannels)
+			}
+			for i, w := range tt.want {
+				if out[i] != w {
+					t.Errorf("sample %d = %.2f, want %.2f", i, out[i], w)
+				}
+			}
+			if !s.Done() || s.Err() != nil {
+				t.Errorf("done %v err %v", s.Done(), s.Err())
+			}
+			if s.Read(out) != 0 {
+				t.Errorf("read after the end")
+			}
+		})
+	}
+}
+
+func TestMusicStreamError(t *testing.T) {
+	broken := errors.New("broken")
+	s := NewMusicStream(&chunkDecoder{channels: 2, rate: AudioSampleRate, err: broken})
+	s.Read(make([]float32, 8))
+	if !s.Done() || s.Err() != broken {
+		t.Errorf("done %v err %v", s.Done(), s.Err())
+	}
+}
@@ -0,0 +1,25 @@
+package engine
+
+// Platform is the window, clock, input and audio device the game runs on.
+// PlatformSdl opens a real window, PlatformHeadless runs without one.
+type Platform interface {
+	// Now returns the time in seconds
+	Now() float64
+	// PumpEvents feeds the pending input to the input state
+	PumpEvents() error
+	Exit()
+	ExitWanted() bool
+	ScreenSize() Vec2i
+	SetFullscreen(fullscreen bool) error
+	IsFullScreen() bool
+
+	PrepareFrame() error
+	EndFrame() error
+
+	// AudioInit starts the audio device, which renders its samples with mix.
+	// AudioUpdate is called once per frame for devices that are fed by the
+	// game loop.
+	AudioInit(mix func(out []float32)) error
+	AudioUpdate() error
+	AudioCleanup()
+}
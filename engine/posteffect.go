@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PostEffectNone = "none"
+	PostEffectCRT  = "crt"
+
+	// PostEffectDir holds the user presets. A .glsl file is a preset of one
+	// pass, a directory a preset of the .glsl files in it, in name order.
+	// Both are named after the file or directory without extension.
+	PostEffectDir = "data/shaders"
+
+	// PostEffectNameMax is the longest preset name, in bytes, that the save
+	// can store
+	PostEffectNameMax = 15
+
+	// postEffectReloadInterval is how often the preset files are checked
+	// for changes
+	postEffectReloadInterval = 500 * time.Millisecond
+)
+
+// PostEffectParam is a float uniform of a pass, declared in its source with
+//
+//	#pragma parameter name default
+//	uniform float name;
+type PostEffectParam struct {
+	Name  string
+	Value float32
+}
+
+// PostEffectPass is the fragment shader of one step of a post effect. It
+// reads the output of the pass before it, or the back buffer for the first,
+// from the sampler texture and the back buffer from the sampler original.
+// The uniforms time and screen_size are set like for the built-in effects.
+type PostEffectPass struct {
+	// Path is the file the pass was loaded from, empty for built-ins
+	Path   string
+	Source string
+	Params []PostEffectParam
+}
+
+// PostEffectPreset is a named chain of passes, the last one draws to the
+// screen
+type PostEffectPreset struct {
+	Name   string
+	Passes []PostEffectPass
+}
+
+func postEffectBuiltins() []PostEffectPreset {
+	return []PostEffectPreset{
+		{Name: PostEffectNone, Passes: []PostEffectPass{{Source: postEffectFragmentShaderSourceDefault}}},
+		{Name: PostEffectCRT, Passes: []PostEffectPass{{Source: postEffectFragmentShaderSourceCRT}}},
+	}
+}
+
+// PostEffectPresets returns the built-in presets followed by those in dir.
+// A preset of dir replaces a built-in of the same name. Presets that fail
+// to load are left out and reported in the error.
+func PostEffectPresets(dir string) ([]PostEffectPreset, error) {
+	presets := postEffectBuiltins()
+	loaded, err := PostEffectLoadDir(dir)
+	for _, preset := range loaded {
+		if i := postEffectFind(presets, preset.Name); i >= 0 {
+			presets[i] = preset
+		} else {
+			presets = append(presets, preset)
+		}
+	}
+	return presets, err
+}
+
+// PostEffectLoadDir loads the presets in dir. A missing dir holds none.
+// Presets named longer than PostEffectNameMax are left out.
+func PostEffectLoadDir(dir string) ([]PostEffectPreset, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []PostEffectPreset
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if (entry.IsDir() || postEffectIsPass(entry.Name())) && len(name) > PostEffectNameMax {
+			errs = append(errs, fmt.Errorf("%s: name longer than %d bytes", path, PostEffectNameMax))
+			continue
+		}
+
+		var files []string
+		if entry.IsDir() {
+			files, err = postEffectFiles(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		} else if postEffectIsPass(entry.Name()) {
+			files = []string{path}
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		preset := PostEffectPreset{Name: name}
+		for _, file := range files {
+			pass, err := postEffectLoadPass(file)
+			if err != nil {
+				errs = append(errs, err)
+				preset.Passes = nil
+				break
+			}
+			preset.Passes = append(preset.Passes, pass)
+		}
+		if len(preset.Passes) > 0 {
+			presets = append(presets, preset)
+		}
+	}
+
+	return presets, errors.Join(errs...)
+}
+
+func postEffectIsPass(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".glsl")
+}
+
+// postEffectFiles returns the passes of a preset directory in name order
+func postEffectFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && postEffectIsPass(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func postEffectLoadPass(path string) (PostEffectPass, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return PostEffectPass{}, err
+	}
+	params, err := postEffectParams(string(source))
+	if err != nil {
+		return PostEffectPass{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return PostEffectPass{Path: path, Source: string(source), Params: params}, nil
+}
+
+// postEffectParams collects the #pragma parameter lines of a pass
+func postEffectParams(source string) ([]PostEffectParam, error) {
+	var params []PostEffectParam
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "#pragma" || fields[1] != "parameter" {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: want #pragma parameter name default", line)
+		}
+		value, err := strconv.ParseFloat(fields[3], 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: parameter %s: %w", line, fields[2], err)
+		}
+		params = append(params, PostEffectParam{Name: fields[2], Value: float32(value)})
+	}
+	return params, scanner.Err()
+}
+
+// postEffectFind returns the index of the preset called name, or -1
+func postEffectFind(presets []PostEffectPreset, name string) int {
+	for i := range presets {
+		if presets[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func postEffectNames(presets []PostEffectPreset) []string {
+	names := make([]string, len(presets))
+	for i := range presets {
+		names[i] = presets[i].Name
+	}
+	return names
+}
+
+// postEffectWatch notices when the pass files below a directory are added,
+// removed or modified
+type postEffectWatch struct {
+	dir     string
+	stamps  map[string]time.Time
+	checked time.Time
+}
+
+func newPostEffectWatch(dir string) *postEffectWatch {
+	return &postEffectWatch{dir: dir, stamps: postEffectStamps(dir)}
+}
+
+// changed reports whether the files differ from the last check. It looks
+// at the disk at most once per postEffectReloadInterval.
+func (w *postEffectWatch) changed(now time.Time) bool {
+	if now.Sub(w.checked) < postEffectReloadInterval {
+		return false
+	}
+	w.checked = now
+
+	stamps := postEffectStamps(w.dir)
+	changed := len(stamps) != len(w.stamps)
+	for path, stamp := range stamps {
+		if old, ok := w.stamps[path]; !ok || !old.Equal(stamp) {
+			changed = true
+		}
+	}
+	w.stamps = stamps
+	return changed
+}
+
+func postEffectStamps(dir string) map[string]time.Time {
+	stamps := make(map[string]time.Time)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !postEffectIsPass(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			stamps[path] = info.ModTime()
+		}
+		return nil
+	})
+	return stamps
+}
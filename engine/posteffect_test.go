@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostEffectPresets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "blur", "2-vertical.glsl"), "void main() {}")
+	writeFile(t, filepath.Join(dir, "blur", "1-horizontal.glsl"), "#pragma parameter radius 2.5\nuniform float radius;\n")
+	writeFile(t, filepath.Join(dir, "blur", "notes.txt"), "not a pass")
+	writeFile(t, filepath.Join(dir, "crt.glsl"), "void main() {}")
+	writeFile(t, filepath.Join(dir, "broken.glsl"), "#pragma parameter strength\n")
+	writeFile(t, filepath.Join(dir, "longer-than-the-save.glsl"), "void main() {}")
+
+	presets, err := PostEffectPresets(dir)
+	if err == nil {
+		t.Errorf("broken parameter and long name not reported")
+	}
+	if names := postEffectNames(presets); !reflect.DeepEqual(names, []string{PostEffectNone, PostEffectCRT, "blur"}) {
+		t.Fatalf("presets %v", names)
+	}
+
+	// The file replaces the built-in preset of the same name
+	if crt := presets[1].Passes; len(crt) != 1 || crt[0].Path != filepath.Join(dir, "crt.glsl") {
+		t.Errorf("crt passes %+v", crt)
+	}
+
+	blur := presets[2].Passes
+	if len(blur) != 2 || filepath.Base(blur[0].Path) != "1-horizontal.glsl" || filepath.Base(blur[1].Path) != "2-vertical.glsl" {
+		t.Fatalf("blur passes %+v", blur)
+	}
+	if want := []PostEffectParam{{"radius", 2.5}}; !reflect.DeepEqual(blur[0].Params, want) || blur[1].Params != nil {
+		t.Errorf("blur params %v, %v", blur[0].Params, blur[1].Params)
+	}
+
+	if presets, err := PostEffectPresets(filepath.Join(dir, "missing")); err != nil || len(presets) != 2 {
+		t.Errorf("missing dir: %d presets, %v", len(presets), err)
+	}
+}
+
+func TestPostEffectWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tint", "tint.glsl")
+	writeFile(t, path, "void main() {}")
+
+	w := newPostEffectWatch(dir)
+	now := time.Now()
+	if w.changed(now) {
+		t.Errorf("changed without a change")
+	}
+
+	// Edits are only looked at once per interval
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	if w.changed(now.Add(postEffectReloadInterval / 2)) {
+		t.Errorf("checked before the interval passed")
+	}
+	now = now.Add(postEffectReloadInterval)
+	if !w.changed(now) {
+		t.Errorf("modified pass not noticed")
+	}
+
+	now = now.Add(postEffectReloadInterval)
+	writeFile(t, filepath.Join(dir, "new.glsl"), "void main() {}")
+	if !w.changed(now) {
+		t.Errorf("new pass not noticed")
+	}
+
+	now = now.Add(postEffectReloadInterval)
+	os.Remove(path)
+	if !w.changed(now) {
+		t.Errorf("removed pass not noticed")
+	}
+}
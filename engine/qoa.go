@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// QoaMaxChannels is the most channels a QOA frame can hold
+	QoaMaxChannels = 8
+	// QoaSliceLen is the number of samples of one channel in a slice
+	QoaSliceLen = 20
+	// QoaFrameLen is the most samples of one channel in a frame
+	QoaFrameLen = 256 * QoaSliceLen
+
+	qoaLMSLen          = 4
+	qoaFileHeaderSize  = 8
+	qoaFrameHeaderSize = 8
+)
+
+var ErrQoaHeader = errors.New("qoa: not a qoaf file")
+
+// qoaDequant is the residual for each scalefactor and quantized value
+var qoaDequant = func() (tab [16][8]int32) {
+	values := [8]float64{0.75, -0.75, 2.5, -2.5, 4.5, -4.5, 7, -7}
+	for s := range tab {
+		scalefactor := math.Round(math.Pow(float64(s+1), 2.75))
+		for q := range tab[s] {
+			tab[s][q] = int32(math.Round(scalefactor * values[q]))
+		}
+	}
+	return tab
+}()
+
+type qoaLMS struct {
+	history [qoaLMSLen]int32
+	weights [qoaLMSLen]int32
+}
+
+func (l *qoaLMS) predict() int32 {
+	var prediction int64
+	for i := range l.history {
+		prediction += int64(l.weights[i]) * int64(l.history[i])
+	}
+	return int32(prediction >> 13)
+}
+
+func (l *qoaLMS) update(sample, residual int32) {
+	delta := residual >> 4
+	for i := range l.history {
+		if l.history[i] < 0 {
+			l.weights[i] -= delta
+		} else {
+			l.weights[i] += delta
+		}
+	}
+	copy(l.history[:], l.history[1:])
+	l.history[qoaLMSLen-1] = sample
+}
+
+// QoaDecoder decodes a QOA stream one frame at a time, so only a single
+// frame is held in memory however long the stream is
+type QoaDecoder struct {
+	r        io.Reader
+	channels int
+	rate     int
+	header   uint64
+	lms      [QoaMaxChannels]qoaLMS
+	frame    []byte
+}
+
+// NewQoaDecoder reads the file header and the first frame header of r
+func NewQoaDecoder(r io.Reader) (*QoaDecoder, error) {
+	var header [qoaFileHeaderSize + qoaFrameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "qoaf" {
+		return nil, ErrQoaHeader
+	}
+
+	d := &QoaDecoder{
+		r:      r,
+		header: binary.BigEndian.Uint64(header[qoaFileHeaderSize:]),
+	}
+	d.channels = int(d.header >> 56)
+	d.rate = int(d.header >> 32 & 0xffffff)
+	if d.channels == 0 || d.channels > QoaMaxChannels || d.rate == 0 {
+		return nil, ErrQoaHeader
+	}
+
+	return d, nil
+}
+
+func (d *QoaDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *QoaDecoder) SampleRate() int {
+	return d.rate
+}
+
+// Decode decodes the next frame into buf and returns the interleaved
+// samples, or io.EOF after the last frame
+func (d *QoaDecoder) Decode(buf []int16) ([]int16, error) {
+	if d.header == 0 {
+		return buf[:0], io.EOF
+	}
+
+	channels := int(d.header >> 56)
+	samples := int(d.header >> 16 & 0xffff)
+	size := int(d.header & 0xffff)
+	if channels != d.channels || size < qoaFrameHeaderSize {
+		return buf[:0], ErrQoaHeader
+	}
+
+	// Read the frame body together with the next frame's header
+	body := size - qoaFrameHeaderSize
+	if cap(d.frame) < body+qoaFrameHeaderSize {
+		d.frame = make([]byte, body+qoaFrameHeaderSize)
+	}
+	frame := d.frame[:body+qoaFrameHeaderSize]
+	n, err := io.ReadFull(d.r, frame)
+	switch {
+	case n == len(frame):
+		d.header = binary.BigEndian.Uint64(frame[body:])
+	case n >= body:
+		d.header = 0
+	default:
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return buf[:0], err
+	}
+
+	return d.decodeFrame(frame[:body], channels, samples, buf), nil
+}
+
+func (d *QoaDecoder) decodeFrame(frame []byte, channels, samples int, buf []int16) []int16 {
+	p := 0
+	for c := 0; c < channels; c++ {
+		if p+16 > len(frame) {
+			return buf[:0]
+		}
+		history := binary.BigEndian.Uint64(frame[p:])
+		weights := binary.BigEndian.Uint64(frame[p+8:])
+		p += 16
+		for i := 0; i < qoaLMSLen; i++ {
+			d.lms[c].history[i] = int32(int16(history >> 48))
+			d.lms[c].weights[i] = int32(int16(weights >> 48))
+			history <<= 16
+			weights <<= 16
+		}
+	}
+
+	// A truncated frame only decodes the samples its slices hold
+	slices := (len(frame) - p) / 8
+	samples = min(samples, slices/channels*QoaSliceLen)
+
+	if cap(buf) < samples*channels {
+		buf = make([]int16, samples*channels)
+	}
+	buf = buf[:samples*channels]
+
+	for index := 0; index < samples; index += QoaSliceLen {
+		for c := 0; c < channels; c++ {
+			slice := binary.BigEndian.Uint64(frame[p:])
+			p += 8
+			scalefactor := slice >> 60
+			slice <<= 4
+
+			lms := &d.lms[c]
+			end := min(index+QoaSliceLen, samples)
+			for si := index*channels + c; si < end*channels; si += channels {
+				predicted := lms.predict()
+				residual := qoaDequant[scalefactor][slice>>61]
+				sample := Clamp(predicted+residual, -32768, 32767)
+				buf[si] = int16(sample)
+				slice <<= 3
+				lms.update(sample, residual)
+			}
+		}
+	}
+
+	return buf
+}
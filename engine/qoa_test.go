@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// qoaSlice packs a scalefactor and up to 20 quantized residuals
+func qoaSlice(scalefactor uint64, quantized ...uint64) uint64 {
+	slice := scalefactor << 60
+	for i, q := range quantized {
+		slice |= q << (57 - 3*i)
+	}
+	return slice
+}
+
+// qoaFrame builds a frame from the LMS state of each channel, two words
+// each, followed by the slices
+func qoaFrame(channels, rate, samples int, words ...uint64) []byte {
+	size := qoaFrameHeaderSize + 8*len(words)
+	header := uint64(channels)<<56 | uint64(rate)<<32 | uint64(samples)<<16 | uint64(size)
+	frame := binary.BigEndian.AppendUint64(nil, header)
+	for _, w := range words {
+		frame = binary.BigEndian.AppendUint64(frame, w)
+	}
+	return frame
+}
+
+func qoaFile(frames ...[]byte) []byte {
+	file := []byte("qoaf\x00\x00\x00\x00")
+	for _, f := range frames {
+		file = append(file, f...)
+	}
+	return file
+}
+
+func TestQoaDequant(t *testing.T) {
+	want := map[int][8]int32{
+		0:  {1, -1, 3, -3, 5, -5, 7, -7},
+		1:  {5, -5, 18, -18, 32, -32, 49, -49},
+		15: {1536, -1536, 5120, -5120, 9216, -9216, 14336, -14336},
+	}
+	for s, w := range want {
+		if qoaDequant[s] != w {
+			t.Errorf("scalefactor %d: %v, want %v", s, qoaDequant[s], w)
+		}
+	}
+}
+
+func TestQoaDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		frame    []byte
+		want     []int16
+	}{
+		{
+			"residuals only", 1,
+			qoaFrame(1, 44100, 5, 0, 0, qoaSlice(0, 0, 2, 4, 6, 1)),
+			[]int16{1, 3, 5, 7, -1},
+		},
+		{
+			"prediction", 1,
+			qoaFrame(1, 44100, 3, 100, 8192, qoaSlice(0, 0, 0, 0)),
+			[]int16{101, 102, 103},
+		},
+		{
+			"stereo", 2,
+			qoaFrame(2, 44100, 2, 0, 0, 0, 0, qoaSlice(0, 2, 2), qoaSlice(0, 3, 3)),
+			[]int16{3, -3, 3, -3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewQoaDecoder(bytes.NewReader(qoaFile(tt.frame)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Channels() != tt.channels || d.SampleRate() != 44100 {
+				t.Errorf("channels %d rate %d", d.Channels(), d.SampleRate())
+			}
+
+			got, err := d.Decode(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d samples, want %d", len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("sample %d = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+
+			if _, err := d.Decode(got); err != io.EOF {
+				t.Errorf("after the last frame err = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestQoaStream(t *testing.T) {
+	first := qoaFrame(1, 22050, 2, 0, 0, qoaSlice(0, 0, 0))
+	second := qoaFrame(1, 22050, 1, 0, 0, qoaSlice(0, 7))
+
+	d, err := NewQoaDecoder(bytes.NewReader(qoaFile(first, second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lens []int
+	var last int16
+	var buf []int16
+	for {
+		buf, err = d.Decode(buf)
+		if err != nil {
+			break
+		}
+		lens = append(lens, len(buf))
+		last = buf[len(buf)-1]
+	}
+	if err != io.EOF || len(lens) != 2 || lens[0] != 2 || lens[1] != 1 || last != -7 {
+		t.Errorf("frames %v last sample %d err %v", lens, last, err)
+	}
+
+	// A frame cut short is an error
+	file := qoaFile(first, second)
+	d, _ = NewQoaDecoder(bytes.NewReader(file[:len(file)-4]))
+	d.Decode(nil)
+	if _, err := d.Decode(nil); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame err = %v", err)
+	}
+
+	if _, err := NewQoaDecoder(bytes.NewReader([]byte("RIFF0000qoaf0000"))); err != ErrQoaHeader {
+		t.Errorf("wrong magic err = %v", err)
+	}
+}
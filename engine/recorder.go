@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrFrameSize = errors.New("frame size changed during recording")
+
+// FrameWriter stores the frames of a recording
+type FrameWriter interface {
+	WriteFrame(img *image.RGBA) error
+	Close() error
+}
+
+// CreateFrameWriter writes a Y4M video to path when it ends in .y4m and a
+// numbered PNG sequence into the directory path otherwise
+func CreateFrameWriter(path string, fps int) (FrameWriter, error) {
+	if strings.EqualFold(filepath.Ext(path), ".y4m") {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewY4mWriter(f, fps), nil
+	}
+
+	return NewPngSequenceWriter(path)
+}
+
+// PngSequenceWriter writes every frame to its own numbered PNG file
+type PngSequenceWriter struct {
+	dir   string
+	frame int
+}
+
+func NewPngSequenceWriter(dir string) (*PngSequenceWriter, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &PngSequenceWriter{dir: dir}, nil
+}
+
+func (w *PngSequenceWriter) WriteFrame(img *image.RGBA) error {
+	f, err := os.Create(filepath.Join(w.dir, fmt.Sprintf("frame-%06d.png", w.frame)))
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.frame++
+
+	return f.Close()
+}
+
+func (w *PngSequenceWriter) Close() error {
+	return nil
+}
+
+// Y4mWriter writes an uncompressed YUV4MPEG2 stream with 4:2:0 full range
+// chroma, which ffmpeg and most players read directly. The frame size is
+// taken from the first frame.
+type Y4mWriter struct {
+	out    io.WriteCloser
+	buf    *bufio.Writer
+	fps    int
+	size   image.Point
+	planes []byte
+}
+
+func NewY4mWriter(out io.WriteCloser, fps int) *Y4mWriter {
+	return &Y4mWriter{out: out, buf: bufio.NewWriter(out), fps: fps}
+}
+
+func (w *Y4mWriter) WriteFrame(img *image.RGBA) error {
+	size := img.Bounds().Size()
+	if w.planes == nil {
+		w.size = size
+		_, err := fmt.Fprintf(w.buf, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n", size.X, size.Y, w.fps)
+		if err != nil {
+			return err
+		}
+		cw, ch := (size.X+1)/2, (size.Y+1)/2
+		w.planes = make([]byte, size.X*size.Y+2*cw*ch)
+	} else if size != w.size {
+		return ErrFrameSize
+	}
+
+	y4mPlanes(img, w.planes)
+	_, err := w.buf.WriteString("FRAME\n")
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(w.planes)
+
+	return err
+}
+
+// y4mPlanes converts img to a Y plane followed by Cb and Cr planes at half
+// resolution, each chroma sample the average of a 2×2 block
+func y4mPlanes(img *image.RGBA, planes []byte) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	cw, ch := (width+1)/2, (height+1)/2
+	lum := planes[:width*height]
+	cb := planes[width*height : width*height+cw*ch]
+	cr := planes[width*height+cw*ch:]
+
+	for cy := 0; cy < ch; cy++ {
+		for cx := 0; cx < cw; cx++ {
+			var sumCb, sumCr, n int
+			for y := cy * 2; y < min(cy*2+2, height); y++ {
+				for x := cx * 2; x < min(cx*2+2, width); x++ {
+					p := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y):]
+					yy, u, v := color.RGBToYCbCr(p[0], p[1], p[2])
+					lum[y*width+x] = yy
+					sumCb += int(u)
+					sumCr += int(v)
+					n++
+				}
+			}
+			cb[cy*cw+cx] = byte((sumCb + n/2) / n)
+			cr[cy*cw+cx] = byte((sumCr + n/2) / n)
+		}
+	}
+}
+
+func (w *Y4mWriter) Close() error {
+	err := w.buf.Flush()
+	if err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// closeBuffer is a bytes.Buffer standing in for the recording file
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestY4mWriter(t *testing.T) {
+	out := &closeBuffer{}
+	w := NewY4mWriter(out, 30)
+
+	// Odd sizes round the chroma planes up
+	white, red := solidImage(5, 3, color.RGBA{255, 255, 255, 255}), solidImage(5, 3, color.RGBA{255, 0, 0, 255})
+	for _, img := range []*image.RGBA{white, red} {
+		if err := w.WriteFrame(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteFrame(solidImage(4, 4, color.RGBA{})); !errors.Is(err, ErrFrameSize) {
+		t.Errorf("frame of another size: %v", err)
+	}
+	if err := w.Close(); err != nil || !out.closed {
+		t.Fatalf("close %v, closed %v", err, out.closed)
+	}
+
+	header := "YUV4MPEG2 W5 H3 F30:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n"
+	const planes = 5*3 + 2*3*2
+	data := out.Bytes()
+	if len(data) != len(header)+2*(len("FRAME\n")+planes) || string(data[:len(header)]) != header {
+		t.Fatalf("stream of %d bytes starting %q", len(data), data[:min(len(data), len(header))])
+	}
+
+	frame := data[len(header)+len("FRAME\n")+planes+len("FRAME\n"):]
+	y, cb, cr := color.RGBToYCbCr(255, 0, 0)
+	if frame[0] != y || frame[5*3] != cb || frame[5*3+6] != cr {
+		t.Errorf("red frame starts with Y %d Cb %d Cr %d, want %d %d %d", frame[0], frame[5*3], frame[5*3+6], y, cb, cr)
+	}
+}
+
+func TestPngSequenceWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rec")
+	w, err := CreateFrameWriter(dir, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WriteFrame(solidImage(4, 4, color.RGBA{0, 0, 0, 255})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"frame-000000.png", "frame-000001.png", "frame-000002.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package engine
 
 import (
 	"fmt"
+	"image"
 	"math"
+	"time"
 	"unsafe"
 
 	gl "github.com/chsc/gogl/gl33"
@@ -14,9 +16,14 @@ const (
 	AtlasSize   = 64
 	AtlasGrid   = 32
 	AtlasBorder = 16
+	// AtlasPagesMax bounds the number of atlas textures, each of
+	// AtlasSize*AtlasGrid pixels square
+	AtlasPagesMax = 16
 
 	RenderTrisBufferCapacity = 2048
-	TextureMax               = 1024
+	// TextureMax is the number of texture handles, bound by the uint16
+	// indices of TextureReplacePixels
+	TextureMax = math.MaxUint16
 
 	NearPlane                       = 16.0
 	FarPlane                        = 64000.0
@@ -40,19 +47,120 @@ const (
 	RenderResolutionNative RenderResolution = iota
 	RenderResolution240p
 	RenderResolution480p
+	NumRenderResolution
 )
 
-type RenderPostEffect byte
+// RenderPsx selects how closely the game shader imitates the PlayStation
+type RenderPsx byte
 
 const (
-	RenderPostEffectNone RenderPostEffect = iota
-	RenderPostEffectCRT
-	NumRenderPostEffects
+	RenderPsxOff RenderPsx = iota
+	// RenderPsxOn snaps vertices to the pixel grid of the back buffer, maps
+	// textures affinely and dithers the output to 15-bit color
+	RenderPsxOn
+	// RenderPsxNearest is RenderPsxOn with textures sampled without mipmaps
+	// or filtering
+	RenderPsxNearest
+	NumRenderPsx
+)
+
+// RenderFov selects how the field of view follows the aspect of the screen
+type RenderFov byte
+
+const (
+	// RenderFovHorPlus takes the field of view as the horizontal one of a
+	// 4:3 screen and keeps the vertical one that gives, wider screens see
+	// more to the sides
+	RenderFovHorPlus RenderFov = iota
+	// RenderFovVertical takes the field of view as the vertical one
+	RenderFovVertical
+	// RenderFov4by3 draws the framing of RenderFovHorPlus to a 4:3 area in
+	// the middle of the back buffer, with black bars around it
+	RenderFov4by3
+	NumRenderFov
+)
+
+const (
+	// RenderFovDefault is the horizontal field of view of the original game
+	// at 4:3, a vertical one of 73.75 degrees
+	RenderFovDefault = 90.0
+
+	// RenderSafeAspect is the widest aspect the UI is spread over, on wider
+	// screens it keeps to an area of this aspect in the middle
+	RenderSafeAspect = 16.0 / 9.0
+)
+
+// RenderCapture selects the buffer Capture reads
+type RenderCapture byte
+
+const (
+	// RenderCaptureScreen is the final frame after the post effect
+	RenderCaptureScreen RenderCapture = iota
+	// RenderCaptureBackBuffer is the frame before the post effect
+	RenderCaptureBackBuffer
 )
 
 type RenderTexture struct {
+	page   int
 	offset Vec2i
 	size   Vec2i
+	refs   int
+}
+
+// RenderBackend is implemented by the renderers the game can draw with.
+// Render draws with OpenGL, RenderHeadless only keeps track of the state.
+type RenderBackend interface {
+	Init(screenSize Vec2i)
+	Cleanup()
+	SetScreenSize(size Vec2i)
+	Size() Vec2i
+	SetResolution(res RenderResolution)
+	SetPsx(mode RenderPsx)
+	// SetFov sets the field of view in degrees, measured as mode says, and
+	// the area of the back buffer drawn to. Size returns the size of that
+	// area, SafeArea the part of it the UI is anchored to.
+	SetFov(mode RenderFov, degrees float32)
+	SafeArea() (pos Vec2i, size Vec2i)
+	// SetPostEffect selects the post effect preset called name, PostEffects
+	// lists the available ones
+	SetPostEffect(name string) error
+	PostEffects() []string
+
+	FramePrepare()
+	FrameEnd(cycleTime float64)
+
+	SetView(pos Vec3, angles Vec3)
+	SetView2d()
+	SetModelMat(m *Mat4)
+	SetDepthWrite(enable bool)
+	SetDepthTest(enable bool)
+	SetDepthOffset(offset float32)
+	SetScreenPosition(pos Vec2i)
+	SetBlendMode(newMode RenderBlendMode)
+	SetCullBackface(enable bool)
+
+	PushTris(tris Tris, textureIndex int) error
+	PushSprite(pos Vec3, size Vec2i, color RGBA, textureIndex int) error
+	Push2d(pos Vec2i, size Vec2i, color RGBA, textureIndex int) error
+	Push2dTile(pos Vec2i, uvOffset Vec2i, uvSize Vec2i, size Vec2i, color RGBA, textureIndex int) error
+
+	// Capture reads back the finished frame, top row first
+	Capture(source RenderCapture) (*image.RGBA, error)
+
+	// TextureCreate returns the handle of a new texture, owned by the
+	// caller until it releases it
+	TextureCreate(tw int, th int, pixels []RGBA) (int, error)
+	TextureSize(textureIndex int) (Vec2i, error)
+	TextureReplacePixels(textureIndex uint16, pixels []RGBA) error
+	// TextureRetain adds an owner to a texture. TextureRelease drops one,
+	// the last frees the texture and its atlas space.
+	TextureRetain(textureIndex int) error
+	TextureRelease(textureIndex int) error
+	// TexturesDefrag repacks the live textures to join the atlas space
+	// left by freed ones
+	TexturesDefrag() error
+	NoTexture() int
+	TexturesLen() int
 }
 
 var (
@@ -68,9 +176,16 @@ type Render struct {
 
 	screenSize     Vec2i
 	backBufferSize Vec2i
-
-	atlasMap        [AtlasSize]uint32
-	atlasTexture    gl.Uint
+	// The scene is drawn to the viewport of the back buffer
+	viewportPos  Vec2i
+	viewportSize Vec2i
+
+	// Textures are packed into atlas pages; tris are batched per page and
+	// drawn with trisPage bound, -1 while no page is bound
+	atlasMaps       []atlasPage
+	atlasTextures   []gl.Uint
+	atlasDirty      []bool
+	trisPage        int
 	renderBlendMode RenderBlendMode
 	renderNoTexture uint16
 
@@ -80,27 +195,41 @@ type Render struct {
 	spriteMat       Mat4
 	viewMat         Mat4
 
-	textures             [TextureMax]RenderTexture
-	texturesLen          int
-	textureMipMapIsDirty bool
+	textures textureTable
 
 	renderResolution      RenderResolution
+	renderPsx             RenderPsx
+	renderFov             RenderFov
+	fovDegrees            float32
 	backBuffer            gl.Uint
 	backBufferTexture     gl.Uint
 	backBufferDepthBuffer gl.Uint
 
-	programGame        *ProgramGame
-	programPostEffect  *ProgramPostEffect
-	programPostEffects [NumRenderPostEffects]*ProgramPostEffect
+	programGame *ProgramGame
+
+	// The passes of the post effect chain draw into the targets, one less
+	// than there are passes, the last pass draws to the screen
+	postEffects       []PostEffectPreset
+	postEffect        string
+	postEffectPasses  []*ProgramPostEffect
+	postEffectTargets []renderTarget
+	postEffectWatch   *postEffectWatch
+}
+
+// renderTarget is a framebuffer drawing into a texture
+type renderTarget struct {
+	framebuffer gl.Uint
+	texture     gl.Uint
 }
 
 func NewRender() *Render {
 	r := &Render{}
 	r.trisLen = 0
 
-	r.atlasTexture = 0
+	r.trisPage = -1
 	r.renderBlendMode = RenderBlendModeNormal
 	r.renderNoTexture = 0
+	r.fovDegrees = RenderFovDefault
 
 	r.projectionMat2d = NewMat4Identity()
 	r.projectionMatbb = NewMat4Identity()
@@ -108,9 +237,6 @@ func NewRender() *Render {
 	r.spriteMat = NewMat4Identity()
 	r.viewMat = NewMat4Identity()
 
-	r.texturesLen = 0
-	r.textureMipMapIsDirty = false
-
 	r.backBuffer = 0
 	r.backBufferTexture = 0
 	r.backBufferDepthBuffer = 0
@@ -125,41 +251,28 @@ func (r *Render) Init(screenSize Vec2i) {
 		panic(err)
 	}
 
-	gl.GenTextures(1, &r.atlasTexture)
-	gl.BindTexture(gl.TEXTURE_2D, r.atlasTexture)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-	if RenderUseMipMaps {
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-	} else {
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	}
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-
-	// var anisotropy float32 = 0
-	// gl.GetFloatv(gl.MAX_TEXTURE_MAX_ANISTROPY_EXT, &anisotropy)
-	// gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAX_ANISOTROPY_EXT, anisotropy)
-
-	tw := gl.Sizei(AtlasSize * AtlasGrid)
-	th := gl.Sizei(AtlasSize * AtlasGrid)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, tw, th, 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
-	Logger.Printf("atlas texture %5d", r.atlasTexture)
-
 	// Tris buffer
 	gl.GenBuffers(1, &r.vbo)
 	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
 
-	// Post effect shaders
-	r.programPostEffects[RenderPostEffectNone] = ShaderPostEffectDefaultInit()
-	r.programPostEffects[RenderPostEffectCRT] = ShaderPostEffectCRTInit()
-	r.SetPostEffect(RenderPostEffectNone)
-
 	// Game shader
 	prgGame := ShaderGameInit()
 	r.programGame = prgGame
 	gl.UseProgram(prgGame.program)
 	gl.BindVertexArray(prgGame.vao)
 
+	// Post effect shaders
+	r.postEffectWatch = newPostEffectWatch(PostEffectDir)
+	r.loadPostEffects()
+	if err := r.SetPostEffect(PostEffectNone); err != nil {
+		// A user preset replacing none is broken, fall back to the built-ins
+		Logger.Printf("post effect: %s", err)
+		r.postEffects = postEffectBuiltins()
+		if err := r.SetPostEffect(PostEffectNone); err != nil {
+			panic(err)
+		}
+	}
+
 	r.SetView(Vec3{0, 0, 0}, Vec3{0, 0, 0})
 	r.SetModelMat(&Mat4Id)
 
@@ -185,7 +298,7 @@ func (r *Render) Init(screenSize Vec2i) {
 
 func (r *Render) Cleanup() {
 	// TODO see if this is needed
-	// gl.DeleteTextures(1, &r.atlasTexture)
+	// gl.DeleteTextures(gl.Sizei(len(r.atlasTextures)), &r.atlasTextures[0])
 	// gl.DeleteBuffers(1, &r.vbo)
 }
 
@@ -193,14 +306,29 @@ func (r *Render) SetScreenSize(size Vec2i) {
 	r.screenSize = size
 	r.projectionMatbb = r.Setup2dProjectionMat(size)
 
+	r.resizePostEffectTargets()
 	r.SetResolution(r.renderResolution)
 }
 
 func (r *Render) Size() Vec2i {
-	return r.backBufferSize
+	return r.viewportSize
+}
+
+func (r *Render) SafeArea() (Vec2i, Vec2i) {
+	return renderSafeArea(r.viewportSize)
 }
 
 func (r *Render) Setup2dProjectionMat(size Vec2i) Mat4 {
+	return renderProjection2d(size)
+}
+
+func (r *Render) Setup3dProjectionMat(size Vec2i) Mat4 {
+	return renderProjection3d(size, r.renderFov, r.fovDegrees)
+}
+
+// renderProjection2d maps pixel coordinates with the origin at the top left
+// to clip space
+func renderProjection2d(size Vec2i) Mat4 {
 	var near gl.Float = -1
 	var far gl.Float = 1
 	var left gl.Float = 0
@@ -220,10 +348,15 @@ func (r *Render) Setup2dProjectionMat(size Vec2i) Mat4 {
 	}
 }
 
-func (r *Render) Setup3dProjectionMat(size Vec2i) Mat4 {
+// renderProjection3d is the perspective projection of the game camera for
+// a viewport of size
+func renderProjection3d(size Vec2i, mode RenderFov, degrees float32) Mat4 {
 	aspect := float32(size.X) / float32(size.Y)
-	fov := (73.75 / 180.0) * math.Pi
-	f := float32(1.0 / math.Tan(fov*0.5))
+	halfTan := math.Tan(float64(degrees) / 360.0 * math.Pi)
+	if mode != RenderFovVertical {
+		halfTan *= 3.0 / 4.0
+	}
+	f := float32(1.0 / halfTan)
 	nf := float32(1.0 / (NearPlane - FarPlane))
 	return Mat4{
 		gl.Float(f / aspect), 0, 0, 0,
@@ -236,18 +369,8 @@ func (r *Render) Setup3dProjectionMat(size Vec2i) Mat4 {
 func (r *Render) SetResolution(res RenderResolution) {
 	r.renderResolution = res
 
-	if res == RenderResolutionNative {
-		r.backBufferSize = r.screenSize
-	} else {
-		aspect := float32(r.screenSize.X) / float32(r.screenSize.Y)
-		if res == RenderResolution240p {
-			r.backBufferSize = Vec2i{int32(aspect * 240), 240}
-		} else if res == RenderResolution480p {
-			r.backBufferSize = Vec2i{int32(aspect * 480), 480}
-		} else {
-			panic(fmt.Sprintf("invalid resolution %d", res))
-		}
-	}
+	r.backBufferSize = renderBackBufferSize(r.screenSize, res)
+	r.viewportPos, r.viewportSize = renderViewport(r.backBufferSize, r.renderFov)
 
 	if r.backBuffer == 0 {
 		gl.GenTextures(1, &r.backBufferTexture)
@@ -270,39 +393,172 @@ func (r *Render) SetResolution(res RenderResolution) {
 	gl.BindRenderbuffer(gl.RENDERBUFFER, r.backBufferDepthBuffer)
 	gl.RenderbufferStorage(gl.RENDERBUFFER, RenderDepthBufferInternalFormat, gl.Sizei(r.backBufferSize.X), gl.Sizei(r.backBufferSize.Y))
 
-	r.projectionMat2d = r.Setup2dProjectionMat(r.backBufferSize)
-	r.projectionMat3d = r.Setup3dProjectionMat(r.backBufferSize)
+	r.projectionMat2d = r.Setup2dProjectionMat(r.viewportSize)
+	r.projectionMat3d = r.Setup3dProjectionMat(r.viewportSize)
+
+	r.updateAtlasFilter()
+	r.setViewport()
+}
+
+func (r *Render) SetPsx(mode RenderPsx) {
+	r.renderPsx = mode
+	r.updateAtlasFilter()
+}
+
+func (r *Render) SetFov(mode RenderFov, degrees float32) {
+	r.renderFov = mode
+	r.fovDegrees = degrees
+	r.SetResolution(r.renderResolution)
+}
+
+func (r *Render) setViewport() {
+	gl.Viewport(gl.Int(r.viewportPos.X), gl.Int(r.viewportPos.Y), gl.Sizei(r.viewportSize.X), gl.Sizei(r.viewportSize.Y))
+}
 
-	// Use nearest filtering for 240p and 480p
-	gl.BindTexture(gl.TEXTURE_2D, r.atlasTexture)
-	if r.renderResolution == RenderResolutionNative {
-		if RenderUseMipMaps {
-			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+// renderViewport returns the area of the back buffer the scene is drawn to,
+// the largest 4:3 one in the middle for RenderFov4by3 and all of it
+// otherwise
+func renderViewport(backBufferSize Vec2i, mode RenderFov) (Vec2i, Vec2i) {
+	size := backBufferSize
+	if mode == RenderFov4by3 {
+		if size.X*3 > size.Y*4 {
+			size.X = size.Y * 4 / 3
 		} else {
-			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+			size.Y = size.X * 3 / 4
 		}
-	} else {
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 	}
-	gl.Viewport(0, 0, gl.Sizei(r.backBufferSize.X), gl.Sizei(r.backBufferSize.Y))
+	pos := Vec2i{(backBufferSize.X - size.X) / 2, (backBufferSize.Y - size.Y) / 2}
+	return pos, size
+}
+
+// renderSafeArea returns the area of a viewport of size the UI is anchored
+// to, no wider than RenderSafeAspect
+func renderSafeArea(size Vec2i) (Vec2i, Vec2i) {
+	safe := size
+	if float32(size.X) > float32(size.Y)*RenderSafeAspect {
+		safe.X = int32(float32(size.Y) * RenderSafeAspect)
+	}
+	return Vec2i{(size.X - safe.X) / 2, 0}, safe
 }
 
-func (r *Render) SetPostEffect(postEffect RenderPostEffect) error {
-	if postEffect > NumRenderPostEffects {
-		return fmt.Errorf("invalid post effect %d", postEffect)
+// renderBackBufferSize returns the size of the buffer the scene is drawn to
+// before it is scaled to the screen
+func renderBackBufferSize(screenSize Vec2i, res RenderResolution) Vec2i {
+	if res == RenderResolutionNative {
+		return screenSize
+	}
+
+	aspect := float32(screenSize.X) / float32(screenSize.Y)
+	if res == RenderResolution240p {
+		return Vec2i{int32(aspect * 240), 240}
+	} else if res == RenderResolution480p {
+		return Vec2i{int32(aspect * 480), 480}
+	}
+	panic(fmt.Sprintf("invalid resolution %d", res))
+}
+
+func (r *Render) SetPostEffect(name string) error {
+	i := postEffectFind(r.postEffects, name)
+	if i < 0 {
+		return fmt.Errorf("invalid post effect %q", name)
+	}
+
+	// Building programs binds them, the game program is bound again after
+	defer func() {
+		gl.UseProgram(r.programGame.program)
+		gl.BindVertexArray(r.programGame.vao)
+	}()
+
+	var passes []*ProgramPostEffect
+	for _, pass := range r.postEffects[i].Passes {
+		p, err := ShaderPostEffectInit(&pass)
+		if err != nil {
+			for _, p := range passes {
+				p.Delete()
+			}
+			return fmt.Errorf("post effect %s: %s: %w", name, pass.Path, err)
+		}
+		passes = append(passes, p)
+	}
+
+	for _, p := range r.postEffectPasses {
+		p.Delete()
 	}
-	r.programPostEffect = r.programPostEffects[postEffect]
+	r.postEffect = name
+	r.postEffectPasses = passes
+	r.resizePostEffectTargets()
 
 	return nil
 }
 
+func (r *Render) PostEffects() []string {
+	return postEffectNames(r.postEffects)
+}
+
+func (r *Render) loadPostEffects() {
+	presets, err := PostEffectPresets(PostEffectDir)
+	if err != nil {
+		Logger.Printf("post effects: %s", err)
+	}
+	r.postEffects = presets
+}
+
+// reloadPostEffects reads the presets again when their files changed and
+// rebuilds the current one. A broken preset keeps the passes it had.
+func (r *Render) reloadPostEffects() {
+	if !r.postEffectWatch.changed(time.Now()) {
+		return
+	}
+	r.loadPostEffects()
+	if err := r.SetPostEffect(r.postEffect); err != nil {
+		Logger.Printf("post effect reload: %s", err)
+	}
+}
+
+// resizePostEffectTargets keeps a screen sized target for every pass but
+// the last
+func (r *Render) resizePostEffectTargets() {
+	want := max(len(r.postEffectPasses)-1, 0)
+	for len(r.postEffectTargets) > want {
+		t := r.postEffectTargets[len(r.postEffectTargets)-1]
+		gl.DeleteFramebuffers(1, &t.framebuffer)
+		gl.DeleteTextures(1, &t.texture)
+		r.postEffectTargets = r.postEffectTargets[:len(r.postEffectTargets)-1]
+	}
+	for len(r.postEffectTargets) < want {
+		var t renderTarget
+		gl.GenFramebuffers(1, &t.framebuffer)
+		gl.GenTextures(1, &t.texture)
+		r.postEffectTargets = append(r.postEffectTargets, t)
+	}
+
+	for _, t := range r.postEffectTargets {
+		gl.BindTexture(gl.TEXTURE_2D, t.texture)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, gl.Sizei(r.screenSize.X), gl.Sizei(r.screenSize.Y), 0, gl.RGB, gl.UNSIGNED_BYTE, nil)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+		gl.BindFramebuffer(gl.FRAMEBUFFER, t.framebuffer)
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.texture, 0)
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.backBuffer)
+	r.bindPage(r.trisPage)
+}
+
 func (r *Render) FramePrepare() {
 	gl.UseProgram(r.programGame.program)
+	gl.BindVertexArray(r.programGame.vao)
 	gl.BindFramebuffer(gl.FRAMEBUFFER, r.backBuffer)
-	gl.Viewport(0, 0, gl.Sizei(r.backBufferSize.X), gl.Sizei(r.backBufferSize.Y))
+	r.setViewport()
 
-	gl.BindTexture(gl.TEXTURE_2D, r.atlasTexture)
+	r.trisPage = 0
+	r.bindPage(r.trisPage)
 	gl.Uniform2f(gl.Int(r.programGame.uniform.screen), 0, 0)
+	gl.Uniform1i(gl.Int(r.programGame.uniform.psx), gl.Int(min(r.renderPsx, 1)))
+	gl.Uniform2f(gl.Int(r.programGame.uniform.resolution), gl.Float(r.viewportSize.X), gl.Float(r.viewportSize.Y))
 	gl.Enable(gl.DEPTH_TEST)
 	gl.DepthMask(gl.TRUE)
 	gl.Disable(gl.POLYGON_OFFSET_FILL)
@@ -313,19 +569,48 @@ func (r *Render) FramePrepare() {
 
 func (r *Render) FrameEnd(cycleTime float64) {
 	r.Flush()
+	r.trisPage = -1
+	r.reloadPostEffects()
 
-	gl.UseProgram(r.programPostEffect.program)
-
-	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
-	gl.Viewport(0, 0, gl.Sizei(r.screenSize.X), gl.Sizei(r.screenSize.Y))
+	// Each pass reads the one before it, all of them can read the back
+	// buffer as original on the second texture unit
+	gl.ActiveTexture(gl.TEXTURE1)
 	gl.BindTexture(gl.TEXTURE_2D, r.backBufferTexture)
-	gl.UniformMatrix4fv(gl.Int(r.programPostEffect.uniform.projection), 1, gl.FALSE, (*gl.Float)(&r.projectionMatbb[0]))
-	gl.Uniform1f(gl.Int(r.programPostEffect.uniform.time), gl.Float(cycleTime))
-	gl.Uniform2f(gl.Int(r.programPostEffect.uniform.screenSize), gl.Float(r.screenSize.X), gl.Float(r.screenSize.Y))
+	gl.ActiveTexture(gl.TEXTURE0)
 
-	gl.ClearColor(0, 0, 0, 1)
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	input := r.backBufferTexture
+	for i, p := range r.postEffectPasses {
+		framebuffer := gl.Uint(0)
+		if i < len(r.postEffectTargets) {
+			framebuffer = r.postEffectTargets[i].framebuffer
+		}
+
+		gl.UseProgram(p.program)
+		gl.BindVertexArray(p.vao)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, framebuffer)
+		gl.Viewport(0, 0, gl.Sizei(r.screenSize.X), gl.Sizei(r.screenSize.Y))
+		gl.BindTexture(gl.TEXTURE_2D, input)
+		gl.UniformMatrix4fv(gl.Int(p.uniform.projection), 1, gl.FALSE, (*gl.Float)(&r.projectionMatbb[0]))
+		gl.Uniform1f(gl.Int(p.uniform.time), gl.Float(cycleTime))
+		gl.Uniform2f(gl.Int(p.uniform.screenSize), gl.Float(r.screenSize.X), gl.Float(r.screenSize.Y))
+		gl.Uniform1i(gl.Int(p.uniform.original), 1)
+		for j, location := range p.params {
+			gl.Uniform1f(location, gl.Float(p.values[j]))
+		}
 
+		gl.ClearColor(0, 0, 0, 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+		r.pushScreenQuad()
+		r.Flush()
+
+		if i < len(r.postEffectTargets) {
+			input = r.postEffectTargets[i].texture
+		}
+	}
+}
+
+// pushScreenQuad covers the screen with the texture bound to the first unit
+func (r *Render) pushScreenQuad() {
 	white := RGBA{128, 128, 128, 255}
 
 	trisBuffer[r.trisLen] = Tris{
@@ -344,8 +629,26 @@ func (r *Render) FrameEnd(cycleTime float64) {
 		},
 	}
 	r.trisLen++
-	r.Flush()
+}
+
+func (r *Render) Capture(source RenderCapture) (*image.RGBA, error) {
+	framebuffer, size := gl.Uint(0), r.screenSize
+	if source == RenderCaptureBackBuffer {
+		framebuffer, size = r.backBuffer, r.backBufferSize
+	} else if source != RenderCaptureScreen {
+		return nil, fmt.Errorf("invalid capture source %d", source)
+	}
 
+	img := image.NewRGBA(image.Rect(0, 0, int(size.X), int(size.Y)))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, framebuffer)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, gl.Sizei(size.X), gl.Sizei(size.Y), gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&img.Pix[0]))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+
+	// GL rows start at the bottom
+	ImageFlipY(img)
+
+	return img, nil
 }
 
 func (r *Render) Flush() {
@@ -353,9 +656,9 @@ func (r *Render) Flush() {
 		return
 	}
 
-	if r.textureMipMapIsDirty {
+	if r.trisPage >= 0 && r.atlasDirty[r.trisPage] {
 		gl.GenerateMipmap(gl.TEXTURE_2D)
-		r.textureMipMapIsDirty = false
+		r.atlasDirty[r.trisPage] = false
 	}
 
 	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
@@ -369,10 +672,7 @@ func (r *Render) SetView(pos Vec3, angles Vec3) {
 	r.SetDepthWrite(true)
 	r.SetDepthTest(true)
 
-	r.viewMat = NewMat4Identity()
-	Mat4SetTranslation(&r.viewMat, Vec3{0, 0, 0})
-	Mat4SetRollPitchYaw(&r.viewMat, Vec3{angles.X, -angles.Y + math.Pi, angles.Z + math.Pi})
-	Mat4Translate(&r.viewMat, Vec3Inv(pos))
+	r.viewMat = renderViewMat(pos, angles)
 	Mat4SetYawPitchRoll(&r.spriteMat, Vec3{-angles.X, angles.Y - math.Pi, 0})
 
 	r.SetModelMat(&Mat4Id)
@@ -383,6 +683,17 @@ func (r *Render) SetView(pos Vec3, angles Vec3) {
 	gl.Uniform2f(gl.Int(r.programGame.uniform.fade), gl.Float(RenderFadeOutNear), gl.Float(RenderFadeOutFar))
 }
 
+// renderViewMat returns the view matrix of a camera at pos looking along
+// angles
+func renderViewMat(pos Vec3, angles Vec3) Mat4 {
+	m := NewMat4Identity()
+	Mat4SetTranslation(&m, Vec3{0, 0, 0})
+	Mat4SetRollPitchYaw(&m, Vec3{angles.X, -angles.Y + math.Pi, angles.Z + math.Pi})
+	Mat4Translate(&m, Vec3Inv(pos))
+
+	return m
+}
+
 func (r *Render) SetModelMat(m *Mat4) {
 	r.Flush()
 
@@ -457,16 +768,16 @@ func (r *Render) Transform(pos Vec3) Vec3 {
 }
 
 func (r *Render) PushTris(tris Tris, textureIndex int) error {
-	if textureIndex >= r.texturesLen {
-		return fmt.Errorf("invalid texture index %d", textureIndex)
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return err
 	}
-
-	if r.trisLen >= RenderTrisBufferCapacity {
+	if t.page != r.trisPage || r.trisLen >= RenderTrisBufferCapacity {
 		r.Flush()
+		r.trisPage = t.page
+		r.bindPage(r.trisPage)
 	}
 
-	t := &r.textures[textureIndex]
-
 	for i := 0; i < 3; i++ {
 		tris.Vertices[i].UV.X += gl.Float(t.offset.X)
 		tris.Vertices[i].UV.Y += gl.Float(t.offset.Y)
@@ -478,32 +789,14 @@ func (r *Render) PushTris(tris Tris, textureIndex int) error {
 }
 
 func (r *Render) PushSprite(pos Vec3, size Vec2i, color RGBA, textureIndex int) error {
-	if textureIndex >= r.texturesLen {
-		return fmt.Errorf("invalid texture index %d", textureIndex)
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return err
 	}
 
-	p1 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(-size.X) * 0.5, gl.Float(-size.Y) * 0.5, 0}, &(r.spriteMat)))
-	p2 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(size.X) * 0.5, gl.Float(-size.Y) * 0.5, 0}, &(r.spriteMat)))
-	p3 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(-size.X) * 0.5, gl.Float(size.Y) * 0.5, 0}, &(r.spriteMat)))
-	p4 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(size.X) * 0.5, gl.Float(size.Y) * 0.5, 0}, &(r.spriteMat)))
-
-	t := &r.textures[textureIndex]
-
-	r.PushTris(Tris{
-		Vertices: [3]Vertex{
-			Vertex{Pos: p1, UV: Vec2{0, 0}, Color: color},
-			Vertex{Pos: p2, UV: Vec2{gl.Float(0 + t.size.X), 0}, Color: color},
-			Vertex{Pos: p3, UV: Vec2{0, gl.Float(0 + t.size.Y)}, Color: color},
-		},
-	}, textureIndex)
-
-	r.PushTris(Tris{
-		Vertices: [3]Vertex{
-			Vertex{Pos: p3, UV: Vec2{0, gl.Float(0 + t.size.Y)}, Color: color},
-			Vertex{Pos: p2, UV: Vec2{gl.Float(0 + t.size.X), 0}, Color: color},
-			Vertex{Pos: p4, UV: Vec2{gl.Float(0 + t.size.X), gl.Float(0 + t.size.Y)}, Color: color},
-		},
-	}, textureIndex)
+	for _, tris := range renderSpriteTris(pos, size, color, t.size, &r.spriteMat) {
+		r.PushTris(tris, textureIndex)
+	}
 
 	return nil
 }
@@ -519,212 +812,213 @@ func (r *Render) Push2d(pos Vec2i, size Vec2i, color RGBA, textureIndex int) err
 }
 
 func (r *Render) Push2dTile(pos Vec2i, uvOffset Vec2i, uvSize Vec2i, size Vec2i, color RGBA, textureIndex int) error {
-	if textureIndex >= r.texturesLen {
-		return fmt.Errorf("invalid texture index %d", textureIndex)
+	if _, err := r.textures.get(textureIndex); err != nil {
+		return err
 	}
 
-	r.PushTris(Tris{
-		Vertices: [3]Vertex{
-			{
-				Pos: Vec3{gl.Float(pos.X), gl.Float(pos.Y)+ gl.Float(size.Y), 0}, 
-			 	UV: Vec2{gl.Float(uvOffset.X), gl.Float(uvOffset.Y) + gl.Float(uvSize.Y)}, 
-				Color: color },
-			{
-				Pos: Vec3{gl.Float(pos.X + size.X), gl.Float(pos.Y), 0}, 
-				UV: Vec2{gl.Float(uvOffset.X + uvSize.X), gl.Float(uvOffset.Y)}, 
-				Color: color},
-			{
-				Pos: Vec3{gl.Float(pos.X), gl.Float(pos.Y), 0}, 
-				UV: Vec2{gl.Float(uvOffset.X), gl.Float(uvOffset.Y)}, 
-				Color: color},
-		}}, textureIndex)
-
-	r.PushTris(Tris{
-		Vertices: [3]Vertex{
-			{
-				Pos: Vec3{gl.Float(pos.X) + gl.Float(size.X), gl.Float(pos.Y) + gl.Float(size.Y), 0}, 
-				UV: Vec2{gl.Float(uvOffset.X) + gl.Float(uvSize.X), gl.Float(uvOffset.Y) + gl.Float(uvSize.Y)}, 
-				Color: color},
-			{
-				Pos: Vec3{gl.Float(pos.X + uvSize.X), gl.Float(pos.Y), 0}, 
-				UV: Vec2{gl.Float(uvOffset.X + uvSize.X), gl.Float(uvOffset.Y)}, 
-				Color: color},
-			{
-				Pos: Vec3{gl.Float(pos.X), gl.Float(pos.Y + size.Y), 0}, 
-				UV: Vec2{gl.Float(uvOffset.X), gl.Float(uvOffset.Y) + gl.Float(uvSize.Y)}, 
-				Color: color},
-		}}, textureIndex)
+	for _, tris := range render2dTileTris(pos, uvOffset, uvSize, size, color) {
+		r.PushTris(tris, textureIndex)
+	}
 
 	return nil
 }
 
-func (r *Render) TextureCreate(tw int, th int, pixels []RGBA) (int, error) {
-	if r.texturesLen >= TextureMax {
-		return 0, fmt.Errorf("texture max reached, wanted %d", r.texturesLen)
-	}
-
-	bw := tw + AtlasBorder*2
-	bh := th + AtlasBorder*2
-
-	// Find a spot in the atlas for this texture with added border
-	gridWidth := (bw + AtlasGrid - 1) / AtlasGrid
-	gridHeight := (bh + AtlasGrid - 1) / AtlasGrid
-	gridX := 0
-	gridY := AtlasSize - gridHeight + 1
-	for cx := 0; cx < AtlasSize-gridWidth; cx++ {
-		if r.atlasMap[cx] >= uint32(gridY) {
-			continue
-		}
-		cy := r.atlasMap[cx]
-		isBest := true
-
-		for bx := cx; bx < cx+gridWidth; bx++ {
-			if r.atlasMap[bx] >= uint32(gridY) {
-				isBest = false
-				cx = bx
-				break
-			}
-			if r.atlasMap[bx] > cy {
-				cy = r.atlasMap[bx]
-			}
-		}
-		if isBest {
-			gridX = cx
-			gridY = int(cy)
-		}
+// renderSpriteTris returns the two triangles of a sprite of size facing the
+// camera, textured with a texture of textureSize
+func renderSpriteTris(pos Vec3, size Vec2i, color RGBA, textureSize Vec2i, spriteMat *Mat4) [2]Tris {
+	p1 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(-size.X) * 0.5, gl.Float(-size.Y) * 0.5, 0}, spriteMat))
+	p2 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(size.X) * 0.5, gl.Float(-size.Y) * 0.5, 0}, spriteMat))
+	p3 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(-size.X) * 0.5, gl.Float(size.Y) * 0.5, 0}, spriteMat))
+	p4 := Vec3Add(pos, Vec3Transform(Vec3{gl.Float(size.X) * 0.5, gl.Float(size.Y) * 0.5, 0}, spriteMat))
+	tw := gl.Float(textureSize.X)
+	th := gl.Float(textureSize.Y)
+
+	return [2]Tris{
+		{Vertices: [3]Vertex{
+			{Pos: p1, UV: Vec2{0, 0}, Color: color},
+			{Pos: p2, UV: Vec2{tw, 0}, Color: color},
+			{Pos: p3, UV: Vec2{0, th}, Color: color},
+		}},
+		{Vertices: [3]Vertex{
+			{Pos: p3, UV: Vec2{0, th}, Color: color},
+			{Pos: p2, UV: Vec2{tw, 0}, Color: color},
+			{Pos: p4, UV: Vec2{tw, th}, Color: color},
+		}},
 	}
+}
 
-	if gridY+gridHeight > AtlasSize {
-		return 0, fmt.Errorf("render atlas full")
+// render2dTileTris returns the two triangles of a screen space rectangle
+// showing the uvSize area at uvOffset of a texture
+func render2dTileTris(pos Vec2i, uvOffset Vec2i, uvSize Vec2i, size Vec2i, color RGBA) [2]Tris {
+	x0, y0 := gl.Float(pos.X), gl.Float(pos.Y)
+	x1, y1 := gl.Float(pos.X+size.X), gl.Float(pos.Y+size.Y)
+	u0, v0 := gl.Float(uvOffset.X), gl.Float(uvOffset.Y)
+	u1, v1 := gl.Float(uvOffset.X+uvSize.X), gl.Float(uvOffset.Y+uvSize.Y)
+
+	return [2]Tris{
+		{Vertices: [3]Vertex{
+			{Pos: Vec3{x0, y1, 0}, UV: Vec2{u0, v1}, Color: color},
+			{Pos: Vec3{x1, y0, 0}, UV: Vec2{u1, v0}, Color: color},
+			{Pos: Vec3{x0, y0, 0}, UV: Vec2{u0, v0}, Color: color},
+		}},
+		{Vertices: [3]Vertex{
+			{Pos: Vec3{x1, y1, 0}, UV: Vec2{u1, v1}, Color: color},
+			{Pos: Vec3{x1, y0, 0}, UV: Vec2{u1, v0}, Color: color},
+			{Pos: Vec3{x0, y1, 0}, UV: Vec2{u0, v1}, Color: color},
+		}},
 	}
+}
 
-	for cx := gridX; cx < gridX+gridWidth; cx++ {
-		r.atlasMap[cx] = uint32(gridY + gridHeight)
+func (r *Render) TextureCreate(tw int, th int, pixels []RGBA) (int, error) {
+	bw := tw + AtlasBorder*2
+	bh := th + AtlasBorder*2
+	page, x, y, err := atlasAlloc(&r.atlasMaps, bw, bh)
+	if err != nil {
+		return 0, err
 	}
+	pb := atlasBorder(tw, th, pixels)
 
-	// Add border pixels for this texture
-	pb := make([]RGBA, bw*bh)
-
-	if tw > 0 && th > 0 {
-		// Top border
-		for y := 0; y < AtlasBorder; y++ {
-			copy(pb[(y*bw+AtlasBorder):(y*bw+AtlasBorder+tw)], pixels[:tw])
-			
-		}
-
-		// Bottom border
-		for y := 0; y < AtlasBorder; y++ {
-			copy(pb[((bh-AtlasBorder+y)*bw+AtlasBorder):((bh-AtlasBorder+y)*bw+AtlasBorder+tw)], pixels[(th-1)*tw:th*tw])
-		}
-
-		// Left border
-		for y := 0; y < bh; y++ {
-			for x := 0; x < AtlasBorder; x++ {
-				pb[y*bw+x] = pixels[Clamp(y-AtlasBorder, 0, th-1)*tw]
-			}
-		}
-		// Right Border
-		for y := 0; y < bh; y++ {
-			for x := 0; x < AtlasBorder; x++ {
-				pb[y*bw+bw-AtlasBorder+x] = pixels[Clamp(y-AtlasBorder, 0, th-1)*tw+tw-1]
-			}
-		}
+	r.bindPage(page)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, gl.Int(x), gl.Int(y), gl.Sizei(bw), gl.Sizei(bh), gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&pb[0]))
+	r.bindPage(r.trisPage)
 
-		// Texture
-		for y := 0; y < th; y++ {
-			copy(pb[(y+AtlasBorder)*bw+AtlasBorder:(y+AtlasBorder)*bw+AtlasBorder+tw], pixels[y*tw:(y+1)*tw])
-		}
+	r.atlasDirty[page] = RenderUseMipMaps
 
-		// Right border
-		for y := 0; y < bh; y++ {
-			for x := 0; x < AtlasBorder; x++ {
-				pb[y*bw+(bw-AtlasBorder+x)] = pixels[Clamp(y-AtlasBorder, 0, th-1)*tw+tw-1]
-			}
-		}
+	return r.textures.add(RenderTexture{
+		page:   page,
+		offset: Vec2i{int32(x + AtlasBorder), int32(y + AtlasBorder)},
+		size:   Vec2i{int32(tw), int32(th)},
+	})
+}
 
-		
+// bindPage binds the texture of an atlas page, creating it on first use
+func (r *Render) bindPage(page int) {
+	if page < 0 {
+		return
 	}
+	for len(r.atlasTextures) <= page {
+		var texture gl.Uint
+		gl.GenTextures(1, &texture)
+		gl.BindTexture(gl.TEXTURE_2D, texture)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, r.atlasMinFilter())
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+		// var anisotropy float32 = 0
+		// gl.GetFloatv(gl.MAX_TEXTURE_MAX_ANISTROPY_EXT, &anisotropy)
+		// gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAX_ANISOTROPY_EXT, anisotropy)
+
+		size := gl.Sizei(AtlasSize * AtlasGrid)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, size, size, 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+		Logger.Printf("atlas page %d texture %5d", len(r.atlasTextures), texture)
+
+		r.atlasTextures = append(r.atlasTextures, texture)
+		r.atlasDirty = append(r.atlasDirty, false)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, r.atlasTextures[page])
+}
 
-	x := gridX * AtlasGrid
-	y := gridY * AtlasGrid
-	gl.BindTexture(gl.TEXTURE_2D, r.atlasTexture)
-	gl.TexSubImage2D(gl.TEXTURE_2D, 0, gl.Int(x), gl.Int(y), gl.Sizei(bw), gl.Sizei(bh), gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&pb[0]))
-
-	r.textureMipMapIsDirty = RenderUseMipMaps
-	textureIndex := r.texturesLen
-	r.texturesLen++
-	r.textures[textureIndex] = RenderTexture{
-		Vec2i{int32(x + AtlasBorder), int32(y + AtlasBorder)},
-		Vec2i{int32(tw), int32(th)},
+// updateAtlasFilter applies atlasMinFilter to the pages created so far
+func (r *Render) updateAtlasFilter() {
+	for _, texture := range r.atlasTextures {
+		gl.BindTexture(gl.TEXTURE_2D, texture)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, r.atlasMinFilter())
 	}
+	r.bindPage(r.trisPage)
+}
 
-	return textureIndex, nil
+// atlasMinFilter returns the minification filter of the atlas pages:
+// nearest for 240p and 480p and for RenderPsxNearest
+func (r *Render) atlasMinFilter() gl.Int {
+	if r.renderResolution != RenderResolutionNative || r.renderPsx == RenderPsxNearest {
+		return gl.NEAREST
+	}
+	if RenderUseMipMaps {
+		return gl.LINEAR_MIPMAP_LINEAR
+	}
+	return gl.LINEAR
 }
 
 func (r *Render) TextureSize(textureIndex int) (Vec2i, error) {
-	if textureIndex >= r.texturesLen {
-		return Vec2i{}, fmt.Errorf("invalid texture index %d", textureIndex)
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return Vec2i{}, err
 	}
 
-	return r.textures[textureIndex].size, nil
+	return t.size, nil
 }
 
 func (r *Render) TextureReplacePixels(textureIndex uint16, pixels []RGBA) error {
-	if textureIndex >= uint16(r.texturesLen) {
-		return fmt.Errorf("invalid texture index %d", textureIndex)
+	t, err := r.textures.get(int(textureIndex))
+	if err != nil {
+		return err
 	}
 
-	t := &r.textures[textureIndex]
-	gl.BindTexture(gl.TEXTURE_2D, r.atlasTexture)
+	r.bindPage(t.page)
 	gl.TexSubImage2D(gl.TEXTURE_2D, 0, gl.Int(t.offset.X), gl.Int(t.offset.Y), gl.Sizei(t.size.X), gl.Sizei(t.size.Y), gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&pixels[0]))
+	r.bindPage(r.trisPage)
+	r.atlasDirty[t.page] = RenderUseMipMaps
 
 	return nil
 }
 
-func (r *Render) TexturesLen() int {
-	return r.texturesLen
+func (r *Render) TextureRetain(textureIndex int) error {
+	return r.textures.retain(textureIndex)
 }
 
-func (r *Render) TexturesReset(len uint16) error {
-	if len > uint16(r.texturesLen) {
-		return fmt.Errorf("invalid texture reset len %d >= %d", len, r.texturesLen)
+// TextureRelease drops an owner of a texture. The white texture lives as
+// long as the renderer.
+func (r *Render) TextureRelease(textureIndex int) error {
+	if textureIndex == r.NoTexture() {
+		return nil
 	}
-
-	r.texturesLen = int(len)
-	for i, _ := range r.atlasMap {
-		r.atlasMap[i] = 0
+	t, err := r.textures.release(textureIndex)
+	if t != nil {
+		atlasFree(r.atlasMaps, t)
 	}
+	return err
+}
 
-	// Clear complete atlas and recreate the default white texture
-	if len == 0 {
-		whitePixels := []RGBA{
-			RGBA{128, 128, 128, 255}, RGBA{128, 128, 128, 255},
-			RGBA{128, 128, 128, 255}, RGBA{128, 128, 128, 255},
-		}
-		t, err := r.TextureCreate(2, 2, whitePixels)
-
-		r.renderNoTexture = uint16(t)
+// TexturesDefrag reads the atlas pages back, packs the live textures anew
+// and uploads the result
+func (r *Render) TexturesDefrag() error {
+	r.Flush()
 
-		if err != nil {
-			return err
-		}
-		return nil
+	size := gl.Sizei(atlasPixels)
+	pixels := make([][]RGBA, len(r.atlasMaps))
+	for page := range pixels {
+		pixels[page] = make([]RGBA, atlasPixels*atlasPixels)
+		r.bindPage(page)
+		gl.GetTexImage(gl.TEXTURE_2D, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&pixels[page][0]))
 	}
 
-	// Replay all textures grid insertions up to the reset len
-	for i := 0; i < r.texturesLen; i++ {
-		gridX := (r.textures[i].offset.X - AtlasBorder) / AtlasGrid
-		gridY := (r.textures[i].offset.Y - AtlasBorder) / AtlasGrid
-		gridWidth := (r.textures[i].size.X + AtlasBorder*2 + AtlasGrid - 1) / AtlasGrid
-		gridHeight := (r.textures[i].size.Y + AtlasBorder*2 + AtlasGrid - 1) / AtlasGrid
-		for cx := gridX; cx < gridX+gridWidth; cx++ {
-			r.atlasMap[cx] = uint32(gridY + gridHeight)
-		}
+	pages, moved, err := atlasDefrag(r.textures.textures, pixels)
+	if err != nil {
+		r.bindPage(r.trisPage)
+		return err
 	}
+	r.atlasMaps = pages
+	for page := range moved {
+		r.bindPage(page)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, size, size, gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&moved[page][0]))
+		r.atlasDirty[page] = RenderUseMipMaps
+	}
+	r.bindPage(r.trisPage)
 
 	return nil
 }
 
+// NoTexture returns the index of the plain white texture used for
+// untextured primitives
+func (r *Render) NoTexture() int {
+	return int(r.renderNoTexture)
+}
+
+func (r *Render) TexturesLen() int {
+	return r.textures.len()
+}
+
 func (r *Render) TexturesDump(path string) error {
 
 	// Get current displayed image on screen via OpenGL
@@ -734,6 +1028,7 @@ func (r *Render) TexturesDump(path string) error {
 	width := AtlasSize * AtlasGrid
 	height := AtlasSize * AtlasGrid
 	pixels := make([]RGBA, width*height)
+	r.bindPage(0)
 	gl.GetTexImage(gl.TEXTURE_2D, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&pixels[0]))
 
 	surface, err := sdl.CreateRGBSurfaceFrom(unsafe.Pointer(&pixels[0]), int32(width), int32(height), 32, int(width*4),
@@ -0,0 +1,621 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// RenderSoftware draws like Render, but with the CPU into memory. It follows
+// the GL pipeline of Render: texture atlas pages, the same transforms and
+// distance fade in the vertex stage and the texture × color × 2 modulation
+// of the fragment shader. Textures are sampled nearest without mipmaps and
+// post effects other than none are not emulated.
+type RenderSoftware struct {
+	screenSize     Vec2i
+	backBufferSize Vec2i
+	resolution     RenderResolution
+	postEffect     string
+	psx            RenderPsx
+	fov            RenderFov
+	fovDegrees     float32
+	viewportPos    Vec2i
+	viewportSize   Vec2i
+
+	atlas     [][]RGBA
+	atlasMaps []atlasPage
+	textures  textureTable
+	noTexture int
+	// page is the atlas page of the tris being drawn
+	page []RGBA
+
+	projectionMat2d Mat4
+	projectionMat3d Mat4
+	spriteMat       Mat4
+	viewMat         Mat4
+	modelMat        Mat4
+	mvp             Mat4
+	is2d            bool
+	cameraPos       Vec3
+	screenX         float32
+	screenY         float32
+
+	depthWrite   bool
+	depthTest    bool
+	depthOffset  float32
+	cullBackface bool
+	blendMode    RenderBlendMode
+
+	backBuffer []RGBA
+	depth      []float32
+	screen     []RGBA
+}
+
+// swVertex is a vertex in clip space with normalized color
+type swVertex struct {
+	x, y, z, w float32
+	u, v       float32
+	r, g, b, a float32
+}
+
+// swScreenVertex is a vertex in back buffer pixels
+type swScreenVertex struct {
+	x, y, z, invW float32
+}
+
+func NewRenderSoftware() *RenderSoftware {
+	return &RenderSoftware{
+		projectionMat2d: NewMat4Identity(),
+		projectionMat3d: NewMat4Identity(),
+		spriteMat:       NewMat4Identity(),
+		viewMat:         NewMat4Identity(),
+		modelMat:        NewMat4Identity(),
+		fovDegrees:      RenderFovDefault,
+	}
+}
+
+func (r *RenderSoftware) Init(screenSize Vec2i) {
+	r.cullBackface = true
+	r.blendMode = RenderBlendModeNormal
+
+	r.resolution = RenderResolutionNative
+	r.SetScreenSize(screenSize)
+	r.SetView(Vec3{}, Vec3{})
+
+	// Create default white texture
+	white := []RGBA{
+		{128, 128, 128, 255}, {128, 128, 128, 255},
+		{128, 128, 128, 255}, {128, 128, 128, 255},
+	}
+	t, err := r.TextureCreate(2, 2, white)
+	if err != nil {
+		panic(err)
+	}
+	r.noTexture = t
+}
+
+func (r *RenderSoftware) Cleanup() {
+}
+
+func (r *RenderSoftware) SetScreenSize(size Vec2i) {
+	r.screenSize = size
+	r.screen = make([]RGBA, size.X*size.Y)
+	r.SetResolution(r.resolution)
+}
+
+func (r *RenderSoftware) Size() Vec2i {
+	return r.viewportSize
+}
+
+func (r *RenderSoftware) SafeArea() (Vec2i, Vec2i) {
+	return renderSafeArea(r.viewportSize)
+}
+
+func (r *RenderSoftware) SetResolution(res RenderResolution) {
+	r.resolution = res
+	r.backBufferSize = renderBackBufferSize(r.screenSize, res)
+	r.backBuffer = make([]RGBA, r.backBufferSize.X*r.backBufferSize.Y)
+	r.depth = make([]float32, len(r.backBuffer))
+	r.viewportPos, r.viewportSize = renderViewport(r.backBufferSize, r.fov)
+
+	r.projectionMat2d = renderProjection2d(r.viewportSize)
+	r.projectionMat3d = renderProjection3d(r.viewportSize, r.fov, r.fovDegrees)
+	r.updateMvp()
+}
+
+func (r *RenderSoftware) SetFov(mode RenderFov, degrees float32) {
+	r.fov = mode
+	r.fovDegrees = degrees
+	r.SetResolution(r.resolution)
+}
+
+// SetPsx imitates the PlayStation like the game shader does. Textures are
+// always sampled without filtering here.
+func (r *RenderSoftware) SetPsx(mode RenderPsx) {
+	r.psx = mode
+}
+
+// SetPostEffect accepts the built-in presets. No shaders run here, the
+// frame is shown as drawn.
+func (r *RenderSoftware) SetPostEffect(name string) error {
+	if postEffectFind(postEffectBuiltins(), name) < 0 {
+		return fmt.Errorf("invalid post effect %q", name)
+	}
+	r.postEffect = name
+
+	return nil
+}
+
+func (r *RenderSoftware) PostEffects() []string {
+	return postEffectNames(postEffectBuiltins())
+}
+
+func (r *RenderSoftware) FramePrepare() {
+	r.screenX, r.screenY = 0, 0
+	r.depthTest = true
+	r.depthWrite = true
+	r.depthOffset = 0
+	for i := range r.backBuffer {
+		r.backBuffer[i] = RGBA{0, 0, 0, 255}
+		r.depth[i] = 1
+	}
+}
+
+// FrameEnd scales the back buffer to the screen
+func (r *RenderSoftware) FrameEnd(cycleTime float64) {
+	sw, sh := int(r.screenSize.X), int(r.screenSize.Y)
+	bw, bh := int(r.backBufferSize.X), int(r.backBufferSize.Y)
+	if bw == 0 || bh == 0 {
+		return
+	}
+	for y := 0; y < sh; y++ {
+		by := y * bh / sh
+		for x := 0; x < sw; x++ {
+			r.screen[y*sw+x] = r.backBuffer[by*bw+x*bw/sw]
+		}
+	}
+}
+
+// BackBuffer returns a copy of the back buffer as drawn so far
+func (r *RenderSoftware) BackBuffer() *image.RGBA {
+	return swImage(r.backBuffer, r.backBufferSize)
+}
+
+// Screen returns a copy of the last finished frame at screen size
+func (r *RenderSoftware) Screen() *image.RGBA {
+	return swImage(r.screen, r.screenSize)
+}
+
+func (r *RenderSoftware) Capture(source RenderCapture) (*image.RGBA, error) {
+	switch source {
+	case RenderCaptureScreen:
+		return r.Screen(), nil
+	case RenderCaptureBackBuffer:
+		return r.BackBuffer(), nil
+	}
+	return nil, fmt.Errorf("invalid capture source %d", source)
+}
+
+func swImage(pixels []RGBA, size Vec2i) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, int(size.X), int(size.Y)))
+	for i, c := range pixels {
+		copy(img.Pix[i*4:i*4+4], []byte{c.R, c.G, c.B, c.A})
+	}
+	return img
+}
+
+func (r *RenderSoftware) SetView(pos Vec3, angles Vec3) {
+	r.SetDepthWrite(true)
+	r.SetDepthTest(true)
+
+	r.viewMat = renderViewMat(pos, angles)
+	Mat4SetYawPitchRoll(&r.spriteMat, Vec3{-angles.X, angles.Y - math.Pi, 0})
+	r.cameraPos = pos
+	r.is2d = false
+
+	r.SetModelMat(&Mat4Id)
+}
+
+func (r *RenderSoftware) SetView2d() {
+	r.SetDepthWrite(true)
+	r.SetDepthTest(false)
+
+	r.cameraPos = Vec3{}
+	r.is2d = true
+	r.SetModelMat(&Mat4Id)
+}
+
+func (r *RenderSoftware) SetModelMat(m *Mat4) {
+	r.modelMat = *m
+	r.updateMvp()
+}
+
+// updateMvp combines projection, view and model like the vertex shader
+func (r *RenderSoftware) updateMvp() {
+	projection, view := &r.projectionMat3d, &r.viewMat
+	if r.is2d {
+		projection, view = &r.projectionMat2d, &Mat4Id
+	}
+	var pv Mat4
+	Mat4Mul(&pv, projection, view)
+	Mat4Mul(&r.mvp, &pv, &r.modelMat)
+}
+
+func (r *RenderSoftware) SetDepthWrite(enable bool) {
+	r.depthWrite = enable
+}
+
+func (r *RenderSoftware) SetDepthTest(enable bool) {
+	r.depthTest = enable
+}
+
+func (r *RenderSoftware) SetDepthOffset(offset float32) {
+	r.depthOffset = offset
+}
+
+func (r *RenderSoftware) SetScreenPosition(pos Vec2i) {
+	r.screenX, r.screenY = float32(pos.X), -float32(pos.Y)
+}
+
+func (r *RenderSoftware) SetBlendMode(newMode RenderBlendMode) {
+	r.blendMode = newMode
+}
+
+func (r *RenderSoftware) SetCullBackface(enable bool) {
+	r.cullBackface = enable
+}
+
+func (r *RenderSoftware) PushTris(tris Tris, textureIndex int) error {
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return err
+	}
+
+	r.page = r.atlas[t.page]
+	var vs [3]swVertex
+	for i, v := range tris.Vertices {
+		vs[i] = r.transform(v, t.offset)
+	}
+	r.drawClipped(vs)
+
+	return nil
+}
+
+func (r *RenderSoftware) PushSprite(pos Vec3, size Vec2i, color RGBA, textureIndex int) error {
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return err
+	}
+
+	for _, tris := range renderSpriteTris(pos, size, color, t.size, &r.spriteMat) {
+		r.PushTris(tris, textureIndex)
+	}
+
+	return nil
+}
+
+func (r *RenderSoftware) Push2d(pos Vec2i, size Vec2i, color RGBA, textureIndex int) error {
+	ts, err := r.TextureSize(textureIndex)
+	if err != nil {
+		return err
+	}
+
+	return r.Push2dTile(pos, Vec2i{0, 0}, ts, size, color, textureIndex)
+}
+
+func (r *RenderSoftware) Push2dTile(pos Vec2i, uvOffset Vec2i, uvSize Vec2i, size Vec2i, color RGBA, textureIndex int) error {
+	if _, err := r.textures.get(textureIndex); err != nil {
+		return err
+	}
+
+	for _, tris := range render2dTileTris(pos, uvOffset, uvSize, size, color) {
+		r.PushTris(tris, textureIndex)
+	}
+
+	return nil
+}
+
+// transform is the vertex shader: clip space position, distance fade and
+// atlas coordinates
+func (r *RenderSoftware) transform(v Vertex, offset Vec2i) swVertex {
+	m := &r.mvp
+	p := v.Pos
+	out := swVertex{
+		x: float32(m[0]*p.X + m[4]*p.Y + m[8]*p.Z + m[12]),
+		y: float32(m[1]*p.X + m[5]*p.Y + m[9]*p.Z + m[13]),
+		z: float32(m[2]*p.X + m[6]*p.Y + m[10]*p.Z + m[14]),
+		w: float32(m[3]*p.X + m[7]*p.Y + m[11]*p.Z + m[15]),
+		u: float32(v.UV.X) + float32(offset.X),
+		v: float32(v.UV.Y) + float32(offset.Y),
+		r: float32(v.Color.R) / 255,
+		g: float32(v.Color.G) / 255,
+		b: float32(v.Color.B) / 255,
+		a: float32(v.Color.A) / 255,
+	}
+	out.x += r.screenX * out.w
+	out.y += r.screenY * out.w
+
+	world := Vec3Transform(p, &r.modelMat)
+	distance := float64(Vec3Len(Vec3Sub(r.cameraPos, world)))
+	out.a *= float32(smoothstep(RenderFadeOutFar, RenderFadeOutNear, distance))
+
+	return out
+}
+
+func smoothstep(edge0, edge1, x float64) float64 {
+	t := Clamp((x-edge0)/(edge1-edge0), 0, 1)
+	return t * t * (3 - 2*t)
+}
+
+// drawClipped clips the triangle against the near plane and draws what is
+// left as a fan
+func (r *RenderSoftware) drawClipped(vs [3]swVertex) {
+	var poly [4]swVertex
+	n := 0
+	for i := range vs {
+		a, b := vs[i], vs[(i+1)%3]
+		da, db := a.z+a.w, b.z+b.w
+		if da >= 0 {
+			poly[n] = a
+			n++
+		}
+		if (da >= 0) != (db >= 0) {
+			poly[n] = swLerp(a, b, da/(da-db))
+			n++
+		}
+	}
+
+	for i := 2; i < n; i++ {
+		r.rasterize(poly[0], poly[i-1], poly[i])
+	}
+}
+
+func swLerp(a, b swVertex, t float32) swVertex {
+	l := func(x, y float32) float32 { return x + (y-x)*t }
+	return swVertex{
+		l(a.x, b.x), l(a.y, b.y), l(a.z, b.z), l(a.w, b.w),
+		l(a.u, b.u), l(a.v, b.v),
+		l(a.r, b.r), l(a.g, b.g), l(a.b, b.b), l(a.a, b.a),
+	}
+}
+
+// swEdge is the edge function of a to b at p, positive on the inside of a
+// triangle with positive area
+func swEdge(a, b swScreenVertex, px, py float32) float32 {
+	return (b.x-a.x)*(py-a.y) - (b.y-a.y)*(px-a.x)
+}
+
+// swTopLeft reports whether a pixel center exactly on the edge a to b is
+// drawn, so shared edges are drawn once
+func swTopLeft(a, b swScreenVertex) bool {
+	return (a.y == b.y && b.x > a.x) || b.y < a.y
+}
+
+func (r *RenderSoftware) rasterize(v0, v1, v2 swVertex) {
+	w, h := float32(r.viewportSize.X), float32(r.viewportSize.Y)
+	ox, oy := float32(r.viewportPos.X), float32(r.viewportPos.Y)
+	vs := [3]swVertex{v0, v1, v2}
+	var s [3]swScreenVertex
+	for i, v := range vs {
+		invW := 1 / v.w
+		s[i] = swScreenVertex{
+			x:    ox + (v.x*invW*0.5+0.5)*w,
+			y:    oy + (0.5-v.y*invW*0.5)*h,
+			z:    v.z*invW*0.5 + 0.5,
+			invW: invW,
+		}
+		if r.psx != RenderPsxOff {
+			s[i].x = float32(math.Floor(float64(s[i].x) + 0.5))
+			s[i].y = float32(math.Floor(float64(s[i].y) + 0.5))
+		}
+	}
+
+	// The back buffer is stored top down, so counter clockwise front faces
+	// have a negative area here
+	area := (s[1].x-s[0].x)*(s[2].y-s[0].y) - (s[2].x-s[0].x)*(s[1].y-s[0].y)
+	if area == 0 || (r.cullBackface && area > 0) {
+		return
+	}
+	if area < 0 {
+		s[1], s[2] = s[2], s[1]
+		vs[1], vs[2] = vs[2], vs[1]
+		area = -area
+	}
+
+	var offset float32
+	if r.depthOffset != 0 {
+		dzdx := ((s[1].z-s[0].z)*(s[2].y-s[0].y) - (s[2].z-s[0].z)*(s[1].y-s[0].y)) / area
+		dzdy := ((s[1].x-s[0].x)*(s[2].z-s[0].z) - (s[2].x-s[0].x)*(s[1].z-s[0].z)) / area
+		slope := max(float32(math.Abs(float64(dzdx))), float32(math.Abs(float64(dzdy))))
+		offset = slope*r.depthOffset + 1.0/(1<<24)
+	}
+
+	// Pixels outside the viewport are clipped like in GL
+	vx, vy := int(r.viewportPos.X), int(r.viewportPos.Y)
+	minX := max(int(math.Floor(float64(min(s[0].x, s[1].x, s[2].x)))), vx)
+	maxX := min(int(math.Ceil(float64(max(s[0].x, s[1].x, s[2].x)))), vx+int(r.viewportSize.X)-1)
+	minY := max(int(math.Floor(float64(min(s[0].y, s[1].y, s[2].y)))), vy)
+	maxY := min(int(math.Ceil(float64(max(s[0].y, s[1].y, s[2].y)))), vy+int(r.viewportSize.Y)-1)
+
+	topLeft := [3]bool{swTopLeft(s[1], s[2]), swTopLeft(s[2], s[0]), swTopLeft(s[0], s[1])}
+	stride := int(r.backBufferSize.X)
+
+	for y := minY; y <= maxY; y++ {
+		py := float32(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float32(x) + 0.5
+			e := [3]float32{swEdge(s[1], s[2], px, py), swEdge(s[2], s[0], px, py), swEdge(s[0], s[1], px, py)}
+			if !swInside(e[0], topLeft[0]) || !swInside(e[1], topLeft[1]) || !swInside(e[2], topLeft[2]) {
+				continue
+			}
+			b0, b1, b2 := e[0]/area, e[1]/area, e[2]/area
+
+			z := b0*s[0].z + b1*s[1].z + b2*s[2].z + offset
+			if z < 0 || z > 1 {
+				continue
+			}
+			i := y*stride + x
+			if r.depthTest && z >= r.depth[i] {
+				continue
+			}
+
+			// Perspective correct attributes
+			p0, p1, p2 := b0*s[0].invW, b1*s[1].invW, b2*s[2].invW
+			norm := 1 / (p0 + p1 + p2)
+			p0, p1, p2 = p0*norm, p1*norm, p2*norm
+			attr := func(a0, a1, a2 float32) float32 { return a0*p0 + a1*p1 + a2*p2 }
+			uv := attr
+			if r.psx != RenderPsxOff {
+				uv = func(a0, a1, a2 float32) float32 { return a0*b0 + a1*b1 + a2*b2 }
+			}
+
+			tex := r.sample(uv(vs[0].u, vs[1].u, vs[2].u), uv(vs[0].v, vs[1].v, vs[2].v))
+			a := tex[3] * attr(vs[0].a, vs[1].a, vs[2].a)
+			if a == 0 {
+				continue
+			}
+			src := [3]float32{
+				tex[0] * attr(vs[0].r, vs[1].r, vs[2].r) * 2,
+				tex[1] * attr(vs[0].g, vs[1].g, vs[2].g) * 2,
+				tex[2] * attr(vs[0].b, vs[1].b, vs[2].b) * 2,
+			}
+			if r.psx != RenderPsxOff {
+				swDither(&src, x, y)
+			}
+			r.blend(i, src, Clamp(a, 0, 1))
+
+			if r.depthWrite {
+				r.depth[i] = z
+			}
+		}
+	}
+}
+
+// swDither4x4 is the ordered dither of the PSX GPU
+var swDither4x4 = [4][4]float32{
+	{-4, 0, -3, 1},
+	{2, -2, 3, -1},
+	{-3, 1, -4, 0},
+	{3, -1, 2, -2},
+}
+
+// swDither cuts c to 5 bits per channel after adding the dither of pixel
+// x, y
+func swDither(c *[3]float32, x, y int) {
+	d := swDither4x4[y%4][x%4]
+	for i := range c {
+		v := Clamp(c[i]*255+d, 0, 255)
+		c[i] = float32(math.Floor(float64(v)/8)) * 8 / 255
+	}
+}
+
+func swInside(e float32, topLeft bool) bool {
+	return e > 0 || (e == 0 && topLeft)
+}
+
+// sample returns the normalized atlas texel at u, v in atlas pixels
+func (r *RenderSoftware) sample(u, v float32) [4]float32 {
+	x := Clamp(int(math.Floor(float64(u))), 0, atlasPixels-1)
+	y := Clamp(int(math.Floor(float64(v))), 0, atlasPixels-1)
+	c := r.page[y*atlasPixels+x]
+
+	return [4]float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255}
+}
+
+// blend writes src with alpha a to the back buffer pixel i
+func (r *RenderSoftware) blend(i int, src [3]float32, a float32) {
+	dst := &r.backBuffer[i]
+	d := [3]float32{float32(dst.R) / 255, float32(dst.G) / 255, float32(dst.B) / 255}
+	keep := 1 - a
+	if r.blendMode == RenderBlendModeLighter {
+		keep = 1
+	}
+
+	var out [3]byte
+	for c := range out {
+		v := Clamp(src[c], 0, 1)*a + d[c]*keep
+		out[c] = byte(Clamp(v, 0, 1)*255 + 0.5)
+	}
+	dst.R, dst.G, dst.B = out[0], out[1], out[2]
+}
+
+func (r *RenderSoftware) TextureCreate(tw int, th int, pixels []RGBA) (int, error) {
+	bw := tw + AtlasBorder*2
+	bh := th + AtlasBorder*2
+	page, x, y, err := atlasAlloc(&r.atlasMaps, bw, bh)
+	if err != nil {
+		return 0, err
+	}
+	for len(r.atlas) <= page {
+		r.atlas = append(r.atlas, make([]RGBA, atlasPixels*atlasPixels))
+	}
+	pb := atlasBorder(tw, th, pixels)
+	atlas := r.atlas[page]
+	for row := 0; row < bh; row++ {
+		copy(atlas[(y+row)*atlasPixels+x:(y+row)*atlasPixels+x+bw], pb[row*bw:(row+1)*bw])
+	}
+
+	return r.textures.add(RenderTexture{
+		page:   page,
+		offset: Vec2i{int32(x + AtlasBorder), int32(y + AtlasBorder)},
+		size:   Vec2i{int32(tw), int32(th)},
+	})
+}
+
+func (r *RenderSoftware) TextureSize(textureIndex int) (Vec2i, error) {
+	t, err := r.textures.get(textureIndex)
+	if err != nil {
+		return Vec2i{}, err
+	}
+
+	return t.size, nil
+}
+
+func (r *RenderSoftware) TextureReplacePixels(textureIndex uint16, pixels []RGBA) error {
+	t, err := r.textures.get(int(textureIndex))
+	if err != nil {
+		return err
+	}
+
+	tw := int(t.size.X)
+	for row := 0; row < int(t.size.Y); row++ {
+		start := (int(t.offset.Y)+row)*atlasPixels + int(t.offset.X)
+		copy(r.atlas[t.page][start:start+tw], pixels[row*tw:(row+1)*tw])
+	}
+
+	return nil
+}
+
+func (r *RenderSoftware) TextureRetain(textureIndex int) error {
+	return r.textures.retain(textureIndex)
+}
+
+func (r *RenderSoftware) TextureRelease(textureIndex int) error {
+	if textureIndex == r.noTexture {
+		return nil
+	}
+	t, err := r.textures.release(textureIndex)
+	if t != nil {
+		atlasFree(r.atlasMaps, t)
+	}
+	return err
+}
+
+func (r *RenderSoftware) TexturesDefrag() error {
+	pages, pixels, err := atlasDefrag(r.textures.textures, r.atlas)
+	if err != nil {
+		return err
+	}
+	r.atlasMaps = pages
+	r.atlas = pixels
+
+	return nil
+}
+
+func (r *RenderSoftware) NoTexture() int {
+	return r.noTexture
+}
+
+func (r *RenderSoftware) TexturesLen() int {
+	return r.textures.len()
+}
@@ -0,0 +1,463 @@
+package engine
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+func newTestRenderSoftware() *RenderSoftware {
+	r := NewRenderSoftware()
+	r.Init(NewVec2i(64, 48))
+	r.FramePrepare()
+	return r
+}
+
+// pixel returns the back buffer pixel at x, y
+func (r *RenderSoftware) pixel(x, y int) RGBA {
+	return r.backBuffer[y*int(r.backBufferSize.X)+x]
+}
+
+// checker is a w×h texture of alternating a and b texels
+func checker(w, h int, a, b RGBA) []RGBA {
+	pixels := make([]RGBA, w*h)
+	for i := range pixels {
+		if (i%w+i/w)%2 == 0 {
+			pixels[i] = a
+		} else {
+			pixels[i] = b
+		}
+	}
+	return pixels
+}
+
+// frontTris is a triangle facing a camera at the origin, with its right
+// angle at pos
+func frontTris(pos Vec3, size gl.Float, color RGBA) Tris {
+	s := Vec3{size, 0, 0}
+	return Tris{Vertices: [3]Vertex{
+		{Pos: pos, Color: color},
+		{Pos: Vec3Add(pos, Vec3{0, size, 0}), Color: color},
+		{Pos: Vec3Add(pos, s), Color: color},
+	}}
+}
+
+func TestRenderSoftwareModulate(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView2d()
+
+	// The white texture is 128 and the color doubled like in the shader
+	r.Push2d(NewVec2i(0, 0), NewVec2i(8, 8), NewRGBA(128, 64, 255, 255), r.NoTexture())
+	if got := r.pixel(4, 4); got != NewRGBA(129, 64, 255, 255) {
+		t.Errorf("white texture × color = %v", got)
+	}
+
+	tex, _ := r.TextureCreate(2, 2, checker(2, 2, NewRGBA(255, 0, 0, 255), NewRGBA(0, 0, 0, 0)))
+	r.Push2d(NewVec2i(10, 0), NewVec2i(4, 4), NewRGBA(128, 128, 128, 255), tex)
+	if got := r.pixel(10, 0); got != NewRGBA(255, 0, 0, 255) {
+		t.Errorf("texel = %v", got)
+	}
+	if got := r.pixel(12, 0); got != NewRGBA(0, 0, 0, 255) {
+		t.Errorf("transparent texel drawn %v", got)
+	}
+}
+
+func TestRenderSoftwareBlend(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView2d()
+	base := NewRGBA(64, 64, 64, 255)
+
+	r.Push2d(NewVec2i(0, 0), NewVec2i(20, 8), base, r.NoTexture())
+	r.Push2d(NewVec2i(0, 0), NewVec2i(8, 8), NewRGBA(0, 128, 0, 128), r.NoTexture())
+	r.SetBlendMode(RenderBlendModeLighter)
+	r.Push2d(NewVec2i(10, 0), NewVec2i(8, 8), NewRGBA(0, 128, 0, 255), r.NoTexture())
+
+	if got := r.pixel(4, 4); got != NewRGBA(32, 96, 32, 255) {
+		t.Errorf("normal blend = %v", got)
+	}
+	if got := r.pixel(14, 4); got != NewRGBA(64, 193, 64, 255) {
+		t.Errorf("lighter blend = %v", got)
+	}
+}
+
+func TestRenderSoftwareDepthAndCulling(t *testing.T) {
+	red, green := NewRGBA(128, 0, 0, 255), NewRGBA(0, 128, 0, 255)
+
+	r := newTestRenderSoftware()
+	r.SetView(Vec3{}, Vec3{})
+	r.PushTris(frontTris(Vec3{-400, -400, 1000}, 1000, red), r.NoTexture())
+	r.PushTris(frontTris(Vec3{-500, -500, 2000}, 2000, green), r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(129, 0, 0, 255) {
+		t.Errorf("far triangle drawn over the near one: %v", got)
+	}
+
+	r.SetDepthTest(false)
+	r.PushTris(frontTris(Vec3{-500, -500, 2000}, 2000, green), r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(0, 129, 0, 255) {
+		t.Errorf("depth test disabled: %v", got)
+	}
+
+	back := frontTris(Vec3{-400, -400, 500}, 1000, red)
+	back.Vertices[1], back.Vertices[2] = back.Vertices[2], back.Vertices[1]
+	r.PushTris(back, r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(0, 129, 0, 255) {
+		t.Errorf("back face drawn: %v", got)
+	}
+	r.SetCullBackface(false)
+	r.PushTris(back, r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(129, 0, 0, 255) {
+		t.Errorf("back face culled with culling disabled: %v", got)
+	}
+}
+
+func TestRenderSoftwareFade(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView(Vec3{}, Vec3{})
+	const z = RenderFadeOutFar + 1000
+	r.PushTris(frontTris(Vec3{-z, -z, z}, 2*z, NewRGBA(128, 128, 128, 255)), r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(0, 0, 0, 255) {
+		t.Errorf("triangle beyond the fade distance drawn: %v", got)
+	}
+}
+
+func TestRenderSoftwareNearClip(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView(Vec3{}, Vec3{})
+
+	// Reaches from behind the camera into the view
+	tris := Tris{Vertices: [3]Vertex{
+		{Pos: Vec3{-1000, -1000, -500}, Color: NewRGBA(128, 128, 128, 255)},
+		{Pos: Vec3{0, 1000, 1000}, Color: NewRGBA(128, 128, 128, 255)},
+		{Pos: Vec3{1000, -1000, 1000}, Color: NewRGBA(128, 128, 128, 255)},
+	}}
+	r.PushTris(tris, r.NoTexture())
+	if got := r.pixel(32, 24); got != NewRGBA(129, 129, 129, 255) {
+		t.Errorf("clipped triangle = %v", got)
+	}
+}
+
+func TestRenderSoftwareTextures(t *testing.T) {
+	r := newTestRenderSoftware()
+	a, _ := r.TextureCreate(40, 40, make([]RGBA, 40*40))
+	b, _ := r.TextureCreate(8, 8, make([]RGBA, 8*8))
+	ta, _ := r.textures.get(a)
+	tb, _ := r.textures.get(b)
+	if ta.offset == tb.offset {
+		t.Fatalf("textures share the atlas spot %v", ta.offset)
+	}
+
+	spot := tb.offset
+	if err := r.TextureRelease(b); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := r.TextureCreate(8, 8, make([]RGBA, 8*8))
+	tc, _ := r.textures.get(c)
+	if c != b || tc.offset != spot {
+		t.Errorf("texture after release at %v, want the spot of the released one %v", tc.offset, spot)
+	}
+	if err := r.TextureRelease(c + 1); err == nil {
+		t.Errorf("release of an unknown texture")
+	}
+}
+
+func TestRenderSoftwareTexturesDefrag(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView2d()
+
+	// Three textures of most of a page each; with the first two released
+	// the last one moves to the first page, the white texture to the second
+	const size = atlasPixels - AtlasBorder*2 - AtlasGrid
+	var textures []int
+	for i := 0; i < 3; i++ {
+		tex, err := r.TextureCreate(size, size, checker(size, size, NewRGBA(0, 255, 0, 255), NewRGBA(0, 255, 0, 255)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		textures = append(textures, tex)
+	}
+	r.TextureRelease(textures[0])
+	r.TextureRelease(textures[1])
+
+	if err := r.TexturesDefrag(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.atlas) != 2 {
+		t.Errorf("%d atlas pages after defrag", len(r.atlas))
+	}
+	if tex, _ := r.textures.get(textures[2]); tex.page != 0 {
+		t.Errorf("texture on page %d after defrag", tex.page)
+	}
+
+	r.Push2d(NewVec2i(0, 0), NewVec2i(8, 8), NewRGBA(128, 128, 128, 255), textures[2])
+	r.Push2d(NewVec2i(8, 0), NewVec2i(8, 8), NewRGBA(128, 128, 128, 255), r.NoTexture())
+	if got := r.pixel(4, 4); got != NewRGBA(0, 255, 0, 255) {
+		t.Errorf("moved texture = %v", got)
+	}
+	if got := r.pixel(12, 4); got != NewRGBA(129, 129, 129, 255) {
+		t.Errorf("white texture after defrag = %v", got)
+	}
+}
+
+func TestRenderSoftwareAtlasPages(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView2d()
+
+	// Two textures of most of a page each, the second one on a new page
+	const size = atlasPixels - AtlasBorder*2 - AtlasGrid
+	red, _ := r.TextureCreate(size, size, checker(size, size, NewRGBA(255, 0, 0, 255), NewRGBA(255, 0, 0, 255)))
+	blue, err := r.TextureCreate(size, size, checker(size, size, NewRGBA(0, 0, 255, 255), NewRGBA(0, 0, 255, 255)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, _ := r.textures.get(red)
+	tb, _ := r.textures.get(blue)
+	if tr.page == tb.page {
+		t.Fatalf("textures share page %d", tr.page)
+	}
+
+	r.Push2d(NewVec2i(0, 0), NewVec2i(8, 8), NewRGBA(128, 128, 128, 255), red)
+	r.Push2d(NewVec2i(8, 0), NewVec2i(8, 8), NewRGBA(128, 128, 128, 255), blue)
+	r.Push2d(NewVec2i(16, 0), NewVec2i(8, 8), NewRGBA(128, 128, 128, 255), r.NoTexture())
+	if got := r.pixel(4, 4); got != NewRGBA(255, 0, 0, 255) {
+		t.Errorf("texture of the first page = %v", got)
+	}
+	if got := r.pixel(12, 4); got != NewRGBA(0, 0, 255, 255) {
+		t.Errorf("texture of the second page = %v", got)
+	}
+	if got := r.pixel(20, 4); got != NewRGBA(129, 129, 129, 255) {
+		t.Errorf("white texture after the second page = %v", got)
+	}
+}
+
+func TestRenderSoftwarePsxDither(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetPsx(RenderPsxOn)
+	r.SetView2d()
+
+	// 32.1 lands on 24 where the dither is negative and on 32 elsewhere
+	r.Push2d(NewVec2i(0, 0), NewVec2i(8, 8), NewRGBA(32, 32, 32, 255), r.NoTexture())
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			want := uint8(32)
+			if swDither4x4[y%4][x%4] < 0 {
+				want = 24
+			}
+			if got := r.pixel(x, y); got != NewRGBA(want, want, want, 255) {
+				t.Errorf("pixel %d,%d = %v; want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestRenderSoftwarePsxSnap(t *testing.T) {
+	// A triangle between pixel corners covers the same pixels as one on the
+	// nearest corners
+	covered := func(psx RenderPsx, x, y gl.Float) []bool {
+		r := newTestRenderSoftware()
+		r.SetPsx(psx)
+		r.SetView2d()
+		white := NewRGBA(128, 128, 128, 255)
+		r.PushTris(Tris{Vertices: [3]Vertex{
+			{Pos: Vec3{0, 0, 0}, Color: white},
+			{Pos: Vec3{0, y, 0}, Color: white},
+			{Pos: Vec3{x, 0, 0}, Color: white},
+		}}, r.NoTexture())
+		mask := make([]bool, len(r.backBuffer))
+		for i, c := range r.backBuffer {
+			mask[i] = c.R != 0
+		}
+		return mask
+	}
+
+	snapped := covered(RenderPsxOn, 40.4, 10.4)
+	if want := covered(RenderPsxOff, 40, 10); !reflect.DeepEqual(snapped, want) {
+		t.Errorf("snapped triangle differs from the one on whole pixels")
+	}
+	if reflect.DeepEqual(snapped, covered(RenderPsxOff, 40.4, 10.4)) {
+		t.Errorf("snapping made no difference")
+	}
+}
+
+func TestRenderSoftwarePsxAffine(t *testing.T) {
+	// A horizontal gradient on a triangle receding to the right. Its left
+	// edge is upright on screen, so affine mapping puts the middle of the
+	// texture at the center column, perspective mapping less of it.
+	gradient := make([]RGBA, 64*4)
+	for i := range gradient {
+		gradient[i] = NewRGBA(uint8(i%64*4), 0, 0, 255)
+	}
+	centerRed := func(psx RenderPsx) int {
+		r := newTestRenderSoftware()
+		r.SetPsx(psx)
+		r.SetCullBackface(false)
+		r.SetView(Vec3{}, Vec3{})
+		tex, _ := r.TextureCreate(64, 4, gradient)
+		white := NewRGBA(128, 128, 128, 255)
+		r.PushTris(Tris{Vertices: [3]Vertex{
+			{Pos: Vec3{-30, -10, 100}, UV: Vec2{0, 2}, Color: white},
+			{Pos: Vec3{60, -20, 200}, UV: Vec2{64, 2}, Color: white},
+			{Pos: Vec3{-30, 20, 100}, UV: Vec2{0, 2}, Color: white},
+		}}, tex)
+
+		var rows []int
+		for y := 0; y < 48; y++ {
+			if r.pixel(32, y).A != 0 && r.pixel(32, y).R != 0 {
+				rows = append(rows, y)
+			}
+		}
+		if len(rows) == 0 {
+			t.Fatalf("triangle not drawn at the center column")
+		}
+		return int(r.pixel(32, rows[len(rows)/2]).R)
+	}
+
+	if affine := centerRed(RenderPsxOn); affine < 112 || affine > 144 {
+		t.Errorf("affine center texel red %d; want about 128", affine)
+	}
+	if perspective := centerRed(RenderPsxOff); perspective > 100 {
+		t.Errorf("perspective center texel red %d; want about 85", perspective)
+	}
+}
+
+func TestRenderSoftwareFov4by3(t *testing.T) {
+	r := NewRenderSoftware()
+	r.Init(NewVec2i(96, 48))
+	r.SetFov(RenderFov4by3, RenderFovDefault)
+	if r.Size() != NewVec2i(64, 48) {
+		t.Fatalf("4:3 area of 96x48 is %v", r.Size())
+	}
+
+	// 2d covers the 4:3 area, the bars beside it stay black
+	r.FramePrepare()
+	r.SetView2d()
+	r.Push2d(NewVec2i(-8, 0), NewVec2i(80, 48), NewRGBA(64, 64, 64, 255), r.NoTexture())
+	gray, black := NewRGBA(64, 64, 64, 255), NewRGBA(0, 0, 0, 255)
+	for x, want := range map[int]RGBA{15: black, 16: gray, 79: gray, 80: black} {
+		if got := r.pixel(x, 24); got != want {
+			t.Errorf("pixel %d = %v; want %v", x, got, want)
+		}
+	}
+
+	// A triangle filling the view is clipped to the area
+	r.FramePrepare()
+	r.SetView(Vec3{}, Vec3{})
+	r.PushTris(frontTris(Vec3{-5000, -5000, 1000}, 20000, gray), r.NoTexture())
+	for x, want := range map[int]RGBA{8: black, 16: gray, 48: gray, 79: gray, 88: black} {
+		if got := r.pixel(x, 24); got != want {
+			t.Errorf("3d pixel %d = %v; want %v", x, got, want)
+		}
+	}
+}
+
+// golden compares img with testdata/name, allowing for float rounding on
+// edges
+func golden(t *testing.T, name string, img *image.RGBA) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Bounds() != img.Bounds() {
+		t.Fatalf("%s: size %v, want %v", name, img.Bounds(), want.Bounds())
+	}
+
+	var diff int
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			wr, wg, wb, _ := want.At(x, y).RGBA()
+			gr, gg, gb, _ := img.At(x, y).RGBA()
+			if absDiff(wr, gr) > 2<<8 || absDiff(wg, gg) > 2<<8 || absDiff(wb, gb) > 2<<8 {
+				diff++
+			}
+		}
+	}
+	if diff > len(img.Pix)/4/200 {
+		t.Errorf("%s: %d pixels differ, run with -update to accept", name, diff)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestRenderSoftwareGolden2d(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView2d()
+
+	tex, _ := r.TextureCreate(4, 4, checker(4, 4, NewRGBA(255, 64, 0, 255), NewRGBA(0, 64, 255, 255)))
+	r.Push2d(NewVec2i(2, 2), NewVec2i(16, 16), NewRGBA(128, 128, 128, 255), tex)
+	r.Push2dTile(NewVec2i(2, 22), NewVec2i(1, 1), NewVec2i(2, 2), NewVec2i(16, 16), NewRGBA(128, 128, 128, 255), tex)
+
+	r.Push2d(NewVec2i(24, 2), NewVec2i(20, 20), NewRGBA(128, 0, 0, 255), r.NoTexture())
+	r.Push2d(NewVec2i(32, 10), NewVec2i(20, 20), NewRGBA(0, 0, 128, 128), r.NoTexture())
+	r.SetBlendMode(RenderBlendModeLighter)
+	r.Push2d(NewVec2i(40, 18), NewVec2i(20, 20), NewRGBA(0, 128, 0, 255), r.NoTexture())
+	r.FrameEnd(0)
+
+	golden(t, "render_2d.png", r.Screen())
+}
+
+func TestRenderSoftwareGolden3d(t *testing.T) {
+	r := newTestRenderSoftware()
+	r.SetView(Vec3{0, -200, 0}, Vec3{0.2, 0.3, 0})
+
+	tex, _ := r.TextureCreate(4, 4, checker(4, 4, NewRGBA(255, 255, 255, 255), NewRGBA(64, 64, 64, 255)))
+	const ts = 4
+	floor := [2]Tris{
+		{Vertices: [3]Vertex{
+			{Pos: Vec3{-2000, 0, 500}, UV: Vec2{0, 0}, Color: NewRGBA(128, 128, 128, 255)},
+			{Pos: Vec3{2000, 0, 500}, UV: Vec2{ts, 0}, Color: NewRGBA(128, 128, 128, 255)},
+			{Pos: Vec3{-2000, 0, 6000}, UV: Vec2{0, ts}, Color: NewRGBA(128, 128, 128, 255)},
+		}},
+		{Vertices: [3]Vertex{
+			{Pos: Vec3{2000, 0, 500}, UV: Vec2{ts, 0}, Color: NewRGBA(128, 128, 128, 255)},
+			{Pos: Vec3{2000, 0, 6000}, UV: Vec2{ts, ts}, Color: NewRGBA(128, 128, 128, 255)},
+			{Pos: Vec3{-2000, 0, 6000}, UV: Vec2{0, ts}, Color: NewRGBA(128, 128, 128, 255)},
+		}},
+	}
+	r.SetCullBackface(false)
+	for _, tris := range floor {
+		r.PushTris(tris, tex)
+	}
+	r.SetCullBackface(true)
+
+	// A wall cutting through a second one
+	r.PushTris(frontTris(Vec3{-600, -900, 2500}, 1200, NewRGBA(128, 32, 32, 255)), r.NoTexture())
+	wall := frontTris(Vec3{-200, -700, 2000}, 1200, NewRGBA(32, 32, 128, 255))
+	wall.Vertices[2].Pos.Z += 1500
+	r.PushTris(wall, r.NoTexture())
+
+	r.SetBlendMode(RenderBlendModeLighter)
+	r.PushSprite(Vec3{500, -600, 1500}, NewVec2i(300, 300), NewRGBA(0, 96, 0, 255), r.NoTexture())
+	r.FrameEnd(0)
+
+	golden(t, "render_3d.png", r.Screen())
+}
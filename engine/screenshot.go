@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ScreenshotDir is where screenshots are written, relative to the working
+// directory like the game data
+const ScreenshotDir = "screenshots"
+
+// ImageFlipY swaps the rows of img, turning a bottom-up image top-down
+func ImageFlipY(img *image.RGBA) {
+	h := img.Bounds().Dy()
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-1-y)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+}
+
+// ScreenshotWrite saves img as a PNG named after t in dir, which is
+// created if needed. Existing files are kept, a second screenshot in the
+// same millisecond gets a numbered name. It returns the path of the file.
+func ScreenshotWrite(dir string, img image.Image, t time.Time) (string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	name := "wipeout-" + t.Format("20060102-150405.000")
+	path := filepath.Join(dir, name+".png")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	for i := 1; errors.Is(err, fs.ErrExist); i++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d.png", name, i))
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = png.Encode(f, img)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return path, f.Close()
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImageFlipY(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 3))
+	for y := 0; y < 3; y++ {
+		img.Pix[y*4] = byte(y)
+	}
+	ImageFlipY(img)
+	if img.Pix[0] != 2 || img.Pix[4] != 1 || img.Pix[8] != 0 {
+		t.Errorf("rows after flip %d %d %d", img.Pix[0], img.Pix[4], img.Pix[8])
+	}
+}
+
+func TestScreenshotWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ScreenshotDir)
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Pix[0], img.Pix[3] = 200, 255
+
+	at := time.Date(2024, 5, 6, 7, 8, 9, 10e6, time.UTC)
+	path, err := ScreenshotWrite(dir, img, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "wipeout-20240506-070809.010.png" {
+		t.Errorf("path %s", path)
+	}
+	second, err := ScreenshotWrite(dir, img, at)
+	if err != nil || filepath.Base(second) != "wipeout-20240506-070809.010-1.png" {
+		t.Errorf("second screenshot %s, %v", second, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := got.At(0, 0).RGBA(); got.Bounds() != img.Bounds() || r>>8 != 200 {
+		t.Errorf("read back %v, red %d", got.Bounds(), r>>8)
+	}
+}
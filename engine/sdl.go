@@ -11,6 +11,9 @@ var Logger *log.Logger
 
 const (
 	PlatformWindowFlags = sdl.WINDOW_OPENGL
+	// PlatformAudioSamples is the number of frames the audio device asks
+	// for at a time, about 23ms
+	PlatformAudioSamples = 1024
 )
 
 var (
@@ -66,6 +69,8 @@ type PlatformSdl struct {
 	gamepad    *sdl.GameController
 	perfFreq   uint64
 	wantToExit bool
+
+	audioDevice sdl.AudioDeviceID
 }
 
 // NewPlatformSdl creates a window
@@ -127,9 +132,9 @@ func (sw *PlatformSdl) PumpEvents() error {
 			code := event.(*sdl.KeyboardEvent).Keysym.Scancode
 			var state float32
 			if event.GetType() == sdl.KEYDOWN {
-				state = 0
-			} else {
 				state = 1
+			} else {
+				state = 0
 			}
 			if code >= sdl.SCANCODE_LCTRL && code <= sdl.SCANCODE_RALT {
 				codeInternal := code - sdl.SCANCODE_LCTRL + sdl.Scancode(InputKeyLCtrl)
@@ -154,9 +159,9 @@ func (sw *PlatformSdl) PumpEvents() error {
 			if button != InputInvalid {
 				var state float32
 				if event.GetType() == sdl.CONTROLLERBUTTONDOWN {
-					state = 0
-				} else {
 					state = 1
+				} else {
+					state = 0
 				}
 				InputSetButtonState(button, state)
 			}
@@ -215,7 +220,7 @@ func (sw *PlatformSdl) SetFullscreen(fullscreen bool) error {
 			return err
 		}
 	} else {
-		err := sw.window.SetFullscreen(sdl.WINDOW_FULLSCREEN)
+		err := sw.window.SetFullscreen(0)
 		if err != nil {
 			return err
 		}
@@ -308,3 +313,39 @@ func (sw *PlatformSdl) GetScreenSize() Vec2i {
 func (sw *PlatformSdl) Destroy() error {
 	return sw.window.Destroy()
 }
+
+// AudioInit opens the default audio device. mix is called from the audio
+// thread whenever the device needs samples, it has to lock what it shares
+// with the game.
+func (sw *PlatformSdl) AudioInit(mix func(out []float32)) error {
+	platformSdlAudioMix = mix
+	spec := sdl.AudioSpec{
+		Freq:     AudioSampleRate,
+		Format:   sdl.AUDIO_F32SYS,
+		Channels: AudioChannels,
+		Samples:  PlatformAudioSamples,
+		Callback: platformSdlAudioCallbackFunc(),
+	}
+	device, err := sdl.OpenAudioDevice("", false, &spec, nil, 0)
+	if err != nil {
+		platformSdlAudioMix = nil
+		return err
+	}
+	sw.audioDevice = device
+	sdl.PauseAudioDevice(device, false)
+
+	return nil
+}
+
+// AudioUpdate does nothing, the device pulls the samples from its callback
+func (sw *PlatformSdl) AudioUpdate() error {
+	return nil
+}
+
+func (sw *PlatformSdl) AudioCleanup() {
+	if sw.audioDevice != 0 {
+		sdl.CloseAudioDevice(sw.audioDevice)
+		sw.audioDevice = 0
+		platformSdlAudioMix = nil
+	}
+}
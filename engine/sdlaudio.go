@@ -0,0 +1,31 @@
+package engine
+
+/*
+#include <stdint.h>
+
+extern void platformSdlAudioCallback(void *userdata, uint8_t *stream, int len);
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// platformSdlAudioMix renders the samples of the open audio device. SDL
+// passes only a C pointer to the callback, so the mix function is kept here.
+var platformSdlAudioMix func(out []float32)
+
+// platformSdlAudioCallback is called from the audio thread of SDL whenever
+// the device needs more samples
+//
+//export platformSdlAudioCallback
+func platformSdlAudioCallback(userdata unsafe.Pointer, stream *C.uint8_t, length C.int) {
+	out := unsafe.Slice((*float32)(unsafe.Pointer(stream)), int(length)/4)
+	platformSdlAudioMix(out)
+}
+
+func platformSdlAudioCallbackFunc() sdl.AudioCallback {
+	return sdl.AudioCallback(C.platformSdlAudioCallback)
+}
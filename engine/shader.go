@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"unsafe"
 	gl "github.com/chsc/gogl/gl33"
 )
@@ -22,16 +23,27 @@ const (
 		uniform vec3 camera_pos;
 		uniform vec2 fade;
 		uniform float time;
+		uniform int psx;
+		uniform vec2 resolution;
+
+		noperspective out vec2 v_uv_affine;
 		
 		void main() {
 			gl_Position = projection * view * model * vec4(pos, 1.0);
 			gl_Position.xy += screen.xy * gl_Position.w;
+			if (psx != 0 && gl_Position.w > 0.0) {
+				// Whole pixels of the back buffer, like the integer screen
+				// coordinates of the GTE
+				vec2 px = floor((gl_Position.xy / gl_Position.w * 0.5 + 0.5) * resolution + 0.5);
+				gl_Position.xy = (px / resolution * 2.0 - 1.0) * gl_Position.w;
+			}
 			v_color = color;
 			v_color.a *= smoothstep(
 				fade.y, fade.x, // fadeout far, near
 				length(vec4(camera_pos, 1.0) - model * vec4(pos, 1.0))
 			);
 			v_uv = uv / 2048.0; // ATLAS_GRID * ATLAS_SIZE
+			v_uv_affine = v_uv;
 		}
 	`
 
@@ -39,15 +51,32 @@ const (
 	    #version 330
 		varying vec4 v_color;
 		varying vec2 v_uv;
+		noperspective in vec2 v_uv_affine;
 		uniform sampler2D texture;
+		uniform int psx;
+		uniform vec2 resolution;
+
+		// Ordered dither of the PSX GPU, added before cutting to 5 bits. Its
+		// rows count from the top of the frame.
+		const float dither[16] = float[16](
+			-4.0,  0.0, -3.0,  1.0,
+			 2.0, -2.0,  3.0, -1.0,
+			-3.0,  1.0, -4.0,  0.0,
+			 3.0, -1.0,  2.0, -2.0
+		);
 
 		void main() {
-			vec4 tex_color = texture2D(texture, v_uv);
+			vec4 tex_color = texture2D(texture, psx != 0 ? v_uv_affine : v_uv);
 			vec4 color = tex_color * v_color;
 			if (color.a == 0.0) {
 				discard;
 			}
 			color.rgb = color.rgb * 2.0;
+			if (psx != 0) {
+				ivec2 p = ivec2(mod(vec2(gl_FragCoord.x, resolution.y - gl_FragCoord.y), 4.0));
+				float d = dither[p.y * 4 + p.x];
+				color.rgb = floor(clamp(color.rgb * 255.0 + d, 0.0, 255.0) / 8.0) * 8.0 / 255.0;
+			}
 			gl_FragColor = color;
 		}
 	`
@@ -102,6 +131,8 @@ type uniform struct {
 	cameraPos  gl.Uint
 	fade       gl.Uint
 	time       gl.Uint
+	psx        gl.Uint
+	resolution gl.Uint
 }
 
 type attribute struct {
@@ -136,6 +167,8 @@ func ShaderGameInit() *ProgramGame {
 	p.uniform.cameraPos = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("camera_pos")))
 	p.uniform.fade = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("fade")))
 	p.uniform.time = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("time")))
+	p.uniform.psx = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("psx")))
+	p.uniform.resolution = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("resolution")))
 
 	p.attribute.pos = gl.Uint(gl.GetAttribLocation(p.program, gl.GLString("pos")))
 	p.attribute.uv = gl.Uint(gl.GetAttribLocation(p.program, gl.GLString("uv")))
@@ -246,6 +279,7 @@ type uniformPE struct {
 	projection gl.Uint
 	screenSize gl.Uint
 	time       gl.Uint
+	original   gl.Uint
 }
 
 type attributePE struct {
@@ -258,12 +292,17 @@ type ProgramPostEffect struct {
 	vao       gl.Uint
 	uniform   uniformPE
 	attribute attributePE
+
+	// params are the uniform locations of the pass parameters
+	params []gl.Int
+	values []float32
 }
 
 func ShaderPostEffectGeneralInit(p *ProgramPostEffect) {
 	p.uniform.projection = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("projection")))
 	p.uniform.screenSize = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("screen_size")))
 	p.uniform.time = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("time")))
+	p.uniform.original = gl.Uint(gl.GetUniformLocation(p.program, gl.GLString("original")))
 
 	p.attribute.pos = gl.Uint(gl.GetAttribLocation(p.program, gl.GLString("pos")))
 	p.attribute.uv = gl.Uint(gl.GetAttribLocation(p.program, gl.GLString("uv")))
@@ -278,18 +317,80 @@ func ShaderPostEffectGeneralInit(p *ProgramPostEffect) {
 	gl.VertexAttribPointer(p.attribute.uv, 2, gl.FLOAT, gl.FALSE, gl.Sizei(unsafe.Sizeof(Vertex{})), gl.Pointer(uintptr(unsafe.Offsetof(Vertex{}.UV))))
 }
 
-func ShaderPostEffectDefaultInit() *ProgramPostEffect {
-	p := &ProgramPostEffect{}
-	p.program = createProgram(postEffectVertexShaderSource, postEffectFragmentShaderSourceDefault)
+// ShaderPostEffectInit builds the program of a post effect pass. Unlike
+// the game shader, compile and link errors are returned so a broken user
+// shader can be reported and skipped.
+func ShaderPostEffectInit(pass *PostEffectPass) (*ProgramPostEffect, error) {
+	program, err := createProgramChecked(postEffectVertexShaderSource, pass.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProgramPostEffect{program: program}
 	ShaderPostEffectGeneralInit(p)
+	for _, param := range pass.Params {
+		p.params = append(p.params, gl.GetUniformLocation(p.program, gl.GLString(param.Name)))
+		p.values = append(p.values, param.Value)
+	}
 
-	return p
+	return p, nil
 }
 
-func ShaderPostEffectCRTInit() *ProgramPostEffect {
-	p := &ProgramPostEffect{}
-	p.program = createProgram(postEffectVertexShaderSource, postEffectFragmentShaderSourceCRT)
-	ShaderPostEffectGeneralInit(p)
+func (p *ProgramPostEffect) Delete() {
+	gl.DeleteVertexArrays(1, &p.vao)
+	gl.DeleteProgram(p.program)
+}
 
-	return p
+func createProgramChecked(vsSource string, fsSource string) (gl.Uint, error) {
+	vs, err := compileShaderChecked(gl.VERTEX_SHADER, vsSource)
+	if err != nil {
+		return 0, fmt.Errorf("vertex shader: %w", err)
+	}
+	defer gl.DeleteShader(vs)
+	fs, err := compileShaderChecked(gl.FRAGMENT_SHADER, fsSource)
+	if err != nil {
+		return 0, fmt.Errorf("fragment shader: %w", err)
+	}
+	defer gl.DeleteShader(fs)
+
+	program := gl.CreateProgram()
+	gl.AttachShader(program, vs)
+	gl.AttachShader(program, fs)
+	gl.LinkProgram(program)
+
+	var status gl.Int
+	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
+	if status != gl.TRUE {
+		var logLength gl.Int
+		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+		log := gl.GLStringAlloc(gl.Sizei(logLength + 1))
+		defer gl.GLStringFree(log)
+		gl.GetProgramInfoLog(program, gl.Sizei(logLength+1), nil, log)
+		gl.DeleteProgram(program)
+		return 0, fmt.Errorf("link: %s", gl.GoString(log))
+	}
+
+	return program, nil
+}
+
+func compileShaderChecked(shaderType gl.Enum, source string) (gl.Uint, error) {
+	shader := gl.CreateShader(shaderType)
+	ssource := gl.GLString(source)
+	defer gl.GLStringFree(ssource)
+	gl.ShaderSource(shader, 1, &ssource, nil)
+	gl.CompileShader(shader)
+
+	var status gl.Int
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status != gl.TRUE {
+		var logLength gl.Int
+		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLength)
+		log := gl.GLStringAlloc(gl.Sizei(logLength + 1))
+		defer gl.GLStringFree(log)
+		gl.GetShaderInfoLog(shader, gl.Sizei(logLength+1), nil, log)
+		gl.DeleteShader(shader)
+		return 0, fmt.Errorf("compile: %s", gl.GoString(log))
+	}
+
+	return shader, nil
 }
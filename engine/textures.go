@@ -0,0 +1,71 @@
+package engine
+
+import "fmt"
+
+// textureTable hands out the texture handles of a renderer. Each texture
+// counts its references; once released by all owners its handle is
+// reused by a later texture.
+type textureTable struct {
+	textures []RenderTexture
+	free     []int
+	live     int
+}
+
+// add stores t with one reference and returns its handle
+func (tt *textureTable) add(t RenderTexture) (int, error) {
+	t.refs = 1
+	if n := len(tt.free); n > 0 {
+		handle := tt.free[n-1]
+		tt.free = tt.free[:n-1]
+		tt.textures[handle] = t
+		tt.live++
+		return handle, nil
+	}
+
+	if len(tt.textures) >= TextureMax {
+		return 0, fmt.Errorf("texture max reached, wanted %d", len(tt.textures))
+	}
+	tt.textures = append(tt.textures, t)
+	tt.live++
+
+	return len(tt.textures) - 1, nil
+}
+
+// get returns the texture of a live handle
+func (tt *textureTable) get(handle int) (*RenderTexture, error) {
+	if handle < 0 || handle >= len(tt.textures) || tt.textures[handle].refs == 0 {
+		return nil, fmt.Errorf("invalid texture index %d", handle)
+	}
+	return &tt.textures[handle], nil
+}
+
+func (tt *textureTable) retain(handle int) error {
+	t, err := tt.get(handle)
+	if err != nil {
+		return err
+	}
+	t.refs++
+	return nil
+}
+
+// release drops a reference to handle. It returns the texture when that was
+// the last one, its handle is free from then on.
+func (tt *textureTable) release(handle int) (*RenderTexture, error) {
+	t, err := tt.get(handle)
+	if err != nil {
+		return nil, err
+	}
+	t.refs--
+	if t.refs > 0 {
+		return nil, nil
+	}
+
+	tt.free = append(tt.free, handle)
+	tt.live--
+	return t, nil
+}
+
+// len returns the number of live textures
+func (tt *textureTable) len() int {
+	return tt.live
+}
@@ -0,0 +1,41 @@
+package engine
+
+import "testing"
+
+func TestTextureTable(t *testing.T) {
+	var tt textureTable
+	a, _ := tt.add(RenderTexture{size: Vec2i{1, 1}})
+	b, _ := tt.add(RenderTexture{size: Vec2i{2, 2}})
+	if a == b || tt.len() != 2 {
+		t.Fatalf("handles %d, %d with %d live textures", a, b, tt.len())
+	}
+
+	// A retained texture outlives its first release
+	if err := tt.retain(a); err != nil {
+		t.Fatal(err)
+	}
+	if freed, err := tt.release(a); freed != nil || err != nil {
+		t.Errorf("first release of a retained texture = %v, %v", freed, err)
+	}
+	if freed, err := tt.release(a); freed == nil || freed.size != (Vec2i{1, 1}) || err != nil {
+		t.Errorf("last release = %v, %v", freed, err)
+	}
+	if _, err := tt.get(a); err == nil {
+		t.Errorf("released handle still valid")
+	}
+	if _, err := tt.release(a); err == nil {
+		t.Errorf("handle released twice")
+	}
+
+	// The freed handle is handed out again
+	c, _ := tt.add(RenderTexture{size: Vec2i{3, 3}})
+	if c != a || tt.len() != 2 {
+		t.Errorf("new texture got handle %d, want %d", c, a)
+	}
+	if got, err := tt.get(c); err != nil || got.size != (Vec2i{3, 3}) || got.refs != 1 {
+		t.Errorf("get(%d) = %+v, %v", c, got, err)
+	}
+	if _, err := tt.get(-1); err == nil {
+		t.Errorf("negative handle valid")
+	}
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"errors"
+)
+
+const (
+	// VagSampleRate is the rate the sounds of a VB bank are played at
+	VagSampleRate = 22050
+
+	// VagBlockSize is the size of a block of ADPCM data in bytes
+	VagBlockSize = 16
+	// VagBlockSamples is the number of samples one block decodes to
+	VagBlockSamples = 28
+
+	vagHeaderSize = 48
+)
+
+// Flags in the second byte of a block
+const (
+	// VagFlagEnd marks the last block of a sound
+	VagFlagEnd = 1 << 0
+	// VagFlagRepeat on the last block makes the sound loop
+	VagFlagRepeat = 1 << 1
+	// VagFlagLoopStart marks the block a loop jumps back to
+	VagFlagLoopStart = 1 << 2
+)
+
+// vagFilters are the predictor coefficients of the SPU in 1/64 units
+var vagFilters = [5][2]int32{
+	{0, 0},
+	{60, 0},
+	{115, -52},
+	{98, -55},
+	{122, -60},
+}
+
+var (
+	ErrVagHeader = errors.New("vag: not a VAGp file")
+	ErrVagSize   = errors.New("vag: data is not made of whole blocks")
+)
+
+// VagDecoder turns PSX ADPCM blocks into 16 bit PCM. Each block depends on
+// the last two samples of the previous one, so a decoder must see the
+// blocks of a sound in order.
+type VagDecoder struct {
+	history [2]int32
+}
+
+// Reset clears the history before a new sound
+func (d *VagDecoder) Reset() {
+	d.history = [2]int32{}
+}
+
+// DecodeBlock decodes one VagBlockSize block into out, which must hold
+// VagBlockSamples samples, and returns the block's flags
+func (d *VagDecoder) DecodeBlock(block []byte, out []int16) byte {
+	shift := block[0] & 0x0f
+	filter := int(block[0] >> 4)
+	if filter >= len(vagFilters) {
+		filter = 0
+	}
+	if shift > 12 {
+		shift = 9
+	}
+	k0, k1 := vagFilters[filter][0], vagFilters[filter][1]
+
+	for i := 0; i < VagBlockSamples; i++ {
+		nibble := block[2+i/2]
+		if i&1 == 1 {
+			nibble >>= 4
+		}
+		// Sign extend the nibble into the top of a 16 bit value
+		sample := int32(int16(uint16(nibble&0x0f)<<12)) >> shift
+		sample += (d.history[0]*k0 + d.history[1]*k1 + 32) >> 6
+		sample = Clamp(sample, -32768, 32767)
+
+		d.history[1] = d.history[0]
+		d.history[0] = sample
+		out[i] = int16(sample)
+	}
+
+	return block[1]
+}
+
+// VagDecodeBank splits a VB sound bank into its sounds in the order they
+// are stored. A sound ends with a block flagged VagFlagEnd; if that block
+// also has VagFlagRepeat the sound loops from its last VagFlagLoopStart
+// block.
+func VagDecodeBank(data []byte, rate int) ([]*Sound, error) {
+	if len(data)%VagBlockSize != 0 {
+		return nil, ErrVagSize
+	}
+
+	var sounds []*Sound
+	var d VagDecoder
+	block := make([]int16, VagBlockSamples)
+	samples := make([]float32, 0, len(data)/VagBlockSize*VagBlockSamples)
+	start, loopStart := 0, -1
+
+	for p := 0; p < len(data); p += VagBlockSize {
+		flags := d.DecodeBlock(data[p:p+VagBlockSize], block)
+		if flags&VagFlagLoopStart != 0 {
+			loopStart = len(samples) - start
+		}
+		for _, s := range block {
+			samples = append(samples, float32(s)/32768)
+		}
+
+		if flags&VagFlagEnd == 0 {
+			continue
+		}
+
+		sound := &Sound{
+			Samples: samples[start:len(samples):len(samples)],
+			Rate:    rate,
+		}
+		// A block flagged with all three bits is the usual end of a one shot
+		// sound, the SPU keeps repeating it silently
+		loops := flags&VagFlagRepeat != 0 && flags&VagFlagLoopStart == 0
+		if loops && loopStart >= 0 {
+			sound.LoopStart = loopStart
+			sound.LoopEnd = len(sound.Samples)
+		}
+		sounds = append(sounds, sound)
+
+		d.Reset()
+		start, loopStart = len(samples), -1
+	}
+
+	// Blocks after the last end flag still make a sound
+	if start < len(samples) {
+		sounds = append(sounds, &Sound{Samples: samples[start:], Rate: rate})
+	}
+
+	return sounds, nil
+}
+
+// VagLoad decodes a single VAGp file, the sample rate is taken from its
+// header
+func VagLoad(data []byte) (*Sound, error) {
+	if len(data) < vagHeaderSize || string(data[0:4]) != "VAGp" {
+		return nil, ErrVagHeader
+	}
+
+	var p uint32 = 12
+	size := int(GetU32(data, &p))
+	rate := int(GetU32(data, &p))
+	if rate == 0 {
+		rate = VagSampleRate
+	}
+	body := data[vagHeaderSize:]
+	if size < len(body) {
+		body = body[:size]
+	}
+	body = body[:len(body)/VagBlockSize*VagBlockSize]
+
+	sounds, err := VagDecodeBank(body, rate)
+	if err != nil {
+		return nil, err
+	}
+	if len(sounds) == 0 {
+		return nil, ErrVagSize
+	}
+
+	return sounds[0], nil
+}
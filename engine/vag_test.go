@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"testing"
+)
+
+// vagBlock builds an ADPCM block from a header, flags and the first data
+// bytes, the rest of the nibbles are zero
+func vagBlock(header, flags byte, data ...byte) []byte {
+	b := make([]byte, VagBlockSize)
+	b[0] = header
+	b[1] = flags
+	copy(b[2:], data)
+	return b
+}
+
+func TestVagDecodeBlock(t *testing.T) {
+	allSevens := make([]byte, 14)
+	for i := range allSevens {
+		allSevens[i] = 0x77
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+		want  []int16
+	}{
+		{"no filter", vagBlock(0x00, 0, 0x21, 0xf8), []int16{4096, 8192, -32768, -4096, 0}},
+		{"shift", vagBlock(0x0c, 0, 0x97), []int16{7, -7, 0}},
+		{"filter 1", vagBlock(0x16, 0, 0x07), []int16{448, 420, 394}},
+		{"clamped", vagBlock(0x10, 0, allSevens...), []int16{28672, 32767, 32767}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d VagDecoder
+			out := make([]int16, VagBlockSamples)
+			d.DecodeBlock(tt.block, out)
+			for i, want := range tt.want {
+				if out[i] != want {
+					t.Errorf("sample %d = %d, want %d", i, out[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestVagDecodeHistory(t *testing.T) {
+	var d VagDecoder
+	out := make([]int16, VagBlockSamples)
+
+	// The last two samples of a block feed the filter of the next one
+	first := vagBlock(0x00, 0)
+	first[15] = 0x12
+	d.DecodeBlock(first, out)
+	if out[26] != 8192 || out[27] != 4096 {
+		t.Fatalf("history samples %d, %d", out[26], out[27])
+	}
+
+	d.DecodeBlock(vagBlock(0x2c, 0), out)
+	if out[0] != 704 || out[1] != -2063 {
+		t.Errorf("filter 2 samples %d, %d, want 704, -2063", out[0], out[1])
+	}
+}
+
+func TestVagDecodeBank(t *testing.T) {
+	end := vagBlock(0x00, VagFlagEnd)
+	end[15] = 0x11
+
+	var data []byte
+	for _, b := range [][]byte{
+		// One shot sound
+		vagBlock(0x00, 0, 0x11),
+		end,
+		// Looping sound, starts with a filter that shows a stale history
+		vagBlock(0x1c, 0),
+		vagBlock(0x00, VagFlagLoopStart),
+		vagBlock(0x00, VagFlagEnd|VagFlagRepeat),
+		// One shot sound with the silent repeating end block
+		vagBlock(0x00, VagFlagEnd|VagFlagRepeat|VagFlagLoopStart),
+		// Trailing block without end flag
+		vagBlock(0x00, 0),
+	} {
+		data = append(data, b...)
+	}
+
+	sounds, err := VagDecodeBank(data, VagSampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		len, loopStart, loopEnd int
+	}{
+		{2 * VagBlockSamples, 0, 0},
+		{3 * VagBlockSamples, VagBlockSamples, 3 * VagBlockSamples},
+		{VagBlockSamples, 0, 0},
+		{VagBlockSamples, 0, 0},
+	}
+	if len(sounds) != len(want) {
+		t.Fatalf("%d sounds, want %d", len(sounds), len(want))
+	}
+	for i, w := range want {
+		s := sounds[i]
+		if len(s.Samples) != w.len || s.LoopStart != w.loopStart || s.LoopEnd != w.loopEnd || s.Rate != VagSampleRate {
+			t.Errorf("sound %d: len %d loop %d-%d rate %d, want len %d loop %d-%d", i, len(s.Samples), s.LoopStart, s.LoopEnd, s.Rate, w.len, w.loopStart, w.loopEnd)
+		}
+	}
+
+	if sounds[0].Samples[0] != 0.125 {
+		t.Errorf("first sample %.4f, want 0.125", sounds[0].Samples[0])
+	}
+	if sounds[1].Samples[0] != 0 {
+		t.Errorf("history not reset between sounds, first sample %.6f", sounds[1].Samples[0])
+	}
+
+	if _, err := VagDecodeBank(data[:20], VagSampleRate); err != ErrVagSize {
+		t.Errorf("partial block error = %v", err)
+	}
+}
+
+func TestVagLoad(t *testing.T) {
+	header := make([]byte, vagHeaderSize)
+	copy(header, "VAGp")
+	header[15] = 2 * VagBlockSize
+	header[17], header[18], header[19] = 0x00, 0x2b, 0x11 // 11025
+	data := append(header, vagBlock(0x00, 0, 0x01)...)
+	data = append(data, vagBlock(0x00, VagFlagEnd)...)
+
+	s, err := VagLoad(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Rate != 11025 || len(s.Samples) != 2*VagBlockSamples {
+		t.Errorf("rate %d, %d samples", s.Rate, len(s.Samples))
+	}
+
+	if _, err := VagLoad(data[4:]); err != ErrVagHeader {
+		t.Errorf("missing magic error = %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// WavChunkFrames is the number of frames Decode returns at most
+const WavChunkFrames = 4096
+
+var (
+	ErrWavHeader = errors.New("wav: not a RIFF WAVE file")
+	ErrWavFormat = errors.New("wav: only 16 bit PCM is supported")
+)
+
+// WavDecoder streams the samples of a 16 bit PCM WAV file in chunks
+type WavDecoder struct {
+	r         io.Reader
+	channels  int
+	rate      int
+	remaining int64
+	bytes     []byte
+}
+
+// NewWavDecoder reads the headers of r up to the start of the samples
+func NewWavDecoder(r io.Reader) (*WavDecoder, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrWavHeader
+	}
+
+	d := &WavDecoder{r: r}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, ErrWavHeader
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrWavHeader
+			}
+			var format [16]byte
+			if _, err := io.ReadFull(r, format[:]); err != nil {
+				return nil, err
+			}
+			if binary.LittleEndian.Uint16(format[0:]) != 1 || binary.LittleEndian.Uint16(format[14:]) != 16 {
+				return nil, ErrWavFormat
+			}
+			d.channels = int(binary.LittleEndian.Uint16(format[2:]))
+			d.rate = int(binary.LittleEndian.Uint32(format[4:]))
+			size -= 16
+		case "data":
+			if d.channels == 0 || d.rate == 0 {
+				return nil, ErrWavHeader
+			}
+			d.remaining = size
+			return d, nil
+		}
+
+		// Chunks are padded to an even size
+		if _, err := io.CopyN(io.Discard, r, size+size&1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *WavDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *WavDecoder) SampleRate() int {
+	return d.rate
+}
+
+// Decode reads up to WavChunkFrames frames into buf and returns the
+// interleaved samples, or io.EOF after the last one
+func (d *WavDecoder) Decode(buf []int16) ([]int16, error) {
+	frameSize := int64(2 * d.channels)
+	size := min(d.remaining, WavChunkFrames*frameSize)
+	size -= size % frameSize
+	if size <= 0 {
+		return buf[:0], io.EOF
+	}
+
+	if int64(cap(d.bytes)) < size {
+		d.bytes = make([]byte, size)
+	}
+	bytes := d.bytes[:size]
+	n, err := io.ReadFull(d.r, bytes)
+	n -= n % int(frameSize)
+	if n == 0 {
+		if err == nil || err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return buf[:0], err
+	}
+	d.remaining -= int64(n)
+	if err != nil {
+		// The file ended early, what was read is still played
+		d.remaining = 0
+	}
+
+	if cap(buf) < n/2 {
+		buf = make([]int16, n/2)
+	}
+	buf = buf[:n/2]
+	for i := range buf {
+		buf[i] = int16(binary.LittleEndian.Uint16(bytes[i*2:]))
+	}
+
+	return buf, nil
+}
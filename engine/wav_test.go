@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// wavFile builds a 16 bit PCM WAV file with an extra chunk before the data
+func wavFile(channels, rate int, samples ...int16) []byte {
+	le := binary.LittleEndian
+	var b []byte
+	b = append(b, "RIFF\x00\x00\x00\x00WAVE"...)
+	b = append(b, "fmt "...)
+	b = le.AppendUint32(b, 16)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, uint16(channels))
+	b = le.AppendUint32(b, uint32(rate))
+	b = le.AppendUint32(b, uint32(rate*channels*2))
+	b = le.AppendUint16(b, uint16(channels*2))
+	b = le.AppendUint16(b, 16)
+	b = append(b, "LIST\x03\x00\x00\x00abc\x00"...)
+	b = append(b, "data"...)
+	b = le.AppendUint32(b, uint32(len(samples)*2))
+	for _, s := range samples {
+		b = le.AppendUint16(b, uint16(s))
+	}
+	return b
+}
+
+func TestWavDecode(t *testing.T) {
+	samples := make([]int16, (WavChunkFrames+10)*2)
+	for i := range samples {
+		samples[i] = int16(i - 100)
+	}
+
+	d, err := NewWavDecoder(bytes.NewReader(wavFile(2, 22050, samples...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Channels() != 2 || d.SampleRate() != 22050 {
+		t.Errorf("channels %d rate %d", d.Channels(), d.SampleRate())
+	}
+
+	var got []int16
+	var chunks int
+	buf, err := d.Decode(nil)
+	for ; err == nil; buf, err = d.Decode(buf) {
+		got = append(got, buf...)
+		chunks++
+	}
+	if err != io.EOF || chunks != 2 {
+		t.Errorf("%d chunks, err %v", chunks, err)
+	}
+	if len(got) != len(samples) || got[0] != -100 || got[len(got)-1] != samples[len(samples)-1] {
+		t.Errorf("%d samples, first %d", len(got), got[0])
+	}
+}
+
+func TestWavHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not riff", []byte("RIFX\x00\x00\x00\x00WAVEfmt "), ErrWavHeader},
+		{"8 bit", func() []byte {
+			b := wavFile(1, 8000)
+			b[34] = 8
+			return b
+		}(), ErrWavFormat},
+		{"no data", wavFile(1, 8000)[:36], ErrWavHeader},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewWavDecoder(bytes.NewReader(tt.data)); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"sort"
+)
+
+type ChampionshipOutcome int
+
+const (
+	// ChampionshipNextRace means the player qualified and moves to the next circuit
+	ChampionshipNextRace ChampionshipOutcome = iota
+	// ChampionshipRetry means the player failed to qualify and lost a life
+	ChampionshipRetry
+	// ChampionshipGameOver means the player failed to qualify with no lives left
+	ChampionshipGameOver
+	// ChampionshipComplete means all circuits were raced without winning
+	ChampionshipComplete
+	// ChampionshipWon means all circuits were raced and the player leads the table
+	ChampionshipWon
+)
+
+// Championship is the state of a championship across its races. It holds no
+// references to the renderer or scenes, results are fed in as finishing
+// orders.
+type Championship struct {
+	RaceClass int
+	Pilot     int
+	Circuit   int
+	Lives     int
+	Ranks     [NumPilots]PilotPoints
+}
+
+func NewChampionship(raceClass int, pilot int) *Championship {
+	c := &Championship{
+		RaceClass: raceClass,
+		Pilot:     pilot,
+		Circuit:   int(CircuitAltimaVII),
+		Lives:     NumLives,
+	}
+	for i := range c.Ranks {
+		c.Ranks[i] = PilotPoints{Pilot: uint16(i)}
+	}
+
+	return c
+}
+
+// Qualified reports whether the player's finishing position allows them to
+// continue
+func (c *Championship) Qualified(order []int) bool {
+	for i, pilot := range order {
+		if pilot == c.Pilot {
+			return i+1 <= QualifyingRank
+		}
+	}
+	return false
+}
+
+// RaceFinished applies the finishing order of a race, pilots listed from
+// first to last. Points are only awarded when the player qualified; a
+// championship won unlocks the Rapier class from Venom and the bonus
+// circuits from Rapier in save.
+func (c *Championship) RaceFinished(order []int, save *Save) ChampionshipOutcome {
+	if !c.Qualified(order) {
+		c.Lives--
+		if c.Lives <= 0 {
+			c.Lives = 0
+			return ChampionshipGameOver
+		}
+		return ChampionshipRetry
+	}
+
+	for rank, pilot := range order {
+		if rank >= len(Def.RaceModeForRank) {
+			break
+		}
+		for i := range c.Ranks {
+			if int(c.Ranks[i].Pilot) == pilot {
+				c.Ranks[i].Points += uint16(Def.RaceModeForRank[rank])
+				break
+			}
+		}
+	}
+	sort.SliceStable(c.Ranks[:], func(i, j int) bool {
+		return c.Ranks[i].Points > c.Ranks[j].Points
+	})
+
+	c.Circuit++
+	if c.Circuit < NumNonBonusCircuits {
+		return ChampionshipNextRace
+	}
+
+	if int(c.Ranks[0].Pilot) != c.Pilot {
+		return ChampionshipComplete
+	}
+
+	if RaceClassE(c.RaceClass) == RaceClassVenom && save.HasRapierClass == 0 {
+		save.HasRapierClass = 1
+		save.IsDirty = true
+	} else if RaceClassE(c.RaceClass) == RaceClassRapier && save.HasBonusCircuits == 0 {
+		save.HasBonusCircuits = 1
+		save.IsDirty = true
+	}
+
+	return ChampionshipWon
+}
+
+// Position returns the 1 based championship position of pilot
+func (c *Championship) Position(pilot int) int {
+	for i := range c.Ranks {
+		if int(c.Ranks[i].Pilot) == pilot {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// startChampionship begins a new championship for the selected class and
+// pilot
+func (g *Game) startChampionship() {
+	g.championship = NewChampionship(g.RaceClass, g.Pilot)
+	g.Circuit = g.championship.Circuit
+	g.syncChampionship()
+}
+
+// syncChampionship copies the standings and lives to the game fields the
+// scenes read; the circuit only changes when the next race starts
+func (g *Game) syncChampionship() {
+	c := g.championship
+	if c == nil {
+		return
+	}
+	g.Lives = c.Lives
+	g.ChampionshipRanks = c.Ranks
+}
@@ -0,0 +1,139 @@
+package game
+
+import (
+	"testing"
+)
+
+// finishingOrder returns all pilots with player at the given 1 based position
+func finishingOrder(player, position int) []int {
+	order := make([]int, 0, NumPilots)
+	for pilot := 0; pilot < int(NumPilots); pilot++ {
+		if pilot != player {
+			order = append(order, pilot)
+		}
+	}
+	order = append(order, 0)
+	copy(order[position:], order[position-1:])
+	order[position-1] = player
+	return order
+}
+
+func TestChampionshipPoints(t *testing.T) {
+	save := NewSave()
+	c := NewChampionship(int(RaceClassVenom), 5)
+
+	order := []int{3, 1, 5, 0, 2, 4, 6, 7}
+	if got := c.RaceFinished(order, &save); got != ChampionshipNextRace {
+		t.Fatalf("outcome = %d, want next race", got)
+	}
+
+	for rank, pilot := range order {
+		want := uint16(Def.RaceModeForRank[rank])
+		if c.Ranks[rank].Pilot != uint16(pilot) || c.Ranks[rank].Points != want {
+			t.Errorf("rank %d = %+v, want pilot %d with %d points", rank, c.Ranks[rank], pilot, want)
+		}
+	}
+	if c.Circuit != 1 || c.Lives != NumLives {
+		t.Errorf("circuit %d lives %d, want 1 and %d", c.Circuit, c.Lives, NumLives)
+	}
+
+	// Points add up and the table is sorted again
+	c.RaceFinished([]int{5, 0, 2, 3, 1, 4, 6, 7}, &save)
+	if c.Ranks[0].Pilot != 5 || c.Ranks[0].Points != uint16(Def.RaceModeForRank[2]+Def.RaceModeForRank[0]) {
+		t.Errorf("leader = %+v, want pilot 5", c.Ranks[0])
+	}
+	for i := 1; i < len(c.Ranks); i++ {
+		if c.Ranks[i].Points > c.Ranks[i-1].Points {
+			t.Errorf("ranks not sorted at %d: %+v", i, c.Ranks)
+		}
+	}
+	if c.Position(5) != 1 {
+		t.Errorf("position = %d, want 1", c.Position(5))
+	}
+}
+
+func TestChampionshipQualifying(t *testing.T) {
+	tests := []struct {
+		position int
+		want     bool
+	}{
+		{1, true},
+		{QualifyingRank, true},
+		{QualifyingRank + 1, false},
+		{int(NumPilots), false},
+	}
+
+	for _, tt := range tests {
+		c := NewChampionship(int(RaceClassVenom), 2)
+		if got := c.Qualified(finishingOrder(2, tt.position)); got != tt.want {
+			t.Errorf("position %d: qualified = %v, want %v", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestChampionshipLives(t *testing.T) {
+	save := NewSave()
+	c := NewChampionship(int(RaceClassVenom), 0)
+	c.RaceFinished(finishingOrder(0, 1), &save)
+	ranks := c.Ranks
+
+	for life := NumLives - 1; life > 0; life-- {
+		if got := c.RaceFinished(finishingOrder(0, QualifyingRank+1), &save); got != ChampionshipRetry {
+			t.Fatalf("outcome = %d, want retry", got)
+		}
+		if c.Lives != life {
+			t.Errorf("lives = %d, want %d", c.Lives, life)
+		}
+	}
+	if c.Ranks != ranks || c.Circuit != 1 {
+		t.Errorf("failed races changed the standings or circuit")
+	}
+
+	if got := c.RaceFinished(finishingOrder(0, int(NumPilots)), &save); got != ChampionshipGameOver {
+		t.Errorf("outcome = %d, want game over", got)
+	}
+	if c.Lives != 0 {
+		t.Errorf("lives = %d, want 0", c.Lives)
+	}
+}
+
+func TestChampionshipUnlocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		class      RaceClassE
+		position   int
+		want       ChampionshipOutcome
+		wantRapier uint32
+		wantBonus  uint32
+	}{
+		{"venom won", RaceClassVenom, 1, ChampionshipWon, 1, 0},
+		{"rapier won", RaceClassRapier, 1, ChampionshipWon, 0, 1},
+		{"venom third", RaceClassVenom, 3, ChampionshipComplete, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			save := NewSave()
+			save.IsDirty = false
+			c := NewChampionship(int(tt.class), 4)
+
+			var got ChampionshipOutcome
+			for race := 0; race < NumNonBonusCircuits; race++ {
+				got = c.RaceFinished(finishingOrder(4, tt.position), &save)
+				if race < NumNonBonusCircuits-1 && got != ChampionshipNextRace {
+					t.Fatalf("race %d: outcome = %d, want next race", race, got)
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("outcome = %d, want %d", got, tt.want)
+			}
+			if save.HasRapierClass != tt.wantRapier || save.HasBonusCircuits != tt.wantBonus {
+				t.Errorf("unlocks rapier %d bonus %d, want %d %d", save.HasRapierClass, save.HasBonusCircuits, tt.wantRapier, tt.wantBonus)
+			}
+			if save.IsDirty != (tt.want == ChampionshipWon) {
+				t.Errorf("save dirty = %v", save.IsDirty)
+			}
+		})
+	}
+}
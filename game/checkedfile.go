@@ -0,0 +1,123 @@
+package game
+
+import (
+	"encoding"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// The save, replays and ghosts are checked files: a little endian u32 magic
+// and version, the body, and a crc32 of everything before it. Decoding
+// checks the framing before the body is read, and the decoded value is
+// only modified once the whole file turned out to be valid.
+//
+// checkedFileOverhead is the size of the magic, version and crc32.
+const checkedFileOverhead = 4 + 4 + 4
+
+// checkedFileNew returns a checked file of size bytes in all, its header
+// written and p at the start of the body
+func checkedFileNew(magic, version uint32, size int) ([]byte, uint32) {
+	bytes := make([]byte, size)
+	var p uint32
+	engine.PutU32LE(bytes, &p, magic)
+	engine.PutU32LE(bytes, &p, version)
+	return bytes, p
+}
+
+// checkedFileSeal writes the crc32 of bytes up to p after them
+func checkedFileSeal(bytes []byte, p *uint32) {
+	engine.PutU32LE(bytes, p, crc32.ChecksumIEEE(bytes[:*p]))
+}
+
+// checkedFileOpen checks the framing of bytes and returns the version and
+// the position of the body. Versions from minVersion to maxVersion are
+// accepted. Errors wrap corrupted.
+func checkedFileOpen(bytes []byte, magic, minVersion, maxVersion uint32, corrupted error) (uint32, uint32, error) {
+	if len(bytes) < checkedFileOverhead {
+		return 0, 0, corrupted
+	}
+
+	var p uint32
+	gotMagic := engine.GetU32LE(bytes, &p)
+	version := engine.GetU32LE(bytes, &p)
+	if gotMagic != magic {
+		return 0, 0, fmt.Errorf("%w: invalid magic %#x", corrupted, gotMagic)
+	}
+	if version < minVersion || version > maxVersion {
+		return 0, 0, fmt.Errorf("%w: unsupported version %d", corrupted, version)
+	}
+
+	crcPos := uint32(len(bytes) - 4)
+	crc := engine.GetU32LE(bytes, &crcPos)
+	if crc != crc32.ChecksumIEEE(bytes[:len(bytes)-4]) {
+		return 0, 0, fmt.Errorf("%w: checksum mismatch", corrupted)
+	}
+
+	return version, p, nil
+}
+
+// configPath returns the location of name below the save directory in the
+// user's config dir
+func configPath(name ...string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{dir, SaveDirName}, name...)...), nil
+}
+
+// loadChecked decodes the file at path into v. Errors reading the file are
+// returned as they are, so a missing file can be told apart.
+func loadChecked(path string, v encoding.BinaryUnmarshaler) error {
+	data, err := engine.LoadBinaryFile(path)
+	if err != nil {
+		return err
+	}
+	if err := v.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeChecked stores the encoding of v atomically at path
+func writeChecked(path string, v encoding.BinaryMarshaler) error {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic stores data at path through a temporary file that is
+// renamed over it, so a crash leaves either the old or the new file. The
+// directory of path is created if needed.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package game
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+var errTestCorrupted = errors.New("test corrupted")
+
+func TestCheckedFile(t *testing.T) {
+	bytes, p := checkedFileNew(0x1234, 2, checkedFileOverhead+1)
+	engine.PutU8(bytes, &p, 42)
+	checkedFileSeal(bytes, &p)
+
+	version, body, err := checkedFileOpen(bytes, 0x1234, 1, 3, errTestCorrupted)
+	if err != nil || version != 2 || engine.GetU8(bytes, &body) != 42 {
+		t.Fatalf("checkedFileOpen() = %d, %v", version, err)
+	}
+
+	flipped := append([]byte{}, bytes...)
+	flipped[8] ^= 0xff
+	for _, c := range []struct {
+		name       string
+		bytes      []byte
+		magic      uint32
+		minVersion uint32
+	}{
+		{"short", bytes[:4], 0x1234, 1},
+		{"magic", bytes, 0x4321, 1},
+		{"version", bytes, 0x1234, 3},
+		{"checksum", flipped, 0x1234, 1},
+	} {
+		if _, _, err := checkedFileOpen(c.bytes, c.magic, c.minVersion, 3, errTestCorrupted); !errors.Is(err, errTestCorrupted) {
+			t.Errorf("%s: checkedFileOpen() = %v", c.name, err)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sub")
+	path := filepath.Join(dir, "file")
+	for _, data := range []string{"old", "new"} {
+		if err := writeFileAtomic(path, []byte(data)); err != nil {
+			t.Fatalf("writeFileAtomic() = %v", err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != "new" {
+		t.Errorf("file holds %q, %v", got, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in the directory", len(entries))
+	}
+}
@@ -3,6 +3,7 @@ package game
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/adsozuan/wipeout-rw-go/engine"
 )
@@ -17,7 +18,6 @@ const (
 	NumLaps        = 3
 	NumLives       = 3
 	QualifyingRank = 3
-	
 )
 
 type Action int
@@ -42,6 +42,13 @@ const (
 	AMenuSelect
 	AMenuStart
 	AMenuQuit
+
+	AMusicNext
+	AMusicPrev
+
+	AScreenshot
+	AScreenshotBackBuffer
+	ARecord
 )
 
 type GameSceneE int
@@ -226,6 +233,161 @@ type PilotPoints struct {
 	Points uint16
 }
 
+var Def = GameDefinition{
+	RaceClasses: [NumRaceClasses]RaceClass{
+		RaceClassVenom:  {Name: "VENOM CLASS"},
+		RaceClassRapier: {Name: "RAPIER CLASS"},
+	},
+	RaceTypes: [NumRaceTypes]RaceType{
+		RaceTypeChampionship: {Name: "CHAMPIONSHIP RACE"},
+		RaceTypeSingle:       {Name: "SINGLE RACE"},
+		RaceTypeTimeTrial:    {Name: "TIME TRIAL"},
+	},
+	Pilots: [NumPilots]Pilot{
+		PilotJohnDekka:           {Name: "JOHN DEKKA", Portrait: "data/textures/dekka.cmp", LogoModel: 0, Team: int(TeamAGSystems)},
+		PilotDanielChang:         {Name: "DANIEL CHANG", Portrait: "data/textures/chang.cmp", LogoModel: 4, Team: int(TeamAGSystems)},
+		PilotArialTetsuo:         {Name: "ARIAL TETSUO", Portrait: "data/textures/arial.cmp", LogoModel: 3, Team: int(TeamAuricom)},
+		PilotAnastasiaCherovoski: {Name: "ANASTASIA CHEROVOSKI", Portrait: "data/textures/anast.cmp", LogoModel: 7, Team: int(TeamAuricom)},
+		PilotKelSolaar:           {Name: "KEL SOLAAR", Portrait: "data/textures/solar.cmp", LogoModel: 2, Team: int(TeamQirex)},
+		PilotArianTetsuo:         {Name: "ARIAN TETSUO", Portrait: "data/textures/arian.cmp", LogoModel: 5, Team: int(TeamQirex)},
+		PilotSofiaDeLaRente:      {Name: "SOFIA DE LA RENTE", Portrait: "data/textures/sophi.cmp", LogoModel: 1, Team: int(TeamFeisar)},
+		PilotPaulJackson:         {Name: "PAUL JACKSON", Portrait: "data/textures/paul.cmp", LogoModel: 6, Team: int(TeamFeisar)},
+	},
+	Teams: [NumTeams]Team{
+		TeamAGSystems: {
+			Name:      "AG SYSTEMS",
+			LogoModel: 2,
+			TeamAttributes: [NumRaceClasses]TeamAttributes{
+				RaceClassVenom:  {Mass: 150, ThrustMax: 790, Resistance: 140, TurnRate: 160, TurnRateMax: 2560, Skid: 12},
+				RaceClassRapier: {Mass: 150, ThrustMax: 1200, Resistance: 140, TurnRate: 160, TurnRateMax: 2560, Skid: 10},
+			},
+		},
+		TeamAuricom: {
+			Name:      "AURICOM",
+			LogoModel: 3,
+			TeamAttributes: [NumRaceClasses]TeamAttributes{
+				RaceClassVenom:  {Mass: 150, ThrustMax: 850, Resistance: 134, TurnRate: 140, TurnRateMax: 1920, Skid: 20},
+				RaceClassRapier: {Mass: 150, ThrustMax: 1400, Resistance: 140, TurnRate: 120, TurnRateMax: 1920, Skid: 14},
+			},
+		},
+		TeamQirex: {
+			Name:      "QIREX",
+			LogoModel: 1,
+			TeamAttributes: [NumRaceClasses]TeamAttributes{
+				RaceClassVenom:  {Mass: 150, ThrustMax: 850, Resistance: 140, TurnRate: 120, TurnRateMax: 1920, Skid: 24},
+				RaceClassRapier: {Mass: 150, ThrustMax: 1400, Resistance: 130, TurnRate: 120, TurnRateMax: 1920, Skid: 16},
+			},
+		},
+		TeamFeisar: {
+			Name:      "FEISAR",
+			LogoModel: 0,
+			TeamAttributes: [NumRaceClasses]TeamAttributes{
+				RaceClassVenom:  {Mass: 150, ThrustMax: 790, Resistance: 140, TurnRate: 180, TurnRateMax: 2560, Skid: 12},
+				RaceClassRapier: {Mass: 150, ThrustMax: 1200, Resistance: 140, TurnRate: 180, TurnRateMax: 2560, Skid: 10},
+			},
+		},
+	},
+	AiSettings: [NumRaceClasses][NumAIOpponents]AiSetting{
+		RaceClassVenom: {
+			{ThrustMax: 2550, ThrustMagnitude: 44, FightBack: true},
+			{ThrustMax: 2600, ThrustMagnitude: 45, FightBack: true},
+			{ThrustMax: 2630, ThrustMagnitude: 45, FightBack: true},
+			{ThrustMax: 2660, ThrustMagnitude: 45, FightBack: true},
+			{ThrustMax: 2700, ThrustMagnitude: 45, FightBack: true},
+			{ThrustMax: 2720, ThrustMagnitude: 45, FightBack: true},
+			{ThrustMax: 2750, ThrustMagnitude: 45, FightBack: true},
+		},
+		RaceClassRapier: {
+			{ThrustMax: 3750, ThrustMagnitude: 50, FightBack: true},
+			{ThrustMax: 3780, ThrustMagnitude: 53, FightBack: true},
+			{ThrustMax: 3800, ThrustMagnitude: 55, FightBack: true},
+			{ThrustMax: 3850, ThrustMagnitude: 55, FightBack: true},
+			{ThrustMax: 3900, ThrustMagnitude: 55, FightBack: true},
+			{ThrustMax: 3950, ThrustMagnitude: 57, FightBack: true},
+			{ThrustMax: 4000, ThrustMagnitude: 60, FightBack: true},
+		},
+	},
+	Circuits: [NumCircuits]Circuit{
+		CircuitAltimaVII: {
+			Name: "ALTIMA VII",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track02/", StartLinePos: 27, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -2520},
+				RaceClassRapier: {Path: "data/track03/", StartLinePos: 27, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -1930},
+			},
+		},
+		CircuitKarbonisV: {
+			Name: "KARBONIS V",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track04/", StartLinePos: 16, BehindSpeed: 300, SpreadBase: 190, SpreadFactor: 250, SkyYOffset: -5000},
+				RaceClassRapier: {Path: "data/track05/", StartLinePos: 16, BehindSpeed: 500, SpreadBase: 190, SpreadFactor: 250, SkyYOffset: -5000},
+			},
+		},
+		CircuitTerramax: {
+			Name: "TERRAMAX",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track01/", StartLinePos: 27, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -820},
+				RaceClassRapier: {Path: "data/track06/", StartLinePos: 27, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -820},
+			},
+		},
+		CircuitKorodera: {
+			Name: "KORODERA",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track12/", StartLinePos: 16, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -2520},
+				RaceClassRapier: {Path: "data/track07/", StartLinePos: 16, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -1930},
+			},
+		},
+		CircuitArridosIV: {
+			Name: "ARRIDOS IV",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track08/", StartLinePos: 16, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -40},
+				RaceClassRapier: {Path: "data/track11/", StartLinePos: 16, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -40},
+			},
+		},
+		CircuitSilverstream: {
+			Name: "SILVERSTREAM",
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track13/", StartLinePos: 16, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -2700},
+				RaceClassRapier: {Path: "data/track09/", StartLinePos: 16, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: -2700},
+			},
+		},
+		CircuitFirestar: {
+			Name:           "FIRESTAR",
+			IsBonusCircuit: true,
+			Settings: [NumRaceClasses]CircuitSettings{
+				RaceClassVenom:  {Path: "data/track14/", StartLinePos: 27, BehindSpeed: 300, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: 0},
+				RaceClassRapier: {Path: "data/track10/", StartLinePos: 27, BehindSpeed: 500, SpreadBase: 90, SpreadFactor: 150, SkyYOffset: 0},
+			},
+		},
+	},
+	ShipModelToPilot: [NumPilots]int{6, 4, 7, 1, 5, 2, 3, 0},
+	RaceModeForRank:  [NumPilots]int{9, 7, 5, 3, 2, 1, 0, 0},
+	MusicTracks: [NumMusicTracks]MusicTrack{
+		{Path: "data/music/track01.qoa", Name: "CAIRODROME"},
+		{Path: "data/music/track02.qoa", Name: "CARDINAL DANCER"},
+		{Path: "data/music/track03.qoa", Name: "COLD COMFORT"},
+		{Path: "data/music/track04.qoa", Name: "DOH T"},
+		{Path: "data/music/track05.qoa", Name: "MESSIJ"},
+		{Path: "data/music/track06.qoa", Name: "OPERATIQUE"},
+		{Path: "data/music/track07.qoa", Name: "TENTATIVE"},
+		{Path: "data/music/track08.qoa", Name: "TRANCEVAAL"},
+		{Path: "data/music/track09.qoa", Name: "AFRO RIDE"},
+		{Path: "data/music/track10.qoa", Name: "CHEMICAL BEATS"},
+		{Path: "data/music/track11.qoa", Name: "WIPEOUT"},
+	},
+}
+
+func init() {
+	for i := range Def.Pilots {
+		team := &Def.Teams[Def.Pilots[i].Team]
+		for j := range team.Pilots {
+			if team.Pilots[j].Name == "" {
+				team.Pilots[j] = Def.Pilots[i]
+				break
+			}
+		}
+	}
+}
+
 type (
 	Init   func()
 	Update func()
@@ -234,12 +396,22 @@ type (
 type GameScene interface {
 	Init() error
 	Update() error
+	// Cleanup releases what Init acquired, when leaving the scene
+	Cleanup()
 }
 
+// saveRetryInterval is the time in seconds before a failed save is written
+// again
+const saveRetryInterval = 5.0
+
 type Game struct {
-	save 	  Save
+	save      Save
+	savePath  string
 	FrameTime float64
 	FrameRate float64
+	// TickLast is the scaled duration of the last system tick, scenes use it
+	// to advance fixed step simulations
+	TickLast float64
 
 	RaceClass     int
 	RaceType      int
@@ -249,6 +421,8 @@ type Game struct {
 	Circuit       int
 	IsAttractMode bool
 	ShowCredits   bool
+	// Seed drives all randomness of a race so it can be reproduced
+	Seed int64
 
 	IsNewLapRecord  bool
 	IsNewRaceRecord bool
@@ -266,45 +440,138 @@ type Game struct {
 
 	GameScenes map[GameSceneE]GameScene
 
-	GlobalTextureLen int
+	championship *Championship
+
+	// replay is played back by the next race instead of the user's input
+	replay *Replay
+	// LastReplay is the recording of the last race the player finished
+	LastReplay *Replay
+
+	// saveRetry is the time before which a failed save is not written again,
+	// saveFailed keeps its error from being logged on every attempt
+	saveRetry  float64
+	saveFailed bool
 
 	// TODO add camera droid ship and track
 
-	render   *engine.Render
-	platform *engine.PlatformSdl
+	render   engine.RenderBackend
+	audio    *engine.Mixer
+	sfx      *SoundBank
+	music    *MusicPlayer
+	platform engine.Platform
 	ui       *UI
 }
 
-func NewGame(render *engine.Render, platform *engine.PlatformSdl) (*Game, error) {
+func NewGame(render engine.RenderBackend, audio *engine.Mixer, platform engine.Platform) (*Game, error) {
 	Logger = log.New(os.Stderr, "game   |", log.Ldate|log.Ltime)
 	Logger.Println("Init")
 	ui := NewUI(render)
 
+	savePath, err := SavePath()
+	if err != nil {
+		Logger.Printf("save: %s, settings will not persist", err)
+	}
+	save := NewSave()
+	if savePath != "" {
+		save, err = SaveLoad(savePath)
+		if err != nil {
+			Logger.Printf("save: %s, using defaults", err)
+		}
+	}
+
 	return &Game{
-		render:           render,
-		platform:         platform,
-		ui:               ui,
-		CurrentScene:     GameSceneNone,
-		NextScene:        GameSceneNone,
-		GlobalTextureLen: 0,
+		save:         save,
+		savePath:     savePath,
+		render:       render,
+		audio:        audio,
+		music:        NewMusicPlayer(audio, time.Now().UnixNano()),
+		platform:     platform,
+		ui:           ui,
+		CurrentScene: GameSceneNone,
+		NextScene:    GameSceneNone,
 	}, nil
 }
 
 func (g *Game) Init(startTime float64) error {
-	// TODO uncomment when save is ready
-	//g.platform.SetFullscreen(g.save.Fullscreen)
+	err := g.platform.SetFullscreen(g.save.Fullscreen)
+	if err != nil {
+		Logger.Printf("fullscreen: %s", err)
+	}
 	g.render.SetResolution(engine.RenderResolution(g.save.ScreenRes))
-	g.render.SetPostEffect(engine.RenderPostEffect(g.save.PostEffect))
+	g.render.SetPsx(engine.RenderPsx(g.save.PsxMode))
+	g.render.SetFov(engine.RenderFov(g.save.FovMode), float32(g.save.Fov))
+	if err := g.render.SetPostEffect(g.save.PostEffect); err != nil {
+		Logger.Printf("post effect: %s", err)
+	}
+	g.audio.SetSfxVolume(g.save.SfxVolume)
+	g.audio.SetMusicVolume(g.save.MusicVolume)
 
-	// err := g.ui.Load()
-	// if err != nil {
-	// 	return err
-	// }
+	err = g.ui.Load()
+	if err != nil {
+		Logger.Printf("ui: %s", err)
+	}
+	g.loadSfx()
+	err = g.music.Next()
+	if err != nil {
+		Logger.Printf("music: %s", err)
+	}
 
-	g.GlobalTextureLen = g.render.TexturesLen()
+	// System bindings for the menus, these can not be changed by the user
+	menuBindings := []struct {
+		button engine.Button
+		action Action
+	}{
+		{engine.InputKeyUp, AMenuUp},
+		{engine.InputKeyDown, AMenuDown},
+		{engine.InputKeyLeft, AMenuLeft},
+		{engine.InputKeyRight, AMenuRight},
+		{engine.InputKeyBackspace, AMenuBack},
+		{engine.InputKeyC, AMenuBack},
+		{engine.InputKeyV, AMenuBack},
+		{engine.InputKeyX, AMenuSelect},
+		{engine.InputKeyReturn, AMenuStart},
+		{engine.InputKeyEscape, AMenuQuit},
+
+		{engine.InputGamepadDpadUp, AMenuUp},
+		{engine.InputGamepadDpadDown, AMenuDown},
+		{engine.InputGamepadDpadLeft, AMenuLeft},
+		{engine.InputGamepadDpadRight, AMenuRight},
+		{engine.InputGamepadLStickUp, AMenuUp},
+		{engine.InputGamepadLStickDown, AMenuDown},
+		{engine.InputGamepadLStickLeft, AMenuLeft},
+		{engine.InputGamepadLStickRight, AMenuRight},
+		{engine.InputGamepadX, AMenuBack},
+		{engine.InputGamepadB, AMenuBack},
+		{engine.InputGamepadA, AMenuSelect},
+		{engine.InputGamepadStart, AMenuStart},
+		{engine.InputGamepadSelect, AMenuQuit},
+		{engine.InputGamepadHome, AMenuQuit},
+
+		{engine.InputKeyPageDown, AMusicNext},
+		{engine.InputKeyPageUp, AMusicPrev},
+
+		{engine.InputKeyF12, AScreenshot},
+		{engine.InputKeyF10, AScreenshotBackBuffer},
+		{engine.InputKeyF9, ARecord},
+	}
+	for _, b := range menuBindings {
+		engine.InputBind(engine.InputLayerSystem, b.button, byte(b.action))
+	}
+
+	// User defined, loaded from the save struct
+	for action := range g.save.Buttons {
+		for _, button := range g.save.Buttons[action] {
+			if button != engine.InputInvalid {
+				engine.InputBind(engine.InputLayerUser, button, byte(action))
+			}
+		}
+	}
 
 	g.GameScenes = make(map[GameSceneE]GameScene)
-	g.GameScenes[GameSceneTitle] = NewTitleScene(startTime, g.render)
+	g.GameScenes[GameSceneTitle] = NewTitleScene(startTime, g)
+	g.GameScenes[GameSceneMainMenu] = NewMainMenuScene(g)
+	g.GameScenes[GameSceneHighscores] = NewHighscoresScene(g)
+	g.GameScenes[GameSceneRace] = NewRaceScene(g)
 
 	g.SetScene(GameSceneTitle)
 
@@ -312,16 +579,81 @@ func (g *Game) Init(startTime float64) error {
 }
 
 func (g *Game) SetScene(scene GameSceneE) {
-	// TODO reset sfx
+	if _, ok := g.GameScenes[scene]; !ok && scene != GameSceneNone {
+		Logger.Printf("scene %s not available", scene)
+		return
+	}
 	g.NextScene = scene
 
 	Logger.Println(g.NextScene)
 }
 
+// PlayReplay sets up the race of rp and starts it with the recorded input
+func (g *Game) PlayReplay(rp *Replay) {
+	g.Seed = rp.Seed
+	g.Circuit = rp.Circuit
+	g.RaceClass = rp.RaceClass
+	g.RaceType = rp.RaceType
+	g.Team = rp.Team
+	g.Pilot = rp.Pilot
+	g.championship = nil
+	g.replay = rp
+	g.SetScene(GameSceneRace)
+}
+
+// updateMusic handles the track skip actions and shows the name of a new
+// track over the scene
+func (g *Game) updateMusic(tickLast float64) {
+	var err error
+	if engine.InputPressed(byte(AMusicNext)) {
+		err = g.music.Next()
+	} else if engine.InputPressed(byte(AMusicPrev)) {
+		err = g.music.Prev()
+	}
+	if err != nil {
+		Logger.Printf("music: %s", err)
+	}
+
+	err = g.music.Update(tickLast)
+	if err != nil {
+		Logger.Printf("music: %s", err)
+	}
+	g.music.Draw(g.ui)
+}
+
+// highscoreTab returns the highscore table the current race type counts for
+func (g *Game) highscoreTab() HighscoreTab {
+	if RaceTypeE(g.RaceType) == RaceTypeTimeTrial {
+		return HighscoreTabTimeTrial
+	}
+	return HighscoreTabRace
+}
+
 type ResetCycleTime bool
 
-func (g *Game) Update() ResetCycleTime {
+// writeSave stores the save if it changed. A failed write is retried after
+// saveRetryInterval, and only its first error is logged.
+func (g *Game) writeSave(now float64) {
+	if !g.save.IsDirty || g.savePath == "" || now < g.saveRetry {
+		return
+	}
+
+	err := g.save.Write(g.savePath)
+	if err != nil {
+		if !g.saveFailed {
+			Logger.Printf("save: %s", err)
+		}
+		g.saveFailed = true
+		g.saveRetry = now + saveRetryInterval
+		return
+	}
+	g.saveFailed = false
+	g.saveRetry = 0
+}
+
+func (g *Game) Update(tickLast float64) ResetCycleTime {
 	frameStartTime := g.platform.Now()
+	g.TickLast = tickLast
 	resetCycleTime := false
 
 	sh := int(g.render.Size().Y)
@@ -340,20 +672,33 @@ func (g *Game) Update() ResetCycleTime {
 	g.ui.SetScale(scale)
 
 	if g.NextScene != GameSceneNone {
+		if g.CurrentScene != GameSceneNone {
+			g.GameScenes[g.CurrentScene].Cleanup()
+		}
 		g.CurrentScene = g.NextScene
 		g.NextScene = GameSceneNone
-		g.render.TexturesReset(uint16(g.GlobalTextureLen))
+		if err := g.render.TexturesDefrag(); err != nil {
+			Logger.Printf("textures defrag: %s", err)
+		}
+		g.audio.StopAll()
 		resetCycleTime = true
 
 		if g.CurrentScene != GameSceneNone {
-			g.GameScenes[g.CurrentScene].Init()
+			err := g.GameScenes[g.CurrentScene].Init()
+			if err != nil {
+				Logger.Printf("%s init: %s", g.CurrentScene, err)
+			}
 		}
 	}
 
 	if g.CurrentScene != GameSceneNone {
-		g.GameScenes[g.CurrentScene].Update()
+		err := g.GameScenes[g.CurrentScene].Update()
+		if err != nil {
+			Logger.Printf("%s update: %s", g.CurrentScene, err)
+		}
 	}
 
+	g.updateMusic(tickLast)
 
 	fullscreen := g.platform.IsFullScreen()
 	if fullscreen != g.save.Fullscreen {
@@ -361,7 +706,7 @@ func (g *Game) Update() ResetCycleTime {
 		g.save.IsDirty = true
 	}
 
-	// TODO handle save
+	g.writeSave(g.platform.Now())
 
 	now := g.platform.Now()
 	g.FrameTime = now - frameStartTime
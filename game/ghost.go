@@ -0,0 +1,202 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	GhostMagic    = 0x74736867
+	GhostVersion  = 1
+	GhostDirName  = "ghosts"
+	ghostFrameLen = 6 * 4
+
+	// ghostHeaderSize is magic, version, class, circuit, track checksum, lap
+	// time and the number of frames
+	ghostHeaderSize = 4 + 4 + 2 + 4 + 4 + 4
+)
+
+var (
+	ErrGhostCorrupted = errors.New("ghost data corrupted")
+	ErrGhostTrack     = errors.New("ghost recorded on another track")
+)
+
+// GhostFrame is the transform of the ghost ship at one tick of its lap
+type GhostFrame struct {
+	Position engine.Vec3
+	Angle    engine.Vec3
+}
+
+func (f *GhostFrame) Mat() engine.Mat4 {
+	mat := engine.NewMat4Identity()
+	engine.Mat4SetRollPitchYaw(&mat, f.Angle)
+	engine.Mat4SetTranslation(&mat, f.Position)
+	return mat
+}
+
+// Ghost is the best time trial lap of a class and circuit, one frame per
+// ShipTick from the moment the lap started
+type Ghost struct {
+	RaceClass     int
+	Circuit       int
+	TrackChecksum uint32
+	LapTime       float32
+	Frames        []GhostFrame
+}
+
+// GhostPath returns the location of the ghost of a class and circuit, next
+// to the save file
+func GhostPath(raceClass, circuit int) (string, error) {
+	name := fmt.Sprintf("class%d-circuit%d.ghost", raceClass, circuit)
+	return configPath(GhostDirName, name)
+}
+
+// GhostLoad reads the ghost at path and checks it was recorded for the
+// class and circuit on trk. A missing file is no ghost and no error.
+func GhostLoad(path string, raceClass, circuit int, trk *track.Track) (*Ghost, error) {
+	g := &Ghost{}
+	err := loadChecked(path, g)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.RaceClass != raceClass || g.Circuit != circuit || g.TrackChecksum != trk.Checksum() {
+		return nil, fmt.Errorf("%s: %w", path, ErrGhostTrack)
+	}
+	return g, nil
+}
+
+// Write stores the ghost atomically at path, creating its directory
+func (g *Ghost) Write(path string) error {
+	return writeChecked(path, g)
+}
+
+// At returns the frame at lapTime, or nil once the ghost finished its lap
+func (g *Ghost) At(lapTime float32) *GhostFrame {
+	i := int(math.Round(float64(lapTime / ShipTick)))
+	if i < 0 || i >= len(g.Frames) {
+		return nil
+	}
+	return &g.Frames[i]
+}
+
+// MarshalBinary encodes the ghost as a checked file
+func (g *Ghost) MarshalBinary() ([]byte, error) {
+	bytes, p := checkedFileNew(GhostMagic, GhostVersion, ghostHeaderSize+len(g.Frames)*ghostFrameLen+4)
+
+	putVec3 := func(v engine.Vec3) {
+		engine.PutU32LE(bytes, &p, math.Float32bits(float32(v.X)))
+		engine.PutU32LE(bytes, &p, math.Float32bits(float32(v.Y)))
+		engine.PutU32LE(bytes, &p, math.Float32bits(float32(v.Z)))
+	}
+
+	engine.PutU8(bytes, &p, byte(g.RaceClass))
+	engine.PutU8(bytes, &p, byte(g.Circuit))
+	engine.PutU32LE(bytes, &p, g.TrackChecksum)
+	engine.PutU32LE(bytes, &p, math.Float32bits(g.LapTime))
+	engine.PutU32LE(bytes, &p, uint32(len(g.Frames)))
+	for i := range g.Frames {
+		putVec3(g.Frames[i].Position)
+		putVec3(g.Frames[i].Angle)
+	}
+
+	checkedFileSeal(bytes, &p)
+
+	return bytes, nil
+}
+
+// UnmarshalBinary decodes a ghost written by MarshalBinary
+func (g *Ghost) UnmarshalBinary(bytes []byte) error {
+	if len(bytes) < ghostHeaderSize+4 {
+		return ErrGhostCorrupted
+	}
+	_, p, err := checkedFileOpen(bytes, GhostMagic, GhostVersion, GhostVersion, ErrGhostCorrupted)
+	if err != nil {
+		return err
+	}
+
+	getVec3 := func() engine.Vec3 {
+		x := math.Float32frombits(engine.GetU32LE(bytes, &p))
+		y := math.Float32frombits(engine.GetU32LE(bytes, &p))
+		z := math.Float32frombits(engine.GetU32LE(bytes, &p))
+		return engine.NewVec3(gl.Float(x), gl.Float(y), gl.Float(z))
+	}
+
+	var ng Ghost
+	ng.RaceClass = int(engine.GetU8(bytes, &p))
+	ng.Circuit = int(engine.GetU8(bytes, &p))
+	ng.TrackChecksum = engine.GetU32LE(bytes, &p)
+	ng.LapTime = math.Float32frombits(engine.GetU32LE(bytes, &p))
+	count := int(engine.GetU32LE(bytes, &p))
+	if len(bytes) != ghostHeaderSize+count*ghostFrameLen+4 {
+		return fmt.Errorf("%w: size %d for %d frames", ErrGhostCorrupted, len(bytes), count)
+	}
+
+	ng.Frames = make([]GhostFrame, count)
+	for i := range ng.Frames {
+		ng.Frames[i].Position = getVec3()
+		ng.Frames[i].Angle = getVec3()
+	}
+
+	*g = ng
+
+	return nil
+}
+
+// GhostRecorder samples the ship of a pilot every step of a race and keeps
+// the fastest lap as the ghost
+type GhostRecorder struct {
+	// Best is the fastest lap so far, starting with the ghost loaded for
+	// the race
+	Best *Ghost
+	// Improved is set when a lap beat Best, until the new ghost is saved
+	Improved bool
+
+	race   *Race
+	pilot  *RacePilot
+	lap    int
+	frames []GhostFrame
+}
+
+func NewGhostRecorder(race *Race, pilot *RacePilot, raceClass, circuit int, best *Ghost) *GhostRecorder {
+	if best == nil {
+		best = &Ghost{RaceClass: raceClass, Circuit: circuit, TrackChecksum: race.Track.Checksum()}
+	}
+	return &GhostRecorder{Best: best, race: race, pilot: pilot}
+}
+
+// Step records the pilot's ship; it is meant to be the race's OnStep
+func (gr *GhostRecorder) Step() {
+	p := gr.pilot
+	if p.Lap != gr.lap {
+		time := p.LapTimes[gr.lap]
+		if len(gr.Best.Frames) == 0 || time < gr.Best.LapTime {
+			best := *gr.Best
+			best.LapTime = time
+			best.Frames = gr.frames
+			gr.Best = &best
+			gr.Improved = true
+		}
+		gr.frames = nil
+		gr.lap = p.Lap
+	}
+	if p.Finished {
+		return
+	}
+
+	// Ticks missing at the start of the lap repeat the first sample
+	frame := GhostFrame{Position: p.Ship.Position, Angle: p.Ship.Angle}
+	i := int(math.Round(float64((gr.race.Time - p.LapStart) / ShipTick)))
+	for len(gr.frames) <= i {
+		gr.frames = append(gr.frames, frame)
+	}
+}
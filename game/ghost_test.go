@@ -0,0 +1,105 @@
+package game
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func TestGhostRoundTrip(t *testing.T) {
+	trk := ringTrack(64, testRingRadius, testRingWidth)
+	path := filepath.Join(t.TempDir(), GhostDirName, "ghost")
+
+	want := &Ghost{
+		RaceClass:     int(RaceClassRapier),
+		Circuit:       int(CircuitKarbonisV),
+		TrackChecksum: trk.Checksum(),
+		LapTime:       42.5,
+		Frames: []GhostFrame{
+			{Position: engine.NewVec3(1, 2, 3), Angle: engine.NewVec3(0.1, 0.2, 0.3)},
+			{Position: engine.NewVec3(4, 5, 6), Angle: engine.NewVec3(0.4, 0.5, 0.6)},
+		},
+	}
+	if err := want.Write(path); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	got, err := GhostLoad(path, want.RaceClass, want.Circuit, trk)
+	if err != nil {
+		t.Fatalf("GhostLoad() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GhostLoad() = %+v; want %+v", got, want)
+	}
+
+	if _, err := GhostLoad(path, want.RaceClass, int(CircuitTerramax), trk); !errors.Is(err, ErrGhostTrack) {
+		t.Errorf("ghost of another circuit: %v", err)
+	}
+	other := ringTrack(64, testRingRadius+100, testRingWidth)
+	if _, err := GhostLoad(path, want.RaceClass, want.Circuit, other); !errors.Is(err, ErrGhostTrack) {
+		t.Errorf("ghost of another track: %v", err)
+	}
+
+	ghost, err := GhostLoad(filepath.Join(t.TempDir(), "missing"), 0, 0, trk)
+	if ghost != nil || err != nil {
+		t.Errorf("missing ghost = %v, %v", ghost, err)
+	}
+}
+
+func TestGhostCorrupted(t *testing.T) {
+	g := &Ghost{LapTime: 1, Frames: make([]GhostFrame, 3)}
+	valid, _ := g.MarshalBinary()
+
+	flipped := append([]byte(nil), valid...)
+	flipped[ghostHeaderSize] ^= 0xff
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": valid[:len(valid)-ghostFrameLen],
+		"checksum":  flipped,
+	} {
+		if err := new(Ghost).UnmarshalBinary(data); !errors.Is(err, ErrGhostCorrupted) {
+			t.Errorf("%s: UnmarshalBinary() = %v; want ErrGhostCorrupted", name, err)
+		}
+	}
+}
+
+func TestGhostRecorder(t *testing.T) {
+	r := newTestRace(1)
+	p := r.Pilots[0]
+	gr := NewGhostRecorder(r, p, int(RaceClassVenom), 0, nil)
+	r.OnStep = gr.Step
+
+	for n := 0; n < int(300/ShipTick) && !p.Finished; n++ {
+		r.Step()
+	}
+	if !p.Finished || !gr.Improved {
+		t.Fatalf("finished %v, ghost improved %v", p.Finished, gr.Improved)
+	}
+
+	best := gr.Best
+	if best.LapTime != p.BestLap() || best.TrackChecksum != r.Track.Checksum() {
+		t.Errorf("ghost lap %.3f, checksum %#x; want %.3f, %#x", best.LapTime, best.TrackChecksum, p.BestLap(), r.Track.Checksum())
+	}
+	if n := int(math.Round(float64(best.LapTime / ShipTick))); len(best.Frames) != n {
+		t.Errorf("%d frames for a lap of %d ticks", len(best.Frames), n)
+	}
+	if best.At(0) == nil || best.At(best.LapTime+1) != nil {
+		t.Errorf("frames at the lap start %v and after its end %v", best.At(0), best.At(best.LapTime+1))
+	}
+
+	// A slower lap does not replace the ghost
+	slow := &Ghost{LapTime: best.LapTime / 2, Frames: make([]GhostFrame, 10)}
+	r = newTestRace(1)
+	gr = NewGhostRecorder(r, r.Pilots[0], int(RaceClassVenom), 0, slow)
+	r.OnStep = gr.Step
+	for n := 0; n < int(300/ShipTick) && !r.Pilots[0].Finished; n++ {
+		r.Step()
+	}
+	if gr.Best != slow || gr.Improved {
+		t.Errorf("ghost of %.3f replaced by a slower lap of %.3f", slow.LapTime, gr.Best.LapTime)
+	}
+}
@@ -0,0 +1,157 @@
+package game
+
+import (
+	"strings"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// HighscoreNameLen is the number of characters of a highscore name
+const HighscoreNameLen = saveNameLen - 1
+
+// HighscoreRank returns the index a race time would take in the table of
+// hs, or -1 if it does not qualify. Equal times keep the older entry first.
+func HighscoreRank(hs *HighScores, time float32) int {
+	if time <= 0 {
+		return -1
+	}
+	for i := range hs.Entries {
+		if time < hs.Entries[i].Time {
+			return i
+		}
+	}
+	return -1
+}
+
+// HighscoreInsert puts name and time at their place in hs, moving the
+// entries below down and dropping the last one. It returns the index of
+// the new entry or -1 if the time does not qualify.
+func HighscoreInsert(hs *HighScores, name string, time float32) int {
+	rank := HighscoreRank(hs, time)
+	if rank < 0 {
+		return -1
+	}
+
+	copy(hs.Entries[rank+1:], hs.Entries[rank:len(hs.Entries)-1])
+	hs.Entries[rank] = HighScoreEntry{Name: name, Time: time}
+
+	return rank
+}
+
+// HighscoreLapRecord sets the lap record of hs if lap beats it
+func HighscoreLapRecord(hs *HighScores, lap float32) bool {
+	if lap <= 0 || lap >= hs.LapRecord {
+		return false
+	}
+	hs.LapRecord = lap
+	return true
+}
+
+// nameEntryChars are the characters the gamepad cycles through
+const nameEntryChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// NameEntry collects a highscore name from captured input. Characters come
+// from text input, backspace deletes and return confirms. On a gamepad up
+// and down change the last character, A adds one, B deletes and start
+// confirms. Escape or select cancel and keep the initial name.
+type NameEntry struct {
+	Name      []byte
+	Done      bool
+	Cancelled bool
+
+	initial []byte
+}
+
+func NewNameEntry(initial [saveNameLen]byte) *NameEntry {
+	n := &NameEntry{
+		Name: make([]byte, 0, HighscoreNameLen),
+	}
+	for _, c := range initial[:HighscoreNameLen] {
+		if c == 0 {
+			break
+		}
+		n.Name = append(n.Name, c)
+	}
+	n.initial = append([]byte{}, n.Name...)
+	return n
+}
+
+// Start routes all input to the name entry until it is done
+func (n *NameEntry) Start() {
+	n.Done = false
+	n.Cancelled = false
+	engine.InputCapture(nameEntryCapture, n)
+}
+
+// HandleInput processes one captured button press or character
+func (n *NameEntry) HandleInput(button engine.Button, asciiChar int32) {
+	if n.Done {
+		return
+	}
+
+	switch {
+	case asciiChar >= 'a' && asciiChar <= 'z':
+		n.add(byte(asciiChar - 'a' + 'A'))
+	case asciiChar >= 'A' && asciiChar <= 'Z', asciiChar >= '0' && asciiChar <= '9':
+		n.add(byte(asciiChar))
+	case button == engine.InputKeyBackspace || button == engine.InputGamepadB:
+		if len(n.Name) > 0 {
+			n.Name = n.Name[:len(n.Name)-1]
+		}
+	case button == engine.InputGamepadA:
+		n.add(nameEntryChars[0])
+	case button == engine.InputGamepadDpadUp:
+		n.cycle(1)
+	case button == engine.InputGamepadDpadDown:
+		n.cycle(-1)
+	case button == engine.InputKeyReturn || button == engine.InputGamepadStart:
+		if len(n.Name) > 0 {
+			n.Done = true
+			engine.InputCapture(nil, nil)
+		}
+	case button == engine.InputKeyEscape || button == engine.InputGamepadSelect:
+		n.Name = append(n.Name[:0], n.initial...)
+		n.Done = true
+		n.Cancelled = true
+		engine.InputCapture(nil, nil)
+	}
+}
+
+// Save stores the entered name as the default for the next entry
+func (n *NameEntry) Save(save *Save) {
+	var name [saveNameLen]byte
+	copy(name[:HighscoreNameLen], n.Name)
+	if name != save.HighscoresName {
+		save.HighscoresName = name
+		save.IsDirty = true
+	}
+}
+
+func (n *NameEntry) String() string {
+	return string(n.Name)
+}
+
+func (n *NameEntry) add(c byte) {
+	if len(n.Name) < HighscoreNameLen {
+		n.Name = append(n.Name, c)
+	}
+}
+
+// cycle steps the last character through nameEntryChars, starting a name
+// if there is none
+func (n *NameEntry) cycle(step int) {
+	if len(n.Name) == 0 {
+		n.add(nameEntryChars[0])
+		return
+	}
+	last := &n.Name[len(n.Name)-1]
+	i := strings.IndexByte(nameEntryChars, *last)
+	i = (i + step + len(nameEntryChars)) % len(nameEntryChars)
+	*last = nameEntryChars[i]
+}
+
+func nameEntryCapture(user interface{}, button engine.Button, asciiChar int32) {
+	if n, ok := user.(*NameEntry); ok {
+		n.HandleInput(button, asciiChar)
+	}
+}
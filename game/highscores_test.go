@@ -0,0 +1,176 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func testHighscores() HighScores {
+	return HighScores{
+		LapRecord: 60,
+		Entries: [NumHighscores]HighScoreEntry{
+			{"AAA", 180}, {"BBB", 190}, {"CCC", 200}, {"DDD", 210}, {"EEE", 220},
+		},
+	}
+}
+
+func TestHighscoreInsert(t *testing.T) {
+	tests := []struct {
+		name      string
+		time      float32
+		wantRank  int
+		wantNames string
+	}{
+		{"first", 170, 0, "NEWAAABBBCCCDDD"},
+		{"middle", 195, 2, "AAABBBNEWCCCDDD"},
+		{"last", 215, 4, "AAABBBCCCDDDNEW"},
+		{"equal keeps older first", 190, 2, "AAABBBNEWCCCDDD"},
+		{"too slow", 220, -1, "AAABBBCCCDDDEEE"},
+		{"no time", 0, -1, "AAABBBCCCDDDEEE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := testHighscores()
+			if got := HighscoreInsert(&hs, "NEW", tt.time); got != tt.wantRank {
+				t.Errorf("rank = %d, want %d", got, tt.wantRank)
+			}
+
+			names := ""
+			for i, e := range hs.Entries {
+				names += e.Name
+				if i > 0 && e.Time < hs.Entries[i-1].Time {
+					t.Errorf("entries not sorted at %d", i)
+				}
+			}
+			if names != tt.wantNames {
+				t.Errorf("names = %s, want %s", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestHighscoreLapRecord(t *testing.T) {
+	tests := []struct {
+		lap  float32
+		want bool
+	}{
+		{59, true},
+		{60, false},
+		{61, false},
+		{0, false},
+	}
+
+	for _, tt := range tests {
+		hs := testHighscores()
+		got := HighscoreLapRecord(&hs, tt.lap)
+		if got != tt.want {
+			t.Errorf("lap %.0f: record = %v, want %v", tt.lap, got, tt.want)
+		}
+		if got && hs.LapRecord != tt.lap || !got && hs.LapRecord != 60 {
+			t.Errorf("lap %.0f: lap record = %.0f", tt.lap, hs.LapRecord)
+		}
+	}
+}
+
+// typeName feeds text input and key presses to the captured input
+func typeName(text string, keys ...engine.Button) {
+	for _, c := range text {
+		engine.InputTextInput(c)
+	}
+	for _, key := range keys {
+		engine.InputSetButtonState(key, 1)
+		engine.InputSetButtonState(key, 0)
+	}
+}
+
+func TestNameEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  string
+		text     string
+		keys     []engine.Button
+		want     string
+		wantDone bool
+	}{
+		{"uppercase", "", "ab1", nil, "AB1", false},
+		{"max length", "", "wxyz", nil, "WXY", false},
+		{"ignores symbols", "", "a-b", nil, "AB", false},
+		{"prefilled", "JOE", "", nil, "JOE", false},
+		{"backspace", "JOE", "", []engine.Button{engine.InputKeyBackspace}, "JO", false},
+		{"confirm", "JOE", "", []engine.Button{engine.InputKeyReturn}, "JOE", true},
+		{"confirm empty", "", "", []engine.Button{engine.InputKeyReturn}, "", false},
+		{"gamepad", "", "", []engine.Button{
+			engine.InputGamepadA, engine.InputGamepadDpadUp, engine.InputGamepadDpadUp,
+			engine.InputGamepadA, engine.InputGamepadDpadDown, engine.InputGamepadStart,
+		}, "C9", true},
+		{"gamepad delete", "JOE", "", []engine.Button{engine.InputGamepadB, engine.InputGamepadDpadUp}, "JP", false},
+		{"cancel", "JOE", "x", []engine.Button{engine.InputKeyEscape}, "JOE", true},
+		{"gamepad cancel", "", "ab", []engine.Button{engine.InputGamepadSelect}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer engine.InputCapture(nil, nil)
+
+			var initial [saveNameLen]byte
+			copy(initial[:], tt.initial)
+			n := NewNameEntry(initial)
+			n.Start()
+			typeName(tt.text, tt.keys...)
+
+			if n.String() != tt.want || n.Done != tt.wantDone {
+				t.Errorf("name %q done %v, want %q %v", n.String(), n.Done, tt.want, tt.wantDone)
+			}
+			if tt.wantDone && engine.CaptureCallback != nil {
+				t.Errorf("input still captured after confirming")
+			}
+		})
+	}
+}
+
+func TestNameEntrySave(t *testing.T) {
+	save := NewSave()
+	save.IsDirty = false
+
+	n := NewNameEntry(save.HighscoresName)
+	n.Save(&save)
+	if save.IsDirty {
+		t.Errorf("unchanged name marked the save dirty")
+	}
+
+	n.Name = []byte("ZED")
+	n.Save(&save)
+	if !save.IsDirty || string(save.HighscoresName[:HighscoreNameLen]) != "ZED" || save.HighscoresName[HighscoreNameLen] != 0 {
+		t.Errorf("saved name %q dirty %v", save.HighscoresName, save.IsDirty)
+	}
+}
+
+func TestNameEntryCancelled(t *testing.T) {
+	defer engine.InputCapture(nil, nil)
+
+	g := &Game{save: NewSave(), RaceTime: 100}
+	g.save.IsDirty = false
+	want := g.save.Highscores
+
+	n := NewNameEntry(g.save.HighscoresName)
+	n.Start()
+	typeName("ab", engine.InputKeyEscape)
+
+	r := &RaceScene{g: g, championship: true, nameEntry: n}
+	r.endNameEntry()
+	if g.save.Highscores != want || g.save.IsDirty {
+		t.Errorf("cancelled entry changed the highscores, dirty %v", g.save.IsDirty)
+	}
+	if r.state != raceStateStandings {
+		t.Errorf("state = %v; want the standings", r.state)
+	}
+
+	n.Start()
+	typeName("ab", engine.InputKeyReturn)
+	r.endNameEntry()
+	if g.save.Highscores[0][0][HighscoreTabRace].Entries[0] != (HighScoreEntry{"AB", 100}) || !g.save.IsDirty {
+		t.Errorf("confirmed entry not inserted")
+	}
+}
@@ -0,0 +1,116 @@
+package game
+
+import (
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+var highscoreTabNames = [NumHighscoreTabs]string{
+	HighscoreTabTimeTrial: "TIME TRIAL",
+	HighscoreTabRace:      "RACE",
+}
+
+// HighscoresScene shows the best times and lap record of one class, circuit
+// and tab. Left and right switch the circuit, up and down the tab.
+type HighscoresScene struct {
+	g *Game
+}
+
+func NewHighscoresScene(g *Game) *HighscoresScene {
+	return &HighscoresScene{
+		g: g,
+	}
+}
+
+func (h *HighscoresScene) Init() error {
+	g := h.g
+	if g.RaceClass < 0 || g.RaceClass >= int(NumRaceClasses) {
+		g.RaceClass = int(RaceClassVenom)
+	}
+	g.Circuit = highscoreCircuit(g.Circuit, 0, g.save.HasBonusCircuits != 0)
+	if g.HighscoreTab < 0 || g.HighscoreTab >= int(NumHighscoreTabs) {
+		g.HighscoreTab = int(HighscoreTabTimeTrial)
+	}
+
+	return nil
+}
+
+func (h *HighscoresScene) Cleanup() {
+}
+
+func (h *HighscoresScene) Update() error {
+	g := h.g
+	bonus := g.save.HasBonusCircuits != 0
+
+	if engine.InputPressed(byte(AMenuLeft)) {
+		g.Circuit = highscoreCircuit(g.Circuit, -1, bonus)
+	}
+	if engine.InputPressed(byte(AMenuRight)) {
+		g.Circuit = highscoreCircuit(g.Circuit, 1, bonus)
+	}
+	if engine.InputPressed(byte(AMenuUp)) {
+		g.HighscoreTab = highscoreTabStep(g.HighscoreTab, -1)
+	}
+	if engine.InputPressed(byte(AMenuDown)) {
+		g.HighscoreTab = highscoreTabStep(g.HighscoreTab, 1)
+	}
+	if engine.InputPressed(byte(AMenuBack)) || engine.InputPressed(byte(AMenuQuit)) ||
+		engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuStart)) {
+		g.SetScene(GameSceneMainMenu)
+	}
+
+	g.render.SetView2d()
+	h.draw()
+
+	return nil
+}
+
+func (h *HighscoresScene) draw() {
+	g := h.g
+	ui := g.ui
+	hs := &g.save.Highscores[g.RaceClass][g.Circuit][g.HighscoreTab]
+
+	ui.DrawTextCentered("BEST TIMES", ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 30)), UITextSize16, UIColorAccent)
+	ui.DrawTextCentered(Def.RaceClasses[g.RaceClass].Name, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 56)), UITextSize8, UIColorDefault)
+	ui.DrawTextCentered(Def.Circuits[g.Circuit].Name, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 70)), UITextSize12, UIColorDefault)
+	ui.DrawTextCentered(highscoreTabNames[g.HighscoreTab], ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 88)), UITextSize8, UIColorAccent)
+
+	for i, entry := range hs.Entries {
+		y := int32(-40 + i*20)
+		ui.DrawNumber(i+1, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(-110, y)), UITextSize12, UIColorAccent)
+		ui.DrawText(entry.Name, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(-80, y)), UITextSize12, UIColorDefault)
+		ui.DrawTime(entry.Time, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(20, y)), UITextSize12, UIColorDefault)
+	}
+
+	ui.DrawText("LAP RECORD", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(-110, 72)), UITextSize8, UIColorAccent)
+	ui.DrawTime(hs.LapRecord, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(20, 70)), UITextSize12, UIColorDefault)
+
+	ui.DrawTextCentered("LEFT RIGHT CIRCUIT   UP DOWN MODE", ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -30)), UITextSize8, UIColorDefault)
+}
+
+// highscoreCircuit steps dir circuits from circuit, wrapping around and
+// skipping bonus circuits unless they are unlocked. A dir of 0 only moves
+// off a locked or invalid circuit.
+func highscoreCircuit(circuit, dir int, bonus bool) int {
+	if circuit < 0 || circuit >= int(NumCircuits) {
+		circuit = 0
+	}
+	step := dir
+	if step == 0 {
+		step = 1
+	}
+
+	for n := 0; n < int(NumCircuits); n++ {
+		if dir != 0 || n > 0 {
+			circuit = (circuit + step + int(NumCircuits)) % int(NumCircuits)
+		}
+		if bonus || !Def.Circuits[circuit].IsBonusCircuit {
+			return circuit
+		}
+	}
+	return circuit
+}
+
+// highscoreTabStep moves dir tabs from tab, wrapping around
+func highscoreTabStep(tab, dir int) int {
+	return (tab + dir + int(NumHighscoreTabs)) % int(NumHighscoreTabs)
+}
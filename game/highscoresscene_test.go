@@ -0,0 +1,47 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestHighscoreCircuit(t *testing.T) {
+	last := int(NumCircuits) - 1
+	lastRegular := NumNonBonusCircuits - 1
+
+	tests := []struct {
+		name    string
+		circuit int
+		dir     int
+		bonus   bool
+		want    int
+	}{
+		{"next", 0, 1, false, 1},
+		{"previous wraps", 0, -1, true, last},
+		{"previous skips bonus", 0, -1, false, lastRegular},
+		{"next skips bonus", lastRegular, 1, false, 0},
+		{"next into bonus", lastRegular, 1, true, lastRegular + 1},
+		{"stay", 3, 0, false, 3},
+		{"leave locked", last, 0, false, 0},
+		{"invalid", -4, 0, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highscoreCircuit(tt.circuit, tt.dir, tt.bonus); got != tt.want {
+				t.Errorf("highscoreCircuit(%d, %d, %v) = %d, want %d", tt.circuit, tt.dir, tt.bonus, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighscoreTabStep(t *testing.T) {
+	if got := highscoreTabStep(int(HighscoreTabTimeTrial), 1); got != int(HighscoreTabRace) {
+		t.Errorf("down from time trial = %d", got)
+	}
+	if got := highscoreTabStep(int(HighscoreTabTimeTrial), -1); got != int(HighscoreTabRace) {
+		t.Errorf("up from time trial = %d", got)
+	}
+	if got := highscoreTabStep(int(HighscoreTabRace), 1); got != int(HighscoreTabTimeTrial) {
+		t.Errorf("down from race = %d", got)
+	}
+}
@@ -37,17 +37,32 @@ type PsxTim struct {
 	Rows          int16
 }
 
+// TextureList holds the handles of the textures of one image file, owned by
+// whoever loaded it until Release
 type TextureList struct {
-	start int
-	len   int
+	handles []uint16
 }
 
 func (t *TextureList) Get(index int) (uint16, error) {
-	if index < 0 || index >= t.len {
+	if index < 0 || index >= len(t.handles) {
 
 		return 0, fmt.Errorf("Texture index out of range: %d", index)
 	}
-	return uint16(t.start + index), nil
+	return t.handles[index], nil
+}
+
+func (t *TextureList) Len() int {
+	return len(t.handles)
+}
+
+// Release gives the textures back to render
+func (t *TextureList) Release(render engine.RenderBackend) {
+	for _, handle := range t.handles {
+		if err := render.TextureRelease(int(handle)); err != nil {
+			Logger.Printf("TextureList release: %s", err)
+		}
+	}
+	t.handles = nil
 }
 
 func ImageAlloc(width, height uint32) *Image {
@@ -136,7 +151,7 @@ func ImageLoadFromBytes(bytes []byte, transparent bool) *Image {
 }
 
 
-func ImageGetTexture(name string) uint16 {
+func ImageGetTexture(name string, render engine.RenderBackend) uint16 {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		Logger.Printf("ImageGetTexture-Getwd: %s", err)
@@ -150,7 +165,7 @@ func ImageGetTexture(name string) uint16 {
 		return 0
 	}
 	image := ImageLoadFromBytes(data, false)
-	texture, err := engine.RenderInstance.TextureCreate(int(image.Width), int(image.Height), image.Pixels)
+	texture, err := render.TextureCreate(int(image.Width), int(image.Height), image.Pixels)
 	if err != nil {
 		Logger.Printf("ImageGetTexture: %s", err)
 		return 0
@@ -159,21 +174,23 @@ func ImageGetTexture(name string) uint16 {
 	return uint16(texture)
 }
 
-func ImageGetCompressedTexture(name string, render *engine.Render) (TextureList, error) {
+func ImageGetCompressedTexture(name string, render engine.RenderBackend) (TextureList, error) {
 	currentDir, _ := os.Getwd()
 	filePath := filepath.Join(currentDir, name)
 	cmp, err := imageLoadCompressed(filePath)
 	if err != nil {
 		return TextureList{}, err
 	}
-	tl := TextureList{
-		start: render.TexturesLen(),
-		len:   int(cmp.Len),
-	}
+	tl := TextureList{handles: make([]uint16, 0, cmp.Len)}
 
 	for i := 0; i < int(cmp.Len); i++ {
 		image := ImageLoadFromBytes(cmp.Entries[i], false)
-		render.TextureCreate(int(image.Width), int(image.Height), image.Pixels)
+		texture, err := render.TextureCreate(int(image.Width), int(image.Height), image.Pixels)
+		if err != nil {
+			tl.Release(render)
+			return TextureList{}, err
+		}
+		tl.handles = append(tl.handles, uint16(texture))
 	}
 
 	return tl, nil
@@ -200,11 +217,12 @@ func tim16BitToRGBA(c uint16, transparentBit bool) engine.RGBA {
 
 
 func TextureFromList(tl TextureList, index int) int {
-	if index >= tl.len {
-		Logger.Printf("texture %d not in list of len %d", index, tl.len)
+	t, err := tl.Get(index)
+	if err != nil {
+		Logger.Printf("texture %d not in list of len %d", index, tl.Len())
 	}
 
-	return tl.start + index
+	return int(t)
 }
 
 type cmpT struct {
@@ -0,0 +1,325 @@
+package game
+
+import (
+	"strings"
+	"time"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// optionsFovMin is the field of view of the first of optionsFov
+const optionsFovMin = 60
+
+var (
+	optionsOffOn      = []string{"OFF", "ON"}
+	optionsResolution = []string{"NATIVE", "240P", "480P"}
+	optionsPsx        = []string{"OFF", "ON", "UNFILTERED"}
+	optionsFovMode    = []string{"HOR+", "VERTICAL", "4:3"}
+	optionsFov        = []string{"60", "70", "80", "90", "100", "110", "120"}
+	optionsUiScale    = []string{"AUTO", "1X", "2X", "3X", "4X"}
+	optionsVolume     = []string{"0", "10", "20", "30", "40", "50", "60", "70", "80", "90", "100"}
+)
+
+// MainMenuScene walks the player through race class, race type, team, pilot
+// and circuit selection and starts the race.
+type MainMenuScene struct {
+	g    *Game
+	menu *Menu
+}
+
+func NewMainMenuScene(g *Game) *MainMenuScene {
+	menu := NewMenu(g.ui)
+	menu.Sfx = func(sfx SfxE) {
+		g.PlaySfx(sfx)
+	}
+
+	return &MainMenuScene{
+		g:    g,
+		menu: menu,
+	}
+}
+
+func (m *MainMenuScene) Init() error {
+	m.menu.Reset()
+	m.pushMain()
+
+	return nil
+}
+
+func (m *MainMenuScene) Cleanup() {
+}
+
+func (m *MainMenuScene) Update() error {
+	m.g.render.SetView2d()
+	return m.menu.Update()
+}
+
+func (m *MainMenuScene) pushMain() {
+	page := m.menu.Push("", nil)
+	if page == nil {
+		return
+	}
+	page.Layout = MenuVertical | MenuFixed | MenuAlignCenter
+	page.ItemsPos = engine.NewVec2i(0, -110)
+	page.ItemsAnchor = UIPosCenter | UIPosBottom
+
+	page.AddButton("START GAME", 0, func(menu *Menu, data int) {
+		m.pushRaceClass()
+	})
+	page.AddButton("BEST TIMES", 0, func(menu *Menu, data int) {
+		m.pushBestTimes()
+	})
+	page.AddButton("OPTIONS", 0, func(menu *Menu, data int) {
+		m.pushOptions()
+	})
+	page.AddButton("QUIT", 0, func(menu *Menu, data int) {
+		menu.Confirm("ARE YOU SURE YOU", "WANT TO QUIT", "YES", "NO", func(menu *Menu, data int) {
+			m.g.platform.Exit()
+		}, 0)
+	})
+}
+
+func (m *MainMenuScene) pushRaceClass() {
+	page := m.menu.Push("SELECT RACING CLASS", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignCenter
+
+	for i := RaceClassE(0); i < NumRaceClasses; i++ {
+		if i == RaceClassRapier && m.g.save.HasRapierClass == 0 {
+			continue
+		}
+		page.AddButton(Def.RaceClasses[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.RaceClass = data
+			m.pushRaceType()
+		})
+	}
+}
+
+func (m *MainMenuScene) pushRaceType() {
+	page := m.menu.Push("SELECT RACE TYPE", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignCenter
+
+	for i := RaceTypeE(0); i < NumRaceTypes; i++ {
+		page.AddButton(Def.RaceTypes[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.RaceType = data
+			m.pushTeam()
+		})
+	}
+}
+
+func (m *MainMenuScene) pushTeam() {
+	page := m.menu.Push("SELECT YOUR TEAM", m.drawTeam)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuFixed | MenuAlignCenter
+	page.TitleAnchor = UIPosTop | UIPosCenter
+	page.ItemsAnchor = UIPosTop | UIPosCenter
+	page.TitlePos = engine.NewVec2i(0, 30)
+	page.ItemsPos = engine.NewVec2i(0, 60)
+
+	for i := TeamE(0); i < NumTeams; i++ {
+		page.AddButton(Def.Teams[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.Team = data
+			m.pushPilot()
+		})
+	}
+}
+
+// drawTeam shows the attributes of the highlighted team for the selected class.
+func (m *MainMenuScene) drawTeam(menu *Menu, data int) {
+	ui := m.g.ui
+	attr := &Def.Teams[data].TeamAttributes[m.g.RaceClass]
+
+	stats := []struct {
+		name  string
+		value float32
+	}{
+		{"MASS", attr.Mass},
+		{"THRUST", attr.ThrustMax},
+		{"RESISTANCE", attr.Resistance},
+		{"TURN RATE", attr.TurnRate},
+		{"SKID", attr.Skid},
+	}
+
+	pos := engine.NewVec2i(-80, -50)
+	for _, stat := range stats {
+		ui.DrawText(stat.name, ui.ScaledPos(UIPosBottom|UIPosCenter, pos), UITextSize8, UIColorDefault)
+		valuePos := engine.NewVec2i(pos.X+160-int32(numberWidth(int(stat.value), UITextSize8)), pos.Y)
+		ui.DrawNumber(int(stat.value), ui.ScaledPos(UIPosBottom|UIPosCenter, valuePos), UITextSize8, UIColorAccent)
+		pos.Y += 10
+	}
+}
+
+func (m *MainMenuScene) pushPilot() {
+	page := m.menu.Push("CHOOSE YOUR PILOT", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignCenter
+
+	for i := PilotE(0); i < NumPilots; i++ {
+		if Def.Pilots[i].Team != m.g.Team {
+			continue
+		}
+		page.AddButton(Def.Pilots[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.Pilot = data
+			if RaceTypeE(m.g.RaceType) == RaceTypeChampionship {
+				m.g.startChampionship()
+				m.startRace()
+				return
+			}
+			m.g.championship = nil
+			m.pushCircuit()
+		})
+	}
+}
+
+func (m *MainMenuScene) pushCircuit() {
+	page := m.menu.Push("SELECT RACING CIRCUIT", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignCenter
+
+	for i := CircuitE(0); i < NumCircuits; i++ {
+		if Def.Circuits[i].IsBonusCircuit && m.g.save.HasBonusCircuits == 0 {
+			continue
+		}
+		page.AddButton(Def.Circuits[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.Circuit = data
+			m.startRace()
+		})
+	}
+}
+
+func (m *MainMenuScene) startRace() {
+	m.g.IsAttractMode = false
+	m.g.Seed = time.Now().UnixNano()
+	m.g.SetScene(GameSceneRace)
+}
+
+func (m *MainMenuScene) pushBestTimes() {
+	page := m.menu.Push("VIEW BEST TIMES", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignCenter
+
+	for i := RaceClassE(0); i < NumRaceClasses; i++ {
+		if i == RaceClassRapier && m.g.save.HasRapierClass == 0 {
+			continue
+		}
+		page.AddButton(Def.RaceClasses[i].Name, int(i), func(menu *Menu, data int) {
+			m.g.RaceClass = data
+			m.g.SetScene(GameSceneHighscores)
+		})
+	}
+}
+
+func (m *MainMenuScene) pushOptions() {
+	g := m.g
+	page := m.menu.Push("OPTIONS", nil)
+	if page == nil {
+		return
+	}
+	page.Layout |= MenuAlignBlock
+	page.BlockWidth = 200
+
+	page.AddToggle("FULLSCREEN", boolToInt(g.save.Fullscreen), optionsOffOn, func(menu *Menu, data int) {
+		g.save.Fullscreen = data == 1
+		g.save.IsDirty = true
+		err := g.platform.SetFullscreen(g.save.Fullscreen)
+		if err != nil {
+			Logger.Printf("fullscreen: %s", err)
+		}
+	})
+	page.AddToggle("SCREEN RESOLUTION", g.save.ScreenRes, optionsResolution, func(menu *Menu, data int) {
+		g.save.ScreenRes = data
+		g.save.IsDirty = true
+		g.render.SetResolution(engine.RenderResolution(data))
+	})
+	postEffects := g.render.PostEffects()
+	postEffect := 0
+	optionsPostEffect := make([]string, len(postEffects))
+	for i, name := range postEffects {
+		optionsPostEffect[i] = strings.ToUpper(name)
+		if name == g.save.PostEffect {
+			postEffect = i
+		}
+	}
+	page.AddToggle("POST PROCESSING", postEffect, optionsPostEffect, func(menu *Menu, data int) {
+		g.save.PostEffect = postEffects[data]
+		g.save.IsDirty = true
+		err := g.render.SetPostEffect(postEffects[data])
+		if err != nil {
+			Logger.Printf("post effect: %s", err)
+		}
+	})
+	page.AddToggle("PSX RENDERING", g.save.PsxMode, optionsPsx, func(menu *Menu, data int) {
+		g.save.PsxMode = data
+		g.save.IsDirty = true
+		g.render.SetPsx(engine.RenderPsx(data))
+	})
+	page.AddToggle("FIELD OF VIEW MODE", g.save.FovMode, optionsFovMode, func(menu *Menu, data int) {
+		g.save.FovMode = data
+		g.save.IsDirty = true
+		g.render.SetFov(engine.RenderFov(data), float32(g.save.Fov))
+	})
+	page.AddToggle("FIELD OF VIEW", fovToOption(g.save.Fov), optionsFov, func(menu *Menu, data int) {
+		g.save.Fov = optionToFov(data)
+		g.save.IsDirty = true
+		g.render.SetFov(engine.RenderFov(g.save.FovMode), float32(g.save.Fov))
+	})
+	page.AddToggle("SHOW FPS", boolToInt(g.save.ShowFps), optionsOffOn, func(menu *Menu, data int) {
+		g.save.ShowFps = data == 1
+		g.save.IsDirty = true
+	})
+	page.AddToggle("UI SIZE", int(g.save.UiScale), optionsUiScale, func(menu *Menu, data int) {
+		g.save.UiScale = byte(data)
+		g.save.IsDirty = true
+	})
+	page.AddToggle("SOUND EFFECTS VOLUME", volumeToOption(g.save.SfxVolume), optionsVolume, func(menu *Menu, data int) {
+		g.save.SfxVolume = optionToVolume(data)
+		g.save.IsDirty = true
+		g.audio.SetSfxVolume(g.save.SfxVolume)
+	})
+	page.AddToggle("MUSIC VOLUME", volumeToOption(g.save.MusicVolume), optionsVolume, func(menu *Menu, data int) {
+		g.save.MusicVolume = optionToVolume(data)
+		g.save.IsDirty = true
+		g.audio.SetMusicVolume(g.save.MusicVolume)
+	})
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// volumeToOption returns the entry of optionsVolume closest to volume
+func volumeToOption(volume float32) int {
+	option := int(volume*float32(len(optionsVolume)-1) + 0.5)
+	return engine.Clamp(option, 0, len(optionsVolume)-1)
+}
+
+func optionToVolume(option int) float32 {
+	return float32(option) / float32(len(optionsVolume)-1)
+}
+
+// fovToOption returns the option nearest to the field of view in degrees,
+// the options are 10 degrees apart
+func fovToOption(fov int) int {
+	option := (fov - optionsFovMin + 5) / 10
+	return engine.Clamp(option, 0, len(optionsFov)-1)
+}
+
+func optionToFov(option int) int {
+	return optionsFovMin + option*10
+}
@@ -0,0 +1,346 @@
+package game
+
+import (
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+const (
+	MenuPagesMax = 8
+
+	menuItemSpacing  = 12
+	menuTitleSpacing = 20
+	menuButtonWidth  = 60
+)
+
+type MenuEntryType int
+
+const (
+	MenuEntryButton MenuEntryType = iota
+	MenuEntryToggle
+)
+
+type MenuLayout int
+
+const (
+	MenuVertical MenuLayout = 1 << iota
+	MenuHorizontal
+	MenuFixed
+	MenuAlignCenter
+	MenuAlignBlock
+)
+
+// MenuCallback is invoked when an entry is selected or a toggle changes.
+// For toggles data is the new option index, for buttons the entry's Data.
+type MenuCallback func(menu *Menu, data int)
+
+// MenuDraw is invoked every frame before the entries are drawn, with the
+// Data of the currently highlighted entry.
+type MenuDraw func(menu *Menu, data int)
+
+type MenuEntry struct {
+	Text    string
+	Type    MenuEntryType
+	Data    int
+	Options []string
+	Select  MenuCallback
+}
+
+type MenuPage struct {
+	Title       string
+	Subtitle    string
+	Layout      MenuLayout
+	Draw        MenuDraw
+	Entries     []MenuEntry
+	Index       int
+	BlockWidth  int32
+	TitlePos    engine.Vec2i
+	TitleAnchor UIPos
+	ItemsPos    engine.Vec2i
+	ItemsAnchor UIPos
+}
+
+// Menu is a stack of pages. The top page receives input and is drawn, going
+// back pops it and returns to the page below.
+type Menu struct {
+	pages []*MenuPage
+	ui    *UI
+
+	// Sfx plays the sound of moving and selecting when set
+	Sfx func(sfx SfxE)
+}
+
+func NewMenu(ui *UI) *Menu {
+	return &Menu{
+		pages: make([]*MenuPage, 0, MenuPagesMax),
+		ui:    ui,
+	}
+}
+
+func (m *Menu) Reset() {
+	m.pages = m.pages[:0]
+}
+
+// Push adds a new page on top of the stack and returns it so entries can be
+// added. It returns nil when the stack is full; the page is dropped.
+func (m *Menu) Push(title string, draw MenuDraw) *MenuPage {
+	if len(m.pages) >= MenuPagesMax {
+		Logger.Printf("menu: too many pages, dropping %s", title)
+		return nil
+	}
+
+	page := &MenuPage{
+		Title:       title,
+		Layout:      MenuVertical,
+		Draw:        draw,
+		BlockWidth:  150,
+		TitleAnchor: UIPosMiddle | UIPosCenter,
+		ItemsAnchor: UIPosMiddle | UIPosCenter,
+	}
+	m.pages = append(m.pages, page)
+
+	return page
+}
+
+// Confirm pushes a horizontal yes/no page; yes calls cb with data. Like Push
+// it returns nil when the stack is full.
+func (m *Menu) Confirm(title, subtitle, yes, no string, cb MenuCallback, data int) *MenuPage {
+	page := m.Push(title, nil)
+	if page == nil {
+		return nil
+	}
+	page.Subtitle = subtitle
+	page.Layout = MenuHorizontal
+	page.TitlePos = engine.NewVec2i(0, -20)
+	page.ItemsPos = engine.NewVec2i(-menuButtonWidth/2, 20)
+	page.AddButton(no, 0, func(menu *Menu, data int) {
+		menu.Pop()
+	})
+	page.AddButton(yes, data, cb)
+
+	return page
+}
+
+func (m *Menu) Pop() {
+	if len(m.pages) == 0 {
+		return
+	}
+	m.pages = m.pages[:len(m.pages)-1]
+}
+
+// Page returns the page on top of the stack or nil when the menu is empty.
+func (m *Menu) Page() *MenuPage {
+	if len(m.pages) == 0 {
+		return nil
+	}
+	return m.pages[len(m.pages)-1]
+}
+
+func (m *Menu) Depth() int {
+	return len(m.pages)
+}
+
+func (p *MenuPage) AddButton(text string, data int, cb MenuCallback) *MenuEntry {
+	p.Entries = append(p.Entries, MenuEntry{
+		Text:   text,
+		Type:   MenuEntryButton,
+		Data:   data,
+		Select: cb,
+	})
+
+	return &p.Entries[len(p.Entries)-1]
+}
+
+func (p *MenuPage) AddToggle(text string, value int, options []string, cb MenuCallback) *MenuEntry {
+	p.Entries = append(p.Entries, MenuEntry{
+		Text:    text,
+		Type:    MenuEntryToggle,
+		Data:    value,
+		Options: options,
+		Select:  cb,
+	})
+
+	return &p.Entries[len(p.Entries)-1]
+}
+
+// Update handles navigation for the top page and draws it.
+func (m *Menu) Update() error {
+	page := m.Page()
+	if page == nil {
+		return nil
+	}
+
+	selectedData := m.navigate(page)
+
+	if page.Draw != nil {
+		page.Draw(m, selectedData)
+	}
+
+	m.ui.render.SetView2d()
+	err := m.draw(page)
+	if err != nil {
+		return err
+	}
+
+	m.handleInput(page)
+
+	return nil
+}
+
+// navigate moves the highlighted entry and returns its data.
+func (m *Menu) navigate(page *MenuPage) int {
+	if len(page.Entries) == 0 {
+		return 0
+	}
+
+	index := page.Index
+	if page.Layout&MenuHorizontal != 0 {
+		if engine.InputPressed(byte(AMenuLeft)) {
+			page.Index--
+		} else if engine.InputPressed(byte(AMenuRight)) {
+			page.Index++
+		}
+	} else {
+		if engine.InputPressed(byte(AMenuUp)) {
+			page.Index--
+		}
+		if engine.InputPressed(byte(AMenuDown)) {
+			page.Index++
+		}
+	}
+
+	if page.Index >= len(page.Entries) {
+		page.Index = 0
+	}
+	if page.Index < 0 {
+		page.Index = len(page.Entries) - 1
+	}
+	if page.Index != index {
+		m.playSfx(SfxMenuMove)
+	}
+
+	return page.Entries[page.Index].Data
+}
+
+func (m *Menu) playSfx(sfx SfxE) {
+	if m.Sfx != nil {
+		m.Sfx(sfx)
+	}
+}
+
+// handleInput processes back, toggles and selection for the given page.
+func (m *Menu) handleInput(page *MenuPage) {
+	if engine.InputPressed(byte(AMenuBack)) || engine.InputPressed(byte(AMenuQuit)) {
+		if len(m.pages) > 1 {
+			m.playSfx(SfxMenuMove)
+			m.Pop()
+		}
+		return
+	}
+
+	if len(page.Entries) == 0 {
+		return
+	}
+
+	entry := &page.Entries[page.Index]
+	if entry.Type == MenuEntryToggle {
+		if len(entry.Options) == 0 {
+			return
+		}
+		if engine.InputPressed(byte(AMenuLeft)) {
+			entry.Data--
+			if entry.Data < 0 {
+				entry.Data = len(entry.Options) - 1
+			}
+		} else if engine.InputPressed(byte(AMenuRight)) || engine.InputPressed(byte(AMenuSelect)) {
+			entry.Data = (entry.Data + 1) % len(entry.Options)
+		} else {
+			return
+		}
+		m.playSfx(SfxMenuSelect)
+		if entry.Select != nil {
+			entry.Select(m, entry.Data)
+		}
+		return
+	}
+
+	if engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuStart)) {
+		m.playSfx(SfxMenuSelect)
+		if entry.Select != nil {
+			entry.Select(m, entry.Data)
+		}
+	}
+}
+
+func (m *Menu) draw(page *MenuPage) error {
+	ui := m.ui
+
+	if page.Layout&MenuHorizontal != 0 {
+		pos := engine.NewVec2i(0, page.TitlePos.Y)
+		ui.DrawTextCentered(page.Title, ui.ScaledPos(page.TitleAnchor, pos), UITextSize8, UIColorDefault)
+		if page.Subtitle != "" {
+			pos.Y += menuItemSpacing
+			ui.DrawTextCentered(page.Subtitle, ui.ScaledPos(page.TitleAnchor, pos), UITextSize8, UIColorDefault)
+		}
+
+		pos = page.ItemsPos
+		for i := range page.Entries {
+			color := UIColorDefault
+			if i == page.Index {
+				color = UIColorAccent
+			}
+			ui.DrawTextCentered(page.Entries[i].Text, ui.ScaledPos(page.ItemsAnchor, pos), UITextSize16, color)
+			pos.X += menuButtonWidth
+		}
+		return nil
+	}
+
+	titlePos, itemsPos := page.TitlePos, page.ItemsPos
+	if page.Layout&MenuFixed == 0 {
+		height := int32(menuTitleSpacing + len(page.Entries)*menuItemSpacing)
+		titlePos = engine.NewVec2i(0, -height/2)
+		itemsPos = engine.NewVec2i(0, -height/2+menuTitleSpacing)
+		if page.Layout&MenuAlignBlock != 0 {
+			titlePos.X = -page.BlockWidth / 2
+			itemsPos.X = -page.BlockWidth / 2
+		}
+	}
+
+	centered := page.Layout&MenuAlignCenter != 0
+	if centered {
+		ui.DrawTextCentered(page.Title, ui.ScaledPos(page.TitleAnchor, titlePos), UITextSize12, UIColorAccent)
+	} else {
+		ui.DrawText(page.Title, ui.ScaledPos(page.TitleAnchor, titlePos), UITextSize12, UIColorAccent)
+	}
+
+	for i := range page.Entries {
+		entry := &page.Entries[i]
+		color := UIColorDefault
+		if i == page.Index {
+			color = UIColorAccent
+		}
+
+		if centered {
+			ui.DrawTextCentered(entry.Text, ui.ScaledPos(page.ItemsAnchor, itemsPos), UITextSize8, color)
+		} else {
+			ui.DrawText(entry.Text, ui.ScaledPos(page.ItemsAnchor, itemsPos), UITextSize8, color)
+			if i == page.Index {
+				handPos := engine.NewVec2i(itemsPos.X-12, itemsPos.Y)
+				err := ui.DrawIcon(UIIconHand, ui.ScaledPos(page.ItemsAnchor, handPos), UIColorDefault)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if entry.Type == MenuEntryToggle && entry.Data >= 0 && entry.Data < len(entry.Options) {
+			option := entry.Options[entry.Data]
+			togglePos := itemsPos
+			togglePos.X += page.BlockWidth - int32(textWidth(option, UITextSize8))
+			ui.DrawText(option, ui.ScaledPos(page.ItemsAnchor, togglePos), UITextSize8, color)
+		}
+
+		itemsPos.Y += menuItemSpacing
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package game
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func press(actions ...Action) {
+	engine.InputClear()
+	for _, a := range actions {
+		engine.ActionsPressed[a] = true
+	}
+}
+
+func TestMenuNavigate(t *testing.T) {
+	defer engine.InputClear()
+
+	tests := []struct {
+		name    string
+		layout  MenuLayout
+		actions []Action
+		want    int
+	}{
+		{"down", MenuVertical, []Action{AMenuDown}, 1},
+		{"up wraps", MenuVertical, []Action{AMenuUp}, 2},
+		{"down wraps", MenuVertical, []Action{AMenuDown, AMenuDown, AMenuDown}, 0},
+		{"horizontal ignores down", MenuHorizontal, []Action{AMenuDown}, 0},
+		{"horizontal right", MenuHorizontal, []Action{AMenuRight}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMenu(nil)
+			page := m.Push("TEST", nil)
+			page.Layout = tt.layout
+			for i := 0; i < 3; i++ {
+				page.AddButton("ITEM", i*10, nil)
+			}
+
+			var data int
+			for _, a := range tt.actions {
+				press(a)
+				data = m.navigate(page)
+			}
+			if page.Index != tt.want {
+				t.Errorf("index = %d, want %d", page.Index, tt.want)
+			}
+			if data != tt.want*10 {
+				t.Errorf("data = %d, want %d", data, tt.want*10)
+			}
+		})
+	}
+}
+
+func TestMenuSelectAndBack(t *testing.T) {
+	defer engine.InputClear()
+
+	m := NewMenu(nil)
+	selected := -1
+	root := m.Push("ROOT", nil)
+	root.AddButton("NEXT", 7, func(menu *Menu, data int) {
+		selected = data
+		menu.Push("CHILD", nil)
+	})
+
+	press(AMenuSelect)
+	m.handleInput(m.Page())
+	if selected != 7 {
+		t.Errorf("selected = %d, want 7", selected)
+	}
+	if m.Depth() != 2 {
+		t.Fatalf("depth = %d, want 2", m.Depth())
+	}
+
+	press(AMenuBack)
+	m.handleInput(m.Page())
+	if m.Page() != root {
+		t.Errorf("back did not return to root page")
+	}
+
+	// The root page is never popped
+	press(AMenuQuit)
+	m.handleInput(m.Page())
+	if m.Depth() != 1 {
+		t.Errorf("depth = %d, want 1", m.Depth())
+	}
+}
+
+func TestMenuToggle(t *testing.T) {
+	defer engine.InputClear()
+
+	tests := []struct {
+		name   string
+		start  int
+		action Action
+		want   int
+	}{
+		{"right", 0, AMenuRight, 1},
+		{"select", 1, AMenuSelect, 2},
+		{"right wraps", 2, AMenuRight, 0},
+		{"left wraps", 0, AMenuLeft, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMenu(nil)
+			page := m.Push("OPTIONS", nil)
+			got := -1
+			page.AddToggle("TOGGLE", tt.start, []string{"A", "B", "C"}, func(menu *Menu, data int) {
+				got = data
+			})
+
+			press(tt.action)
+			m.handleInput(page)
+			if got != tt.want {
+				t.Errorf("callback data = %d, want %d", got, tt.want)
+			}
+			if page.Entries[0].Data != tt.want {
+				t.Errorf("entry data = %d, want %d", page.Entries[0].Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMenuSfx(t *testing.T) {
+	defer engine.InputClear()
+
+	var played []SfxE
+	m := NewMenu(nil)
+	m.Sfx = func(sfx SfxE) {
+		played = append(played, sfx)
+	}
+	page := m.Push("TEST", nil)
+	page.AddButton("A", 0, nil)
+	page.AddButton("B", 1, nil)
+
+	press(AMenuDown)
+	m.navigate(page)
+	press(AMenuSelect)
+	m.handleInput(page)
+	press()
+	m.navigate(page)
+
+	want := []SfxE{SfxMenuMove, SfxMenuSelect}
+	if len(played) != len(want) || played[0] != want[0] || played[1] != want[1] {
+		t.Errorf("played %v, want %v", played, want)
+	}
+}
+
+func TestMenuPushFull(t *testing.T) {
+	defer func(l *log.Logger) { Logger = l }(Logger)
+	Logger = log.New(io.Discard, "", 0)
+
+	m := NewMenu(nil)
+	for i := 0; i < MenuPagesMax; i++ {
+		m.Push("PAGE", nil).AddButton("ITEM", i, nil)
+	}
+
+	if page := m.Push("ONE TOO MANY", nil); page != nil {
+		t.Errorf("Push() on a full stack = %v; want nil", page)
+	}
+	if page := m.Confirm("SURE", "", "YES", "NO", nil, 0); page != nil {
+		t.Errorf("Confirm() on a full stack = %v; want nil", page)
+	}
+	if m.Depth() != MenuPagesMax || len(m.Page().Entries) != 1 {
+		t.Errorf("depth %d, %d entries on top", m.Depth(), len(m.Page().Entries))
+	}
+}
@@ -0,0 +1,180 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// musicNameTime is how long the name of a new track is shown in seconds
+const musicNameTime = 3.0
+
+// MusicPlayer streams Def.MusicTracks in a random order on the music
+// channel of the mixer. Tracks are read from disk as they play.
+type MusicPlayer struct {
+	audio    *engine.Mixer
+	rand     *rand.Rand
+	order    [NumMusicTracks]int
+	index    int
+	stream   *engine.MusicStream
+	file     io.Closer
+	nameTime float64
+
+	// Track is the playing track or -1
+	Track int
+
+	// open reads a track file, tests replace it
+	open func(path string) (io.ReadCloser, error)
+}
+
+func NewMusicPlayer(audio *engine.Mixer, seed int64) *MusicPlayer {
+	m := &MusicPlayer{
+		audio: audio,
+		rand:  rand.New(rand.NewSource(seed)),
+		index: -1,
+		Track: -1,
+		open: func(path string) (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+	m.Shuffle()
+
+	return m
+}
+
+// Shuffle picks a new random order, the playing track is not interrupted
+func (m *MusicPlayer) Shuffle() {
+	for i := range m.order {
+		m.order[i] = i
+	}
+	m.rand.Shuffle(len(m.order), func(i, j int) {
+		m.order[i], m.order[j] = m.order[j], m.order[i]
+	})
+	m.index = -1
+}
+
+// Next plays the next track of the order, a new order is shuffled after the
+// last one
+func (m *MusicPlayer) Next() error {
+	return m.step(1)
+}
+
+// Prev plays the previous track of the order
+func (m *MusicPlayer) Prev() error {
+	return m.step(-1)
+}
+
+// Stop ends the music
+func (m *MusicPlayer) Stop() {
+	m.audio.SetMusic(nil)
+	if m.file != nil {
+		m.file.Close()
+	}
+	m.stream = nil
+	m.file = nil
+	m.Track = -1
+}
+
+// Update moves on to the next track when the current one ended
+func (m *MusicPlayer) Update(tickLast float64) error {
+	m.nameTime -= tickLast
+	if m.stream == nil || !m.stream.Done() {
+		return nil
+	}
+
+	err := m.stream.Err()
+	if err != nil {
+		err = fmt.Errorf("%s: %w", Def.MusicTracks[m.Track].Name, err)
+	}
+	if nextErr := m.Next(); nextErr != nil {
+		return nextErr
+	}
+	return err
+}
+
+// Draw shows the name of the track for a while after it started
+func (m *MusicPlayer) Draw(ui *UI) {
+	if m.nameTime <= 0 || m.Track < 0 {
+		return
+	}
+	ui.render.SetView2d()
+	ui.DrawTextCentered(Def.MusicTracks[m.Track].Name, ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -16)), UITextSize8, UIColorDefault)
+}
+
+// step plays the track dir places away in the order. Tracks that can not
+// be opened are skipped; if none can, the music stops.
+func (m *MusicPlayer) step(dir int) error {
+	var err error
+	for tries := 0; tries < len(m.order); tries++ {
+		m.index += dir
+		if m.index >= len(m.order) {
+			m.Shuffle()
+			m.index = 0
+		} else if m.index < 0 {
+			m.index = len(m.order) - 1
+		}
+
+		err = m.play(m.order[m.index])
+		if err == nil {
+			return nil
+		}
+	}
+
+	m.Stop()
+	return err
+}
+
+func (m *MusicPlayer) play(track int) error {
+	decoder, file, err := m.openTrack(Def.MusicTracks[track].Path)
+	if err != nil {
+		return err
+	}
+
+	m.Stop()
+	m.stream = engine.NewMusicStream(decoder)
+	m.file = file
+	m.Track = track
+	m.nameTime = musicNameTime
+	m.audio.SetMusic(m.stream)
+
+	return nil
+}
+
+// openTrack opens path, or a WAV file of the same name when there is no QOA
+// file, and returns a decoder that reads it as it plays
+func (m *MusicPlayer) openTrack(path string) (engine.PCMDecoder, io.Closer, error) {
+	paths := []string{path}
+	if ext := filepath.Ext(path); ext != ".wav" {
+		paths = append(paths, strings.TrimSuffix(path, ext)+".wav")
+	}
+
+	var err error
+	for _, p := range paths {
+		var f io.ReadCloser
+		f, err = m.open(p)
+		if err != nil {
+			continue
+		}
+
+		var decoder engine.PCMDecoder
+		r := bufio.NewReader(f)
+		if filepath.Ext(p) == ".wav" {
+			decoder, err = engine.NewWavDecoder(r)
+		} else {
+			decoder, err = engine.NewQoaDecoder(r)
+		}
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		return decoder, f, nil
+	}
+
+	return nil, nil, err
+}
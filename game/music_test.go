@@ -0,0 +1,127 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// testWav is a mono WAV file with a single sample
+func testWav() []byte {
+	le := binary.LittleEndian
+	b := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	b = le.AppendUint32(b, 16)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint32(b, engine.AudioSampleRate)
+	b = le.AppendUint32(b, engine.AudioSampleRate*2)
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = le.AppendUint32(b, 2)
+	return le.AppendUint16(b, 1000)
+}
+
+// newTestMusicPlayer serves WAV files for all tracks but the missing ones
+func newTestMusicPlayer(missing ...int) (*MusicPlayer, *[]string) {
+	var opened []string
+	m := NewMusicPlayer(engine.NewMixer(), 1)
+	m.open = func(path string) (io.ReadCloser, error) {
+		for _, track := range missing {
+			if strings.HasPrefix(path, strings.TrimSuffix(Def.MusicTracks[track].Path, ".qoa")) {
+				return nil, os.ErrNotExist
+			}
+		}
+		if !strings.HasSuffix(path, ".wav") {
+			return nil, os.ErrNotExist
+		}
+		opened = append(opened, path)
+		return io.NopCloser(bytes.NewReader(testWav())), nil
+	}
+	return m, &opened
+}
+
+func TestMusicShuffle(t *testing.T) {
+	m, _ := newTestMusicPlayer()
+
+	seen := map[int]bool{}
+	for _, track := range m.order {
+		seen[track] = true
+	}
+	if len(seen) != int(NumMusicTracks) {
+		t.Errorf("order %v is not a permutation", m.order)
+	}
+
+	other := NewMusicPlayer(engine.NewMixer(), 1)
+	if other.order != m.order {
+		t.Errorf("same seed, different order")
+	}
+}
+
+func TestMusicNextPrev(t *testing.T) {
+	m, opened := newTestMusicPlayer()
+
+	var played []int
+	for i := 0; i < int(NumMusicTracks); i++ {
+		if err := m.Next(); err != nil {
+			t.Fatal(err)
+		}
+		played = append(played, m.Track)
+	}
+	if len(*opened) != int(NumMusicTracks) || !strings.HasSuffix((*opened)[0], ".wav") {
+		t.Errorf("opened %v", *opened)
+	}
+
+	m.Prev()
+	if m.Track != played[len(played)-2] {
+		t.Errorf("prev = %d, want %d", m.Track, played[len(played)-2])
+	}
+	m.Next()
+	m.Next()
+	if m.index != 0 {
+		t.Errorf("index after the last track = %d, want a new order from 0", m.index)
+	}
+}
+
+func TestMusicSkipsMissing(t *testing.T) {
+	m, _ := newTestMusicPlayer(0, 1, 2)
+	for i := 0; i < int(NumMusicTracks); i++ {
+		m.Next()
+		if m.Track <= 2 {
+			t.Fatalf("missing track %d played", m.Track)
+		}
+	}
+
+	all := make([]int, NumMusicTracks)
+	for i := range all {
+		all[i] = i
+	}
+	m, _ = newTestMusicPlayer(all...)
+	if err := m.Next(); err == nil || m.Track != -1 {
+		t.Errorf("no track available: err %v track %d", err, m.Track)
+	}
+}
+
+func TestMusicTrackEnd(t *testing.T) {
+	m, _ := newTestMusicPlayer()
+	m.Next()
+	first := m.Track
+	if m.nameTime != musicNameTime {
+		t.Errorf("name time %.1f", m.nameTime)
+	}
+
+	// Two frames are more than the one sample track holds
+	out := make([]float32, 2*engine.AudioChannels)
+	m.stream.Read(out)
+	if err := m.Update(0.5); err != nil {
+		t.Fatal(err)
+	}
+	if m.Track == first || m.index != 1 {
+		t.Errorf("track %d index %d after the end of track %d", m.Track, m.index, first)
+	}
+}
@@ -0,0 +1,450 @@
+package game
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+type PrmType int16
+
+const (
+	PrmTypeF3            PrmType = 1
+	PrmTypeFT3           PrmType = 2
+	PrmTypeF4            PrmType = 3
+	PrmTypeFT4           PrmType = 4
+	PrmTypeG3            PrmType = 5
+	PrmTypeGT3           PrmType = 6
+	PrmTypeG4            PrmType = 7
+	PrmTypeGT4           PrmType = 8
+	PrmTypeLF2           PrmType = 9
+	PrmTypeTSPR          PrmType = 10
+	PrmTypeBSPR          PrmType = 11
+	PrmTypeLSF3          PrmType = 12
+	PrmTypeLSFT3         PrmType = 13
+	PrmTypeLSF4          PrmType = 14
+	PrmTypeLSFT4         PrmType = 15
+	PrmTypeLSG3          PrmType = 16
+	PrmTypeLSGT3         PrmType = 17
+	PrmTypeLSG4          PrmType = 18
+	PrmTypeLSGT4         PrmType = 19
+	PrmTypeSpline        PrmType = 20
+	PrmTypeInfiniteLight PrmType = 21
+	PrmTypePointLight    PrmType = 22
+	PrmTypeSpotLight     PrmType = 23
+)
+
+const (
+	PrmSingleSided = 0x0001
+	PrmShipEngine  = 0x0002
+	PrmTranslucent = 0x0004
+
+	ObjectNameLen    = 16
+	ObjectHeaderSize = 144
+
+	// Lines have no thickness in the PRM data; they are drawn as thin quads
+	ObjectLineWidth = 4
+)
+
+// Primitive holds any of the PRM primitive types; only the fields relevant
+// to Type are set. Texture is already resolved to a render texture index.
+type Primitive struct {
+	Type    PrmType
+	Flags   int16
+	Coords  [4]int16
+	Normals [4]int16
+	Texture int
+	UV      [4]engine.Vec2
+	Colors  [4]engine.RGBA
+	Width   int16
+	Height  int16
+}
+
+// Object is a model from a PRM file. Files contain several objects which are
+// chained through Next.
+type Object struct {
+	Name       string
+	Mat        engine.Mat4
+	Vertices   []engine.Vec3
+	Normals    []engine.Vec3
+	Primitives []Primitive
+	Extent     int32
+	Flags      int16
+	Origin     engine.Vec3
+	Radius     gl.Float
+	Next       *Object
+}
+
+// prmLayout describes the body of a primitive following its type and flags
+type prmLayout struct {
+	coords   int
+	normals  int
+	textured bool
+	colors   int
+	// padding before the colors
+	pad bool
+}
+
+// size returns the bytes of a primitive body after its type and flags
+func (l prmLayout) size() uint32 {
+	size := uint32(l.coords+l.normals) * 2
+	if l.textured {
+		size += 2 + 2 + 2 + uint32(l.coords)*2 // texture, cba, tsb, uvs
+	}
+	if l.pad {
+		size += 2
+	}
+	return size + uint32(l.colors)*4
+}
+
+var prmLayouts = map[PrmType]prmLayout{
+	PrmTypeF3:    {coords: 3, colors: 1, pad: true},
+	PrmTypeFT3:   {coords: 3, textured: true, colors: 1, pad: true},
+	PrmTypeF4:    {coords: 4, colors: 1},
+	PrmTypeFT4:   {coords: 4, textured: true, colors: 1, pad: true},
+	PrmTypeG3:    {coords: 3, colors: 3, pad: true},
+	PrmTypeGT3:   {coords: 3, textured: true, colors: 3, pad: true},
+	PrmTypeG4:    {coords: 4, colors: 4},
+	PrmTypeGT4:   {coords: 4, textured: true, colors: 4, pad: true},
+	PrmTypeLF2:   {coords: 2, colors: 1},
+	PrmTypeLSF3:  {coords: 3, normals: 1, colors: 1},
+	PrmTypeLSFT3: {coords: 3, normals: 1, textured: true, colors: 1},
+	PrmTypeLSF4:  {coords: 4, normals: 1, colors: 1, pad: true},
+	PrmTypeLSFT4: {coords: 4, normals: 1, textured: true, colors: 1},
+	PrmTypeLSG3:  {coords: 3, normals: 3, colors: 3},
+	PrmTypeLSGT3: {coords: 3, normals: 3, textured: true, colors: 3},
+	PrmTypeLSG4:  {coords: 4, normals: 4, colors: 4},
+	PrmTypeLSGT4: {coords: 4, normals: 4, textured: true, colors: 4, pad: true},
+}
+
+// prmSpriteSize is the body of the sprite primitives: coord, width, height,
+// texture and color
+const prmSpriteSize = 2 + 2 + 2 + 2 + 4
+
+// Bytes to skip for primitives that are not drawn
+var prmSkip = map[PrmType]uint32{
+	PrmTypeSpline:        52,
+	PrmTypePointLight:    24,
+	PrmTypeSpotLight:     36,
+	PrmTypeInfiniteLight: 12,
+}
+
+// ObjectsLoad loads all objects of a PRM file, resolving texture indices
+// against tl
+func ObjectsLoad(name string, tl TextureList) (*Object, error) {
+	currentDir, _ := os.Getwd()
+	filePath := filepath.Join(currentDir, name)
+	Logger.Printf("load prm %s\n", name)
+
+	bytes, err := engine.LoadBinaryFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ObjectsLoadFromBytes(bytes, tl)
+}
+
+func ObjectsLoadFromBytes(bytes []byte, tl TextureList) (*Object, error) {
+	var first *Object
+	var last *Object
+	var p uint32
+
+	for p < uint32(len(bytes)) {
+		object, err := objectLoad(bytes, &p, tl)
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			first = object
+		} else {
+			last.Next = object
+		}
+		last = object
+	}
+
+	return first, nil
+}
+
+func objectLoad(bytes []byte, p *uint32, tl TextureList) (*Object, error) {
+	if err := prmCheckLen(bytes, *p, ObjectHeaderSize); err != nil {
+		return nil, err
+	}
+
+	o := &Object{}
+	var err error
+
+	var name [ObjectNameLen]byte
+	n := 0
+	for i := range name {
+		name[i] = engine.GetU8(bytes, p)
+		if name[i] != 0 && n == i {
+			n++
+		}
+	}
+	o.Name = string(name[:n])
+	o.Mat = engine.NewMat4Identity()
+
+	verticesLen := int(engine.GetI16(bytes, p))
+	*p += 2 // padding
+	*p += 4 // vertices pointer
+	normalsLen := int(engine.GetI16(bytes, p))
+	*p += 2 // padding
+	*p += 4 // normals pointer
+	primitivesLen := int(engine.GetI16(bytes, p))
+	*p += 2 // padding
+	*p += 4 // primitives pointer
+	*p += 4 // lib model pointer
+	*p += 4 // bsp pointer
+	*p += 4 // skeleton pointer
+	o.Extent = engine.GetI32(bytes, p)
+	o.Flags = engine.GetI16(bytes, p)
+	*p += 2 // padding
+	*p += 4 // next pointer
+
+	*p += 3 * 3 * 2 // relative rot matrix
+	*p += 2         // padding
+
+	o.Origin.X = gl.Float(engine.GetI32(bytes, p))
+	o.Origin.Y = gl.Float(engine.GetI32(bytes, p))
+	o.Origin.Z = gl.Float(engine.GetI32(bytes, p))
+
+	*p += 3 * 3 * 2 // absolute rot matrix
+	*p += 2         // padding
+	*p += 3 * 4     // absolute translation matrix
+	*p += 2         // skeleton update flag
+	*p += 2         // padding
+	*p += 4         // skeleton super
+	*p += 4         // skeleton sub
+	*p += 4         // skeleton next
+
+	if verticesLen < 0 || normalsLen < 0 || primitivesLen < 0 {
+		return nil, fmt.Errorf("prm %s: invalid lengths %d, %d, %d", o.Name, verticesLen, normalsLen, primitivesLen)
+	}
+	if err := prmCheckLen(bytes, *p, uint32(verticesLen+normalsLen)*8); err != nil {
+		return nil, err
+	}
+
+	o.Vertices = make([]engine.Vec3, verticesLen)
+	for i := range o.Vertices {
+		o.Vertices[i] = readVec3i16(bytes, p)
+		for _, c := range []gl.Float{o.Vertices[i].X, o.Vertices[i].Y, o.Vertices[i].Z} {
+			if c < 0 {
+				c = -c
+			}
+			if c > o.Radius {
+				o.Radius = c
+			}
+		}
+	}
+
+	o.Normals = make([]engine.Vec3, normalsLen)
+	for i := range o.Normals {
+		o.Normals[i] = readVec3i16(bytes, p)
+	}
+
+	o.Primitives = make([]Primitive, 0, primitivesLen)
+	for i := 0; i < primitivesLen; i++ {
+		if err := prmCheckLen(bytes, *p, 4); err != nil {
+			return nil, err
+		}
+		prm := Primitive{
+			Type:  PrmType(engine.GetI16(bytes, p)),
+			Flags: engine.GetI16(bytes, p),
+		}
+
+		if skip, ok := prmSkip[prm.Type]; ok {
+			if err := prmCheckLen(bytes, *p, skip); err != nil {
+				return nil, err
+			}
+			*p += skip
+			continue
+		}
+
+		if prm.Type == PrmTypeTSPR || prm.Type == PrmTypeBSPR {
+			if err := prmCheckLen(bytes, *p, prmSpriteSize); err != nil {
+				return nil, err
+			}
+			prm.Coords[0] = engine.GetI16(bytes, p)
+			prm.Width = engine.GetI16(bytes, p)
+			prm.Height = engine.GetI16(bytes, p)
+			if prm.Texture, err = objectTexture(tl, engine.GetI16(bytes, p)); err != nil {
+				return nil, fmt.Errorf("prm %s: %w", o.Name, err)
+			}
+			prm.Colors[0] = readColor(bytes, p)
+			o.Primitives = append(o.Primitives, prm)
+			continue
+		}
+
+		layout, ok := prmLayouts[prm.Type]
+		if !ok {
+			return nil, fmt.Errorf("prm %s: bad primitive type %#x", o.Name, prm.Type)
+		}
+		if err := prmCheckLen(bytes, *p, layout.size()); err != nil {
+			return nil, err
+		}
+
+		for c := 0; c < layout.coords; c++ {
+			prm.Coords[c] = engine.GetI16(bytes, p)
+			if int(prm.Coords[c]) >= len(o.Vertices) || prm.Coords[c] < 0 {
+				return nil, fmt.Errorf("prm %s: invalid vertex index %d", o.Name, prm.Coords[c])
+			}
+		}
+		for n := 0; n < layout.normals; n++ {
+			prm.Normals[n] = engine.GetI16(bytes, p)
+		}
+		if layout.textured {
+			if prm.Texture, err = objectTexture(tl, engine.GetI16(bytes, p)); err != nil {
+				return nil, fmt.Errorf("prm %s: %w", o.Name, err)
+			}
+			*p += 2 // cba
+			*p += 2 // tsb
+			for c := 0; c < layout.coords; c++ {
+				prm.UV[c].X = gl.Float(engine.GetU8(bytes, p))
+				prm.UV[c].Y = gl.Float(engine.GetU8(bytes, p))
+			}
+		}
+		if layout.pad {
+			*p += 2
+		}
+		for c := 0; c < layout.colors; c++ {
+			prm.Colors[c] = readColor(bytes, p)
+		}
+		// Flat shaded primitives use the same color for all vertices
+		for c := layout.colors; c < layout.coords; c++ {
+			prm.Colors[c] = prm.Colors[0]
+		}
+
+		o.Primitives = append(o.Primitives, prm)
+	}
+
+	return o, nil
+}
+
+// prmCheckLen returns an error if fewer than n bytes are left at p
+func prmCheckLen(bytes []byte, p uint32, n uint32) error {
+	if uint64(p)+uint64(n) > uint64(len(bytes)) {
+		return fmt.Errorf("prm object at %d: unexpected end of data", p)
+	}
+	return nil
+}
+
+func objectTexture(tl TextureList, index int16) (int, error) {
+	t, err := tl.Get(int(index))
+	if err != nil {
+		return 0, err
+	}
+	return int(t), nil
+}
+
+func readVec3i16(bytes []byte, p *uint32) engine.Vec3 {
+	v := engine.Vec3{
+		X: gl.Float(engine.GetI16(bytes, p)),
+		Y: gl.Float(engine.GetI16(bytes, p)),
+		Z: gl.Float(engine.GetI16(bytes, p)),
+	}
+	*p += 2 // padding
+	return v
+}
+
+func readColor(bytes []byte, p *uint32) engine.RGBA {
+	c := engine.RGBA{
+		R: engine.GetU8(bytes, p),
+		G: engine.GetU8(bytes, p),
+		B: engine.GetU8(bytes, p),
+		A: 255,
+	}
+	*p++ // gpu code
+	return c
+}
+
+// At returns the object at index in the list starting at o, or nil
+func (o *Object) At(index int) *Object {
+	for ; o != nil && index > 0; index-- {
+		o = o.Next
+	}
+	return o
+}
+
+// Draw transforms the object by mat and pushes all its primitives to render
+func (o *Object) Draw(render engine.RenderBackend, mat *engine.Mat4) error {
+	render.SetModelMat(mat)
+	v := o.Vertices
+
+	for i := range o.Primitives {
+		prm := &o.Primitives[i]
+
+		texture := prm.Texture
+		layout := prmLayouts[prm.Type]
+		if !layout.textured && prm.Type != PrmTypeTSPR && prm.Type != PrmTypeBSPR {
+			texture = render.NoTexture()
+		}
+
+		vertex := func(c int) engine.Vertex {
+			return engine.Vertex{Pos: v[prm.Coords[c]], UV: prm.UV[c], Color: prm.Colors[c]}
+		}
+
+		var err error
+		switch prm.Type {
+		case PrmTypeF3, PrmTypeFT3, PrmTypeG3, PrmTypeGT3,
+			PrmTypeLSF3, PrmTypeLSFT3, PrmTypeLSG3, PrmTypeLSGT3:
+			err = render.PushTris(engine.Tris{
+				Vertices: [3]engine.Vertex{vertex(2), vertex(1), vertex(0)},
+			}, texture)
+
+		case PrmTypeF4, PrmTypeFT4, PrmTypeG4, PrmTypeGT4,
+			PrmTypeLSF4, PrmTypeLSFT4, PrmTypeLSG4, PrmTypeLSGT4:
+			err = render.PushTris(engine.Tris{
+				Vertices: [3]engine.Vertex{vertex(2), vertex(1), vertex(0)},
+			}, texture)
+			if err == nil {
+				err = render.PushTris(engine.Tris{
+					Vertices: [3]engine.Vertex{vertex(2), vertex(3), vertex(1)},
+				}, texture)
+			}
+
+		case PrmTypeTSPR, PrmTypeBSPR:
+			pos := v[prm.Coords[0]]
+			if prm.Type == PrmTypeTSPR {
+				pos.Y += gl.Float(prm.Height >> 1)
+			} else {
+				pos.Y -= gl.Float(prm.Height >> 1)
+			}
+			err = render.PushSprite(pos, engine.NewVec2i(int32(prm.Width), int32(prm.Height)), prm.Colors[0], texture)
+
+		case PrmTypeLF2:
+			err = objectDrawLine(render, v[prm.Coords[0]], v[prm.Coords[1]], prm.Colors[0], texture)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func objectDrawLine(render engine.RenderBackend, a, b engine.Vec3, color engine.RGBA, texture int) error {
+	dir := engine.Vec3Sub(b, a)
+	side := engine.Vec3Cross(dir, engine.NewVec3(0, 1, 0))
+	if engine.Vec3Len(side) == 0 {
+		side = engine.NewVec3(1, 0, 0)
+	}
+	side = engine.Vec3MulF(engine.Vec3Normalize(side), ObjectLineWidth*0.5)
+
+	a0, a1 := engine.Vec3Sub(a, side), engine.Vec3Add(a, side)
+	b0, b1 := engine.Vec3Sub(b, side), engine.Vec3Add(b, side)
+
+	err := render.PushTris(engine.Tris{
+		Vertices: [3]engine.Vertex{{Pos: a0, Color: color}, {Pos: b0, Color: color}, {Pos: a1, Color: color}},
+	}, texture)
+	if err != nil {
+		return err
+	}
+	return render.PushTris(engine.Tris{
+		Vertices: [3]engine.Vertex{{Pos: a1, Color: color}, {Pos: b0, Color: color}, {Pos: b1, Color: color}},
+	}, texture)
+}
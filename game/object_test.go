@@ -0,0 +1,169 @@
+package game
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+type prmWriter struct {
+	bytes []byte
+}
+
+func (w *prmWriter) i16(v ...int16) {
+	for _, x := range v {
+		w.bytes = binary.BigEndian.AppendUint16(w.bytes, uint16(x))
+	}
+}
+
+func (w *prmWriter) u8(v ...byte) {
+	w.bytes = append(w.bytes, v...)
+}
+
+func (w *prmWriter) u32(v ...uint32) {
+	for _, x := range v {
+		w.bytes = binary.BigEndian.AppendUint32(w.bytes, x)
+	}
+}
+
+func (w *prmWriter) header(name string, vertices, normals, primitives int16) {
+	var n [ObjectNameLen]byte
+	copy(n[:], name)
+	w.u8(n[:]...)
+	w.i16(vertices, 0)
+	w.u32(0)
+	w.i16(normals, 0)
+	w.u32(0)
+	w.i16(primitives, 0)
+	w.u32(0, 0, 0, 0)
+	w.u32(1000)    // extent
+	w.i16(0x10, 0) // flags
+	w.u32(0)       // next
+	w.u8(make([]byte, 20)...)
+	w.u32(100, 200, uint32(0xffffff9c)) // origin 100, 200, -100
+	w.u8(make([]byte, ObjectHeaderSize-ObjectNameLen-48-20-12)...)
+}
+
+func testPrm() []byte {
+	w := &prmWriter{}
+
+	w.header("SHIP", 4, 1, 4)
+	w.i16(0, 0, 0, 0, 100, 0, 0, 0, 0, -300, 0, 0, 0, 0, 50, 0)
+	w.i16(0, 4096, 0, 0)
+
+	w.i16(int16(PrmTypeF3), 0)
+	w.i16(0, 1, 2, 0)
+	w.u32(0x10203000)
+
+	w.i16(int16(PrmTypeFT4), PrmSingleSided)
+	w.i16(0, 1, 2, 3)
+	w.i16(1, 0, 0)
+	w.u8(0, 0, 31, 0, 0, 31, 31, 31)
+	w.i16(0)
+	w.u32(0x80808000)
+
+	w.i16(int16(PrmTypePointLight), 0)
+	w.u8(make([]byte, 24)...)
+
+	w.i16(int16(PrmTypeTSPR), 0)
+	w.i16(3, 32, 16, 0)
+	w.u32(0xff000000)
+
+	w.header("LOGO", 3, 0, 1)
+	w.i16(0, 0, 0, 0, 10, 0, 0, 0, 0, 10, 0, 0)
+	w.i16(int16(PrmTypeG3), 0)
+	w.i16(0, 1, 2, 0)
+	w.u32(0xff000000, 0x00ff0000, 0x0000ff00)
+
+	return w.bytes
+}
+
+func TestObjectsLoadFromBytes(t *testing.T) {
+	tl := TextureList{handles: []uint16{10, 11}}
+
+	o, err := ObjectsLoadFromBytes(testPrm(), tl)
+	if err != nil {
+		t.Fatalf("ObjectsLoadFromBytes() = %v", err)
+	}
+
+	if o.Name != "SHIP" || o.Next == nil || o.Next.Name != "LOGO" || o.Next.Next != nil {
+		t.Fatalf("unexpected object list")
+	}
+	if o.At(1) != o.Next || o.At(2) != nil {
+		t.Errorf("At() does not follow the list")
+	}
+	if o.Origin != engine.NewVec3(100, 200, -100) || o.Extent != 1000 || o.Flags != 0x10 {
+		t.Errorf("header: origin %v, extent %d, flags %d", o.Origin, o.Extent, o.Flags)
+	}
+	if len(o.Vertices) != 4 || o.Vertices[2] != engine.NewVec3(0, -300, 0) || o.Radius != 300 {
+		t.Errorf("vertices %v, radius %v", o.Vertices, o.Radius)
+	}
+	if len(o.Normals) != 1 || o.Normals[0] != engine.NewVec3(0, 4096, 0) {
+		t.Errorf("normals %v", o.Normals)
+	}
+
+	// The light is skipped
+	if len(o.Primitives) != 3 {
+		t.Fatalf("got %d primitives; want 3", len(o.Primitives))
+	}
+
+	f3 := o.Primitives[0]
+	if f3.Colors[0] != engine.NewRGBA(0x10, 0x20, 0x30, 255) || f3.Colors[2] != f3.Colors[0] {
+		t.Errorf("F3 colors %v", f3.Colors)
+	}
+
+	ft4 := o.Primitives[1]
+	if ft4.Texture != 11 || ft4.Flags != PrmSingleSided {
+		t.Errorf("FT4 texture %d, flags %d", ft4.Texture, ft4.Flags)
+	}
+	if ft4.Coords != [4]int16{0, 1, 2, 3} || ft4.UV[3] != engine.NewVec2(31, 31) {
+		t.Errorf("FT4 coords %v, uv %v", ft4.Coords, ft4.UV)
+	}
+
+	spr := o.Primitives[2]
+	if spr.Type != PrmTypeTSPR || spr.Width != 32 || spr.Height != 16 || spr.Texture != 10 {
+		t.Errorf("sprite %+v", spr)
+	}
+
+	g3 := o.Next.Primitives[0]
+	if g3.Colors[1] != engine.NewRGBA(0, 255, 0, 255) || g3.Colors[2] != engine.NewRGBA(0, 0, 255, 255) {
+		t.Errorf("G3 colors %v", g3.Colors)
+	}
+}
+
+func TestObjectsLoadFromBytesInvalid(t *testing.T) {
+	valid := testPrm()
+
+	badType := append([]byte{}, valid...)
+	// Type of the first primitive, after the header, vertices and normals
+	binary.BigEndian.PutUint16(badType[ObjectHeaderSize+5*8:], 99)
+
+	tests := []struct {
+		name  string
+		bytes []byte
+		tl    TextureList
+	}{
+		{"truncated", valid[:len(valid)-3], TextureList{handles: []uint16{0, 1}}},
+		{"primitive type", badType, TextureList{handles: []uint16{0, 1}}},
+		{"texture index", valid, TextureList{handles: []uint16{0}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := ObjectsLoadFromBytes(tt.bytes, tt.tl); err == nil {
+			t.Errorf("%s: ObjectsLoadFromBytes() = nil error", tt.name)
+		}
+	}
+
+	// Data cut anywhere but between objects is an error, not a panic
+	tl := TextureList{handles: []uint16{0, 1}}
+	var first uint32
+	if _, err := objectLoad(valid, &first, tl); err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < len(valid); n++ {
+		if _, err := ObjectsLoadFromBytes(valid[:n], tl); err == nil && n != int(first) {
+			t.Errorf("cut to %d bytes: ObjectsLoadFromBytes() = nil error", n)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package game
+
+import (
+	"math"
+	"sort"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	// RaceCountdownTime is the length of the countdown before the start
+	RaceCountdownTime = 3.0
+
+	// Lateral distance between the two ships of a grid row
+	raceGridSpread = 300
+)
+
+// RacePilot is the race state of one pilot and its ship
+type RacePilot struct {
+	Pilot   int
+	Ship    *Ship
+	Control ShipController
+
+	// Laps completed and their times
+	Lap      int
+	LapTimes [NumLaps]float32
+	LapStart float32
+
+	// Progress counts the sections advanced from the start line, a lap is
+	// the number of sections in the track
+	Progress   int
+	Finished   bool
+	FinishTime float32
+
+	sectionNum int
+}
+
+// Race runs the ships of a race in lock step and keeps laps, times and
+// positions. It is independent of the renderer.
+type Race struct {
+	Track     *track.Track
+	StartLine int
+	Pilots    []*RacePilot
+	// Ranks holds the pilots ordered by race position
+	Ranks []*RacePilot
+
+	Countdown float32
+	Time      float32
+
+	// OnStep is called after every step once the race started
+	OnStep func()
+
+	accumulator float64
+}
+
+func NewRace(trk *track.Track, startLine int) *Race {
+	return &Race{
+		Track:     trk,
+		StartLine: startLine,
+		Countdown: RaceCountdownTime,
+	}
+}
+
+// AddPilot enters a ship in the race; its progress is measured from the
+// section it is placed on.
+func (r *Race) AddPilot(pilot int, ship *Ship, ctrl ShipController) *RacePilot {
+	p := &RacePilot{
+		Pilot:   pilot,
+		Ship:    ship,
+		Control: ctrl,
+	}
+	if ship.Section != nil {
+		p.sectionNum = ship.Section.Num
+		p.Progress = r.sectionDelta(r.StartLine, p.sectionNum)
+	}
+	r.Pilots = append(r.Pilots, p)
+	r.Ranks = append(r.Ranks, p)
+	r.updateRanks()
+
+	return p
+}
+
+// GridSection returns the section of a grid slot, counted back from the
+// start line; two ships share each grid row.
+func (r *Race) GridSection(slot int) *track.Section {
+	section := r.startSection()
+	if section == nil {
+		return nil
+	}
+	for i := 0; i <= slot/2; i++ {
+		section = section.Prev
+	}
+	return section
+}
+
+// PlaceOnGrid puts ship at the given grid slot facing along the track
+func (r *Race) PlaceOnGrid(ship *Ship, slot int) {
+	section := r.GridSection(slot)
+	if section == nil {
+		return
+	}
+
+	along := engine.Vec3Normalize(engine.Vec3Sub(section.Next.Center, section.Center))
+	normal := r.Track.SectionBaseFace(section).Normal
+	across := engine.Vec3Cross(along, normal)
+
+	side := gl.Float(raceGridSpread)
+	if slot%2 == 1 {
+		side = -side
+	}
+	pos := engine.Vec3Add(section.Center, engine.Vec3MulF(across, side))
+	pos = engine.Vec3Add(pos, engine.Vec3MulF(normal, ShipTrackFloat))
+
+	// Forward is (-sin(yaw), 0, cos(yaw))
+	yaw := gl.Float(math.Atan2(float64(-along.X), float64(along.Z)))
+	ship.Place(pos, yaw)
+}
+
+// Started reports whether the countdown is over
+func (r *Race) Started() bool {
+	return r.Countdown <= 0
+}
+
+// Update runs as many fixed steps as fit into tickLast
+func (r *Race) Update(tickLast float64) int {
+	r.accumulator += tickLast
+
+	steps := 0
+	for r.accumulator >= ShipTick {
+		if steps == ShipMaxSteps {
+			r.accumulator = 0
+			break
+		}
+		r.Step()
+		r.accumulator -= ShipTick
+		steps++
+	}
+
+	return steps
+}
+
+// Step advances the race by one ShipTick. During the countdown the ships
+// only hover on the grid.
+func (r *Race) Step() {
+	if r.Countdown > 0 {
+		r.Countdown -= ShipTick
+		for _, p := range r.Pilots {
+			p.Ship.Step(ShipInput{})
+		}
+		return
+	}
+
+	r.Time += ShipTick
+	for _, p := range r.Pilots {
+		p.Ship.Step(p.Control.Input(p.Ship))
+		r.updateProgress(p)
+	}
+	r.updateRanks()
+
+	if r.OnStep != nil {
+		r.OnStep()
+	}
+}
+
+// Position returns the 1 based race position of p
+func (r *Race) Position(p *RacePilot) int {
+	for i := range r.Ranks {
+		if r.Ranks[i] == p {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Finish ends the race. Pilots still racing are given the time they would
+// take at their average pace so far.
+func (r *Race) Finish() {
+	count := len(r.Track.Sections)
+	total := NumLaps * count
+
+	for _, p := range r.Pilots {
+		if p.Finished {
+			continue
+		}
+
+		progress := max(p.Progress, 1)
+		estimate := r.Time * float32(total) / float32(progress)
+		if estimate <= r.Time {
+			estimate = r.Time + ShipTick
+		}
+
+		perLap := (estimate - p.LapStart) / float32(NumLaps-p.Lap)
+		for lap := p.Lap; lap < NumLaps; lap++ {
+			p.LapTimes[lap] = perLap
+		}
+		p.Lap = NumLaps
+		p.Finished = true
+		p.FinishTime = estimate
+	}
+
+	r.updateRanks()
+}
+
+// BestLap returns the fastest completed lap of p, or 0 if there is none
+func (p *RacePilot) BestLap() float32 {
+	var best float32
+	for lap := 0; lap < p.Lap; lap++ {
+		if best == 0 || p.LapTimes[lap] < best {
+			best = p.LapTimes[lap]
+		}
+	}
+	return best
+}
+
+func (r *Race) updateProgress(p *RacePilot) {
+	if p.Ship.Section == nil || p.Ship.Section.Num == p.sectionNum {
+		return
+	}
+
+	num := p.Ship.Section.Num
+	p.Progress += r.sectionDelta(p.sectionNum, num)
+	p.sectionNum = num
+
+	count := len(r.Track.Sections)
+	for !p.Finished && p.Progress >= (p.Lap+1)*count {
+		p.LapTimes[p.Lap] = r.Time - p.LapStart
+		p.LapStart = r.Time
+		p.Lap++
+		if p.Lap == NumLaps {
+			p.Finished = true
+			p.FinishTime = r.Time
+		}
+	}
+}
+
+// updateRanks orders the pilots: finished ones by time, the others by how
+// far they are along the track
+func (r *Race) updateRanks() {
+	sort.SliceStable(r.Ranks, func(i, j int) bool {
+		a, b := r.Ranks[i], r.Ranks[j]
+		if a.Finished != b.Finished {
+			return a.Finished
+		}
+		if a.Finished {
+			return a.FinishTime < b.FinishTime
+		}
+		if a.Progress != b.Progress {
+			return a.Progress > b.Progress
+		}
+		return r.sectionDistance(a.Ship) > r.sectionDistance(b.Ship)
+	})
+}
+
+// sectionDistance returns how far the ship is past its section center
+func (r *Race) sectionDistance(ship *Ship) gl.Float {
+	s := ship.Section
+	if s == nil || s.Next == nil {
+		return 0
+	}
+	along := engine.Vec3Normalize(engine.Vec3Sub(s.Next.Center, s.Center))
+	return engine.Vec3Dot(engine.Vec3Sub(ship.Position, s.Center), along)
+}
+
+// sectionDelta returns the number of sections from a to b, wrapped to less
+// than half a lap in either direction
+func (r *Race) sectionDelta(a, b int) int {
+	count := len(r.Track.Sections)
+	if count == 0 {
+		return 0
+	}
+	delta := ((b-a)%count + count) % count
+	if delta >= count/2 {
+		delta -= count
+	}
+	return delta
+}
+
+func (r *Race) startSection() *track.Section {
+	for i := range r.Track.Sections {
+		if r.Track.Sections[i].Num == r.StartLine {
+			return &r.Track.Sections[i]
+		}
+	}
+	return nil
+}
+
+// RaceRecords reports whether bestLap beats the lap record of hs and whether
+// raceTime earns a place in its table.
+func RaceRecords(hs *HighScores, bestLap, raceTime float32) (lapRecord, raceRecord bool) {
+	lapRecord = bestLap > 0 && bestLap < hs.LapRecord
+	raceRecord = HighscoreRank(hs, raceTime) >= 0
+	return lapRecord, raceRecord
+}
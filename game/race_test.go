@@ -0,0 +1,212 @@
+package game
+
+import (
+	"math"
+	"testing"
+)
+
+const testStartLine = 10
+
+func newTestRace(pilots int) *Race {
+	trk := ringTrack(64, testRingRadius, testRingWidth)
+	r := NewRace(trk, testStartLine)
+	for i := 0; i < pilots; i++ {
+		ship := NewShip(i, int(RaceClassVenom), trk)
+		r.PlaceOnGrid(ship, i)
+		r.AddPilot(i, ship, NewAIController(int(RaceClassVenom), NumAIOpponents-1-i, int64(i)))
+	}
+	return r
+}
+
+func TestRaceGrid(t *testing.T) {
+	r := newTestRace(4)
+
+	wantSections := []int{testStartLine - 1, testStartLine - 1, testStartLine - 2, testStartLine - 2}
+	for i, p := range r.Pilots {
+		if p.Ship.Section.Num != wantSections[i] {
+			t.Errorf("pilot %d on section %d, want %d", i, p.Ship.Section.Num, wantSections[i])
+		}
+		if p.Progress != wantSections[i]-testStartLine {
+			t.Errorf("pilot %d progress %d, want %d", i, p.Progress, wantSections[i]-testStartLine)
+		}
+	}
+	if r.Pilots[0].Ship.Position == r.Pilots[1].Ship.Position {
+		t.Errorf("ships of a grid row share a position")
+	}
+}
+
+func TestRaceCountdown(t *testing.T) {
+	r := newTestRace(1)
+	start := r.Pilots[0].Ship.Position
+
+	r.Update(RaceCountdownTime / 2)
+	if r.Started() || r.Time != 0 {
+		t.Fatalf("race started during the countdown, time %.2f", r.Time)
+	}
+	if d := math.Abs(float64(r.Pilots[0].Ship.Position.Z - start.Z)); d > 1 {
+		t.Errorf("ship moved %.1f during the countdown", d)
+	}
+
+	for !r.Started() {
+		r.Step()
+	}
+	r.Step()
+	if r.Time <= 0 {
+		t.Errorf("race time did not advance after the countdown")
+	}
+}
+
+func TestRaceLaps(t *testing.T) {
+	r := newTestRace(1)
+	p := r.Pilots[0]
+
+	for n := 0; n < int(300/ShipTick) && !p.Finished; n++ {
+		r.Step()
+	}
+	if !p.Finished {
+		t.Fatalf("pilot did not finish, lap %d progress %d", p.Lap, p.Progress)
+	}
+	if p.Lap != NumLaps {
+		t.Errorf("lap = %d, want %d", p.Lap, NumLaps)
+	}
+
+	var sum float32
+	for lap, time := range p.LapTimes {
+		if time <= 0 {
+			t.Errorf("lap %d time %.2f", lap, time)
+		}
+		sum += time
+	}
+	if math.Abs(float64(sum-p.FinishTime)) > 1e-3 {
+		t.Errorf("lap times add up to %.3f, finish time %.3f", sum, p.FinishTime)
+	}
+	if p.BestLap() <= 0 || p.BestLap() > p.LapTimes[0] {
+		t.Errorf("best lap %.2f, first lap %.2f", p.BestLap(), p.LapTimes[0])
+	}
+}
+
+func TestRaceProgressDirection(t *testing.T) {
+	r := newTestRace(1)
+	p := r.Pilots[0]
+	sections := r.Track.Sections
+	count := len(sections)
+	r.Countdown = 0
+
+	move := func(steps, dir int) {
+		for i := 0; i < steps; i++ {
+			next := (p.Ship.Section.Num + dir + count) % count
+			p.Ship.Section = &sections[next]
+			r.Time += 1
+			r.updateProgress(p)
+		}
+	}
+
+	// Driving a full lap backwards counts nothing
+	move(count, -1)
+	if p.Lap != 0 {
+		t.Fatalf("lap = %d after driving backwards", p.Lap)
+	}
+
+	// The lap backwards has to be made up first
+	move(count+1, 1)
+	if p.Lap != 0 {
+		t.Fatalf("lap = %d before crossing the line", p.Lap)
+	}
+	move(count, 1)
+	if p.Lap != 1 {
+		t.Errorf("lap = %d, want 1", p.Lap)
+	}
+	if p.LapTimes[0] != r.Time {
+		t.Errorf("lap time %.0f, want %.0f", p.LapTimes[0], r.Time)
+	}
+}
+
+func TestRaceRanks(t *testing.T) {
+	r := newTestRace(3)
+	a, b, c := r.Pilots[0], r.Pilots[1], r.Pilots[2]
+
+	a.Progress = 5
+	b.Progress = 20
+	c.Progress = 12
+	r.updateRanks()
+	if r.Position(b) != 1 || r.Position(c) != 2 || r.Position(a) != 3 {
+		t.Errorf("positions a %d, b %d, c %d", r.Position(a), r.Position(b), r.Position(c))
+	}
+
+	// Finishers stay ahead of pilots still racing
+	a.Finished = true
+	a.FinishTime = 100
+	r.updateRanks()
+	if r.Position(a) != 1 {
+		t.Errorf("finished pilot at position %d", r.Position(a))
+	}
+}
+
+func TestRaceFinish(t *testing.T) {
+	r := newTestRace(2)
+	count := len(r.Track.Sections)
+	winner, other := r.Pilots[0], r.Pilots[1]
+
+	r.Time = 90
+	winner.Finished = true
+	winner.FinishTime = 90
+	winner.Lap = NumLaps
+	winner.LapTimes = [NumLaps]float32{30, 30, 30}
+
+	// Halfway through the race after one lap of 40s
+	other.Progress = NumLaps * count / 2
+	other.Lap = 1
+	other.LapTimes[0] = 40
+	other.LapStart = 40
+
+	r.Finish()
+	if !other.Finished {
+		t.Fatalf("pilot still racing after Finish")
+	}
+	if math.Abs(float64(other.FinishTime-180)) > 1e-3 {
+		t.Errorf("estimated finish %.2f, want 180", other.FinishTime)
+	}
+	var sum float32
+	for _, time := range other.LapTimes {
+		sum += time
+	}
+	if math.Abs(float64(sum-other.FinishTime)) > 1e-3 {
+		t.Errorf("lap times add up to %.2f, want %.2f", sum, other.FinishTime)
+	}
+	if r.Position(winner) != 1 || r.Position(other) != 2 {
+		t.Errorf("positions winner %d, other %d", r.Position(winner), r.Position(other))
+	}
+}
+
+func TestRaceRecords(t *testing.T) {
+	hs := &HighScores{
+		LapRecord: 60,
+		Entries: [NumHighscores]HighScoreEntry{
+			{"AAA", 180}, {"BBB", 190}, {"CCC", 200}, {"DDD", 210}, {"EEE", 220},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		bestLap  float32
+		raceTime float32
+		wantLap  bool
+		wantRace bool
+	}{
+		{"both", 55, 170, true, true},
+		{"table only", 65, 215, false, true},
+		{"lap only", 59, 230, true, false},
+		{"none", 61, 221, false, false},
+		{"equal is no record", 60, 220, false, false},
+		{"no time", 0, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lap, race := RaceRecords(hs, tt.bestLap, tt.raceTime)
+			if lap != tt.wantLap || race != tt.wantRace {
+				t.Errorf("RaceRecords() = %v, %v, want %v, %v", lap, race, tt.wantLap, tt.wantRace)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package game
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+)
+
+const (
+	// Seconds the finish message is shown before the results
+	raceFinishDelay = 2.0
+
+	raceCameraDistance = 1200
+	raceCameraHeight   = 300
+)
+
+// raceCountdownSfx are the voices for each number of the countdown
+var raceCountdownSfx = [...]SfxE{SfxVoiceCountGo, SfxVoiceCount1, SfxVoiceCount2, SfxVoiceCount3}
+
+type raceState int
+
+const (
+	raceStateRunning raceState = iota
+	raceStateFinished
+	raceStateResults
+	raceStateNameEntry
+	raceStateStandings
+)
+
+// RaceScene runs a race on the circuit, class and team chosen in the menu
+type RaceScene struct {
+	g          *Game
+	race       *Race
+	player     *RacePilot
+	shipModels *Object
+	// shipTextures are the textures of shipModels, released on Cleanup
+	shipTextures TextureList
+	state        raceState
+	stateTime    float64
+
+	championship bool
+	outcome      ChampionshipOutcome
+	nameEntry    *NameEntry
+
+	// engineVoices hum for each pilot of the race
+	engineVoices []engine.Voice
+
+	// replay records the player, or drives them when playing back
+	replay *ReplayController
+	// ghost races the player's best lap in time trial
+	ghost *GhostRecorder
+}
+
+func NewRaceScene(g *Game) *RaceScene {
+	return &RaceScene{
+		g: g,
+	}
+}
+
+func (r *RaceScene) Init() error {
+	g := r.g
+	r.race = nil
+	r.player = nil
+	r.state = raceStateRunning
+	r.stateTime = 0
+	r.nameEntry = nil
+	r.championship = RaceTypeE(g.RaceType) == RaceTypeChampionship && g.championship != nil
+	if g.replay != nil {
+		r.replay = &ReplayController{Replay: g.replay, Playback: true}
+		r.championship = false
+		g.replay = nil
+	} else {
+		r.replay = &ReplayController{Replay: NewReplay(g)}
+	}
+
+	g.RaceTime = 0
+	g.BestLap = 0
+	g.RacePosition = 0
+	g.IsNewLapRecord = false
+	g.IsNewRaceRecord = false
+	g.LapTimes = [NumPilots][NumLaps]float32{}
+	g.RaceRanks = [NumPilots]PilotPoints{}
+
+	settings := &Def.Circuits[g.Circuit].Settings[g.RaceClass]
+	trk, err := track.Load(settings.Path)
+	if err != nil {
+		return err
+	}
+	race := NewRace(trk, int(settings.StartLinePos))
+
+	// Opponents fill the grid in front of the player
+	slot := 0
+	var ais []*AIController
+	if RaceTypeE(g.RaceType) != RaceTypeTimeTrial {
+		for pilot := 0; pilot < int(NumPilots); pilot++ {
+			if pilot == g.Pilot {
+				continue
+			}
+			ship := NewShip(pilot, g.RaceClass, trk)
+			race.PlaceOnGrid(ship, slot)
+			ai := NewAIController(g.RaceClass, len(ais), g.Seed+int64(len(ais)))
+			race.AddPilot(pilot, ship, ai)
+			ais = append(ais, ai)
+			slot++
+		}
+	}
+
+	ship := NewShip(g.Pilot, g.RaceClass, trk)
+	race.PlaceOnGrid(ship, slot)
+	r.player = race.AddPilot(g.Pilot, ship, r.replay)
+
+	for i, ai := range ais {
+		for j, p := range race.Pilots {
+			if i != j {
+				ai.Rivals = append(ai.Rivals, p.Ship)
+			}
+		}
+	}
+	r.race = race
+	r.ghost = nil
+	if RaceTypeE(g.RaceType) == RaceTypeTimeTrial {
+		r.ghost = NewGhostRecorder(race, r.player, g.RaceClass, g.Circuit, r.loadGhost(trk))
+		race.OnStep = r.ghost.Step
+	}
+	r.engineVoices = make([]engine.Voice, len(race.Pilots))
+	g.PlaySfx(raceCountdownSfx[len(raceCountdownSfx)-1])
+
+	r.shipModels = nil
+	r.shipTextures, err = ImageGetCompressedTexture("data/common/allsh.cmp", g.render)
+	if err == nil {
+		r.shipModels, err = ObjectsLoad("data/common/allsh.prm", r.shipTextures)
+	}
+	if err != nil {
+		Logger.Printf("race: ship models: %s", err)
+	}
+
+	return nil
+}
+
+func (r *RaceScene) Cleanup() {
+	r.shipModels = nil
+	r.shipTextures.Release(r.g.render)
+}
+
+func (r *RaceScene) Update() error {
+	g := r.g
+	ui := g.ui
+
+	if r.race == nil {
+		g.render.SetView2d()
+		ui.DrawTextCentered("CIRCUIT NOT AVAILABLE", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, -8)), UITextSize16, UIColorDefault)
+		if engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuBack)) || engine.InputPressed(byte(AMenuQuit)) {
+			g.SetScene(GameSceneMainMenu)
+		}
+		return nil
+	}
+
+	if r.state == raceStateRunning && engine.InputPressed(byte(AMenuQuit)) {
+		g.SetScene(GameSceneMainMenu)
+		return nil
+	}
+
+	count := r.countdownCount()
+	r.race.Update(g.TickLast)
+	r.stateTime += g.TickLast
+	if r.ghost != nil && r.ghost.Improved && !r.replay.Playback {
+		r.saveGhost()
+	}
+	if next := r.countdownCount(); next != count && next < len(raceCountdownSfx) {
+		g.PlaySfx(raceCountdownSfx[next])
+	}
+	r.updateSound()
+
+	switch r.state {
+	case raceStateRunning:
+		g.RaceTime = r.race.Time
+		g.RacePosition = r.race.Position(r.player)
+		if r.player.Finished {
+			r.finish()
+		}
+	case raceStateFinished:
+		if r.stateTime > raceFinishDelay {
+			r.state = raceStateResults
+		}
+	case raceStateResults:
+		if engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuStart)) {
+			if g.IsNewRaceRecord {
+				r.nameEntry = NewNameEntry(g.save.HighscoresName)
+				r.nameEntry.Start()
+				r.state = raceStateNameEntry
+			} else {
+				r.afterResults()
+			}
+		}
+	case raceStateNameEntry:
+		if r.nameEntry.Done {
+			r.endNameEntry()
+		}
+	case raceStateStandings:
+		if engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuStart)) {
+			r.nextRace()
+		}
+	}
+
+	err := r.draw()
+	if err != nil {
+		return err
+	}
+
+	g.render.SetView2d()
+	switch r.state {
+	case raceStateRunning:
+		r.drawHud()
+	case raceStateFinished:
+		ui.DrawTextCentered("RACE COMPLETE", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, -8)), UITextSize16, UIColorAccent)
+	case raceStateResults:
+		r.drawResults()
+	case raceStateNameEntry:
+		r.drawNameEntry()
+	case raceStateStandings:
+		r.drawStandings()
+	}
+
+	return nil
+}
+
+// finish ends the race for everyone once the player crossed the line and
+// stores the outcome in the game
+func (r *RaceScene) finish() {
+	g := r.g
+	r.race.Finish()
+
+	for _, p := range r.race.Pilots {
+		g.LapTimes[p.Pilot] = p.LapTimes
+	}
+	for i, p := range r.race.Ranks {
+		g.RaceRanks[i] = PilotPoints{Pilot: uint16(p.Pilot), Points: uint16(Def.RaceModeForRank[i])}
+	}
+	g.RaceTime = r.player.FinishTime
+	g.BestLap = r.player.BestLap()
+	g.RacePosition = r.race.Position(r.player)
+
+	r.state = raceStateFinished
+	r.stateTime = 0
+
+	// A replay only shows the race again, it counts for nothing
+	if r.replay.Playback {
+		return
+	}
+	r.saveReplay()
+
+	hs := &g.save.Highscores[g.RaceClass][g.Circuit][g.highscoreTab()]
+	g.IsNewLapRecord, g.IsNewRaceRecord = RaceRecords(hs, g.BestLap, g.RaceTime)
+	if HighscoreLapRecord(hs, g.BestLap) {
+		g.save.IsDirty = true
+	}
+
+	if r.championship {
+		order := make([]int, len(r.race.Ranks))
+		for i, p := range r.race.Ranks {
+			order[i] = p.Pilot
+		}
+		r.outcome = g.championship.RaceFinished(order, &g.save)
+		g.syncChampionship()
+	}
+}
+
+// saveReplay keeps the recording of the race and writes it next to the save
+func (r *RaceScene) saveReplay() {
+	g := r.g
+	g.LastReplay = r.replay.Replay
+
+	path, err := ReplayPath()
+	if err == nil {
+		err = g.LastReplay.Write(path)
+	}
+	if err != nil {
+		Logger.Printf("replay: %s", err)
+	}
+}
+
+// loadGhost returns the saved ghost for the class and circuit of the race,
+// or nil if there is none for this track
+func (r *RaceScene) loadGhost(trk *track.Track) *Ghost {
+	g := r.g
+	path, err := GhostPath(g.RaceClass, g.Circuit)
+	if err != nil {
+		Logger.Printf("ghost: %s", err)
+		return nil
+	}
+	ghost, err := GhostLoad(path, g.RaceClass, g.Circuit, trk)
+	if err != nil {
+		Logger.Printf("ghost: %s", err)
+		return nil
+	}
+	return ghost
+}
+
+// saveGhost writes the new best lap for the class and circuit
+func (r *RaceScene) saveGhost() {
+	r.ghost.Improved = false
+
+	path, err := GhostPath(r.g.RaceClass, r.g.Circuit)
+	if err == nil {
+		err = r.ghost.Best.Write(path)
+	}
+	if err != nil {
+		Logger.Printf("ghost: %s", err)
+	}
+}
+
+// countdownCount returns the number the countdown shows, 0 once started
+func (r *RaceScene) countdownCount() int {
+	return int(math.Ceil(float64(r.race.Countdown)))
+}
+
+// endNameEntry enters the player's time under the entered name, unless the
+// entry was cancelled, and moves on
+func (r *RaceScene) endNameEntry() {
+	g := r.g
+	if !r.nameEntry.Cancelled {
+		r.nameEntry.Save(&g.save)
+		hs := &g.save.Highscores[g.RaceClass][g.Circuit][g.highscoreTab()]
+		HighscoreInsert(hs, r.nameEntry.String(), g.RaceTime)
+		g.save.IsDirty = true
+	}
+	r.afterResults()
+}
+
+// afterResults shows the standings of a championship or leaves the race
+func (r *RaceScene) afterResults() {
+	if r.championship {
+		r.state = raceStateStandings
+		return
+	}
+	r.g.SetScene(GameSceneMainMenu)
+}
+
+// nextRace moves on after the results, to the next championship race or
+// back to the menu
+func (r *RaceScene) nextRace() {
+	g := r.g
+	if r.championship && (r.outcome == ChampionshipNextRace || r.outcome == ChampionshipRetry) {
+		g.Circuit = g.championship.Circuit
+		g.Seed = time.Now().UnixNano()
+		g.SetScene(GameSceneRace)
+		return
+	}
+
+	g.championship = nil
+	g.SetScene(GameSceneMainMenu)
+}
+
+// camera returns the position of the chase camera behind the player
+func (r *RaceScene) camera() engine.Vec3 {
+	ship := r.player.Ship
+	camera := engine.Vec3Sub(ship.Position, engine.Vec3MulF(ship.DirForward, raceCameraDistance))
+	return engine.Vec3Add(camera, engine.Vec3MulF(ship.DirUp, raceCameraHeight))
+}
+
+// updateSound hears the race from the camera, which moves with the player,
+// and keeps the engine hum of every ship at its position
+func (r *RaceScene) updateSound() {
+	g := r.g
+	player := r.player.Ship
+	g.audio.SetListener(engine.Listener{
+		Position: r.camera(),
+		Velocity: player.Velocity,
+		Right:    player.DirRight,
+	})
+
+	for i, p := range r.race.Pilots {
+		volume, pitch := p.Ship.EngineSound()
+		e := engine.Emitter{Position: p.Ship.Position, Velocity: p.Ship.Velocity, Volume: volume}
+		if g.audio.Playing(r.engineVoices[i]) {
+			g.audio.Update3d(r.engineVoices[i], e, pitch)
+		} else {
+			r.engineVoices[i] = g.PlaySfx3d(SfxEngineThrust, e, pitch, true)
+		}
+	}
+}
+
+func (r *RaceScene) draw() error {
+	render := r.g.render
+	ship := r.player.Ship
+	render.SetView(r.camera(), engine.NewVec3(ship.Angle.X, ship.Angle.Y, 0))
+
+	noTexture := render.NoTexture()
+	faces := r.race.Track.Faces
+	for i := range faces {
+		for _, tris := range faces[i].Tris {
+			err := render.PushTris(tris, noTexture)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.shipModels == nil {
+		return nil
+	}
+	for _, p := range r.race.Pilots {
+		model := r.shipModels.At(Def.ShipModelToPilot[p.Pilot])
+		if model == nil {
+			continue
+		}
+		mat := p.Ship.Mat()
+		err := model.Draw(render, &mat)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.drawGhost()
+}
+
+// drawGhost shows the best lap as a translucent ship at the same lap time
+// as the player
+func (r *RaceScene) drawGhost() error {
+	if r.ghost == nil || !r.race.Started() || r.player.Finished {
+		return nil
+	}
+	frame := r.ghost.Best.At(r.race.Time - r.player.LapStart)
+	model := r.shipModels.At(Def.ShipModelToPilot[r.player.Pilot])
+	if frame == nil || model == nil {
+		return nil
+	}
+
+	render := r.g.render
+	render.SetBlendMode(engine.RenderBlendModeLighter)
+	render.SetDepthWrite(false)
+	mat := frame.Mat()
+	err := model.Draw(render, &mat)
+	render.SetDepthWrite(true)
+	render.SetBlendMode(engine.RenderBlendModeNormal)
+
+	return err
+}
+
+func (r *RaceScene) drawHud() {
+	ui := r.g.ui
+	race := r.race
+
+	if !race.Started() {
+		count := strconv.Itoa(int(math.Ceil(float64(race.Countdown))))
+		ui.DrawTextCentered(count, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, -8)), UITextSize16, UIColorAccent)
+		return
+	}
+	if race.Time < 1 {
+		ui.DrawTextCentered("GO", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, -8)), UITextSize16, UIColorAccent)
+	}
+
+	lap := min(r.player.Lap+1, NumLaps)
+	ui.DrawText("LAP", ui.ScaledPos(UIPosTop|UIPosLeft, engine.NewVec2i(16, 16)), UITextSize8, UIColorDefault)
+	ui.DrawText(strconv.Itoa(lap)+" OF "+strconv.Itoa(NumLaps), ui.ScaledPos(UIPosTop|UIPosLeft, engine.NewVec2i(16, 26)), UITextSize16, UIColorDefault)
+
+	if len(race.Pilots) > 1 {
+		ui.DrawText("POSITION", ui.ScaledPos(UIPosTop|UIPosRight, engine.NewVec2i(-80, 16)), UITextSize8, UIColorDefault)
+		ui.DrawNumber(r.g.RacePosition, ui.ScaledPos(UIPosTop|UIPosRight, engine.NewVec2i(-80, 26)), UITextSize16, UIColorDefault)
+	}
+
+	ui.DrawTime(race.Time, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(-40, 16)), UITextSize16, UIColorDefault)
+	ui.DrawTime(race.Time-r.player.LapStart, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(-24, 36)), UITextSize8, UIColorDefault)
+
+	ui.DrawNumber(int(r.player.Ship.Speed/10), ui.ScaledPos(UIPosBottom|UIPosRight, engine.NewVec2i(-80, -30)), UITextSize16, UIColorDefault)
+}
+
+func (r *RaceScene) drawResults() {
+	g := r.g
+	ui := g.ui
+
+	ui.DrawTextCentered("RACE RESULTS", ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 30)), UITextSize16, UIColorAccent)
+
+	pos := engine.NewVec2i(-150, 60)
+	for i, p := range r.race.Ranks {
+		color := UIColorDefault
+		if p == r.player {
+			color = UIColorAccent
+		}
+		ui.DrawNumber(i+1, ui.ScaledPos(UIPosTop|UIPosCenter, pos), UITextSize8, color)
+		ui.DrawText(Def.Pilots[p.Pilot].Name, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(pos.X+20, pos.Y)), UITextSize8, color)
+		ui.DrawTime(p.FinishTime, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(pos.X+240, pos.Y)), UITextSize8, color)
+		pos.Y += 12
+	}
+
+	pos.Y += 12
+	if g.IsNewRaceRecord {
+		ui.DrawTextCentered("NEW RACE RECORD", ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, pos.Y)), UITextSize8, UIColorAccent)
+		pos.Y += 12
+	}
+	if g.IsNewLapRecord {
+		ui.DrawTextCentered("NEW LAP RECORD", ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, pos.Y)), UITextSize8, UIColorAccent)
+	}
+
+	ui.DrawTextCentered("PRESS ENTER", ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -40)), UITextSize16, UIColorDefault)
+}
+
+func (r *RaceScene) drawStandings() {
+	g := r.g
+	ui := g.ui
+
+	ui.DrawTextCentered("CHAMPIONSHIP STANDINGS", ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, 30)), UITextSize16, UIColorAccent)
+
+	pos := engine.NewVec2i(-150, 60)
+	for i, rank := range g.ChampionshipRanks {
+		color := UIColorDefault
+		if int(rank.Pilot) == g.Pilot {
+			color = UIColorAccent
+		}
+		ui.DrawNumber(i+1, ui.ScaledPos(UIPosTop|UIPosCenter, pos), UITextSize8, color)
+		ui.DrawText(Def.Pilots[rank.Pilot].Name, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(pos.X+20, pos.Y)), UITextSize8, color)
+		ui.DrawNumber(int(rank.Points), ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(pos.X+260, pos.Y)), UITextSize8, color)
+		pos.Y += 12
+	}
+
+	var message string
+	switch r.outcome {
+	case ChampionshipNextRace:
+		message = "QUALIFIED FOR THE NEXT RACE"
+	case ChampionshipRetry:
+		message = "FAILED TO QUALIFY  LIVES LEFT " + strconv.Itoa(g.Lives)
+	case ChampionshipGameOver:
+		message = "GAME OVER"
+	case ChampionshipComplete:
+		message = "CHAMPIONSHIP COMPLETE"
+	case ChampionshipWon:
+		message = "CONGRATULATIONS  YOU WON THE CHAMPIONSHIP"
+	}
+	ui.DrawTextCentered(message, ui.ScaledPos(UIPosTop|UIPosCenter, engine.NewVec2i(0, pos.Y+12)), UITextSize8, UIColorAccent)
+
+	ui.DrawTextCentered("PRESS ENTER", ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -40)), UITextSize16, UIColorDefault)
+}
+
+func (r *RaceScene) drawNameEntry() {
+	g := r.g
+	ui := g.ui
+
+	ui.DrawTextCentered("NEW RACE RECORD", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, -60)), UITextSize16, UIColorAccent)
+	ui.DrawTime(g.RaceTime, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(-40, -36)), UITextSize16, UIColorDefault)
+	ui.DrawTextCentered("ENTER YOUR NAME", ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, 0)), UITextSize8, UIColorDefault)
+
+	name := r.nameEntry.String()
+	if len(name) < HighscoreNameLen && int(r.stateTime*2)%2 == 0 {
+		name += "."
+	}
+	ui.DrawTextCentered(name, ui.ScaledPos(UIPosMiddle|UIPosCenter, engine.NewVec2i(0, 16)), UITextSize16, UIColorAccent)
+}
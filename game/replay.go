@@ -0,0 +1,235 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+const (
+	ReplayMagic    = 0x70727077
+	ReplayVersion  = 1
+	ReplayFileName = "last.replay"
+	ReplayDirName  = "replays"
+
+	// replayHeaderSize is magic, version, seed, circuit, class, race type,
+	// team, pilot and the number of ticks
+	replayHeaderSize = 4 + 4 + 8 + 5 + 4
+)
+
+var ErrReplayCorrupted = errors.New("replay data corrupted")
+
+// ReplayFrame holds the user layer actions of one simulation tick
+type ReplayFrame [NumGameActions]float32
+
+// Replay is everything needed to run a race again: the setup and the
+// player's actions for every tick after the countdown. The AI draws from
+// the seed, so the whole race plays out the same.
+type Replay struct {
+	Seed      int64
+	Circuit   int
+	RaceClass int
+	RaceType  int
+	Team      int
+	Pilot     int
+	Frames    []ReplayFrame
+}
+
+// NewReplay starts an empty replay of the race g is set up for
+func NewReplay(g *Game) *Replay {
+	return &Replay{
+		Seed:      g.Seed,
+		Circuit:   g.Circuit,
+		RaceClass: g.RaceClass,
+		RaceType:  g.RaceType,
+		Team:      g.Team,
+		Pilot:     g.Pilot,
+	}
+}
+
+// ReplayPath returns the location of the replay of the last race
+func ReplayPath() (string, error) {
+	return configPath(ReplayDirName, ReplayFileName)
+}
+
+// ReplayLoad reads a replay written by Replay.Write
+func ReplayLoad(path string) (*Replay, error) {
+	rp := &Replay{}
+	if err := loadChecked(path, rp); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Write stores the replay atomically at path, creating its directory
+func (rp *Replay) Write(path string) error {
+	return writeChecked(path, rp)
+}
+
+// Record appends the current state of the user layer actions
+func (rp *Replay) Record() {
+	var frame ReplayFrame
+	copy(frame[:], engine.ActionsState[:NumGameActions])
+	rp.Frames = append(rp.Frames, frame)
+}
+
+// Apply feeds the actions of tick into the input layer. Ticks past the end
+// of the replay release everything.
+func (rp *Replay) Apply(tick int) {
+	var frame ReplayFrame
+	if tick < len(rp.Frames) {
+		frame = rp.Frames[tick]
+	}
+	for action, state := range frame {
+		engine.InputSetActionState(byte(action), state)
+	}
+}
+
+// MarshalBinary encodes the replay as a checked file. The frames are stored
+// as runs of equal frames: a u16 length, a u16 mask of the actions that are
+// held, a u16 mask of those held only partially, and a float32 for each of
+// the partial ones.
+func (rp *Replay) MarshalBinary() ([]byte, error) {
+	size := replayHeaderSize + 4
+	for i := 0; i < len(rp.Frames); {
+		n := replayRunLength(rp.Frames, i)
+		_, partial := replayMasks(&rp.Frames[i])
+		size += 6 + 4*bits.OnesCount16(partial)
+		i += n
+	}
+
+	bytes, p := checkedFileNew(ReplayMagic, ReplayVersion, size)
+	engine.PutU32LE(bytes, &p, uint32(rp.Seed))
+	engine.PutU32LE(bytes, &p, uint32(rp.Seed>>32))
+	engine.PutU8(bytes, &p, byte(rp.Circuit))
+	engine.PutU8(bytes, &p, byte(rp.RaceClass))
+	engine.PutU8(bytes, &p, byte(rp.RaceType))
+	engine.PutU8(bytes, &p, byte(rp.Team))
+	engine.PutU8(bytes, &p, byte(rp.Pilot))
+	engine.PutU32LE(bytes, &p, uint32(len(rp.Frames)))
+
+	for i := 0; i < len(rp.Frames); {
+		n := replayRunLength(rp.Frames, i)
+		frame := &rp.Frames[i]
+		held, partial := replayMasks(frame)
+		engine.PutU16LE(bytes, &p, uint16(n))
+		engine.PutU16LE(bytes, &p, held)
+		engine.PutU16LE(bytes, &p, partial)
+		for action := range frame {
+			if partial&(1<<action) != 0 {
+				engine.PutU32LE(bytes, &p, math.Float32bits(frame[action]))
+			}
+		}
+		i += n
+	}
+
+	checkedFileSeal(bytes, &p)
+
+	return bytes, nil
+}
+
+// UnmarshalBinary decodes a replay written by MarshalBinary
+func (rp *Replay) UnmarshalBinary(bytes []byte) error {
+	if len(bytes) < replayHeaderSize+4 {
+		return ErrReplayCorrupted
+	}
+	_, p, err := checkedFileOpen(bytes, ReplayMagic, ReplayVersion, ReplayVersion, ErrReplayCorrupted)
+	if err != nil {
+		return err
+	}
+
+	var nr Replay
+	nr.Seed = int64(engine.GetU32LE(bytes, &p))
+	nr.Seed |= int64(engine.GetU32LE(bytes, &p)) << 32
+	nr.Circuit = int(engine.GetU8(bytes, &p))
+	nr.RaceClass = int(engine.GetU8(bytes, &p))
+	nr.RaceType = int(engine.GetU8(bytes, &p))
+	nr.Team = int(engine.GetU8(bytes, &p))
+	nr.Pilot = int(engine.GetU8(bytes, &p))
+	if nr.Circuit >= int(NumCircuits) || nr.RaceClass >= int(NumRaceClasses) || nr.RaceType >= int(NumRaceTypes) ||
+		nr.Team >= int(NumTeams) || nr.Pilot >= int(NumPilots) {
+		return fmt.Errorf("%w: invalid race setup", ErrReplayCorrupted)
+	}
+
+	count := int(engine.GetU32LE(bytes, &p))
+	end := uint32(len(bytes) - 4)
+	nr.Frames = make([]ReplayFrame, 0, min(count, len(bytes)))
+	for len(nr.Frames) < count {
+		if p+6 > end {
+			return fmt.Errorf("%w: truncated", ErrReplayCorrupted)
+		}
+		n := int(engine.GetU16LE(bytes, &p))
+		held := engine.GetU16LE(bytes, &p)
+		partial := engine.GetU16LE(bytes, &p)
+		if n == 0 || len(nr.Frames)+n > count || partial&^held != 0 || held>>NumGameActions != 0 ||
+			p+4*uint32(bits.OnesCount16(partial)) > end {
+			return fmt.Errorf("%w: invalid run", ErrReplayCorrupted)
+		}
+
+		var frame ReplayFrame
+		for action := range frame {
+			if partial&(1<<action) != 0 {
+				frame[action] = math.Float32frombits(engine.GetU32LE(bytes, &p))
+			} else if held&(1<<action) != 0 {
+				frame[action] = 1
+			}
+		}
+		for i := 0; i < n; i++ {
+			nr.Frames = append(nr.Frames, frame)
+		}
+	}
+	if p != end {
+		return fmt.Errorf("%w: trailing data", ErrReplayCorrupted)
+	}
+
+	*rp = nr
+
+	return nil
+}
+
+// replayRunLength returns how many frames from i on equal frames[i]
+func replayRunLength(frames []ReplayFrame, i int) int {
+	n := 1
+	for i+n < len(frames) && n < math.MaxUint16 && frames[i+n] == frames[i] {
+		n++
+	}
+	return n
+}
+
+// replayMasks returns the actions held in frame and those held at less
+// than full strength
+func replayMasks(frame *ReplayFrame) (held, partial uint16) {
+	for action, state := range frame {
+		if state != 0 {
+			held |= 1 << action
+		}
+		if state != 0 && state != 1 {
+			partial |= 1 << action
+		}
+	}
+	return held, partial
+}
+
+// ReplayController drives the player's ship through the user input layer.
+// When recording it stores the actions of every tick; when playing back it
+// sets them from the replay before the player controller reads them.
+type ReplayController struct {
+	Replay   *Replay
+	Playback bool
+
+	tick int
+}
+
+func (c *ReplayController) Input(ship *Ship) ShipInput {
+	if c.Playback {
+		c.Replay.Apply(c.tick)
+	} else {
+		c.Replay.Record()
+	}
+	c.tick++
+
+	return PlayerController{}.Input(ship)
+}
@@ -0,0 +1,144 @@
+package game
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func testReplay() *Replay {
+	rp := &Replay{
+		Seed:      -1234567890123,
+		Circuit:   int(CircuitFirestar),
+		RaceClass: int(RaceClassRapier),
+		RaceType:  int(RaceTypeTimeTrial),
+		Team:      2,
+		Pilot:     5,
+	}
+	for i := 0; i < 600; i++ {
+		var frame ReplayFrame
+		frame[AThrust] = 1
+		if i > 100 && i < 160 {
+			frame[ALeft] = 1
+		}
+		if i > 300 && i < 310 {
+			frame[ARight] = float32(i-300) / 10
+		}
+		rp.Frames = append(rp.Frames, frame)
+	}
+	return rp
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ReplayDirName, ReplayFileName)
+	want := testReplay()
+	if err := want.Write(path); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	got, err := ReplayLoad(path)
+	if err != nil {
+		t.Fatalf("ReplayLoad() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReplayLoad() = %+v; want %+v", got, want)
+	}
+
+	// Held keys take a few bytes per change, analog values a float each
+	data, _ := want.MarshalBinary()
+	if len(data) > 200 {
+		t.Errorf("%d frames take %d bytes", len(want.Frames), len(data))
+	}
+}
+
+func TestReplayCorrupted(t *testing.T) {
+	rp := testReplay()
+	valid, err := rp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), valid...)
+	flipped[30] ^= 0xff
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": valid[:len(valid)-10],
+		"checksum":  flipped,
+	} {
+		got := *rp
+		if err := got.UnmarshalBinary(data); !errors.Is(err, ErrReplayCorrupted) {
+			t.Errorf("%s: UnmarshalBinary() = %v; want ErrReplayCorrupted", name, err)
+		}
+		if !reflect.DeepEqual(&got, rp) {
+			t.Errorf("%s: replay modified by a failed decode", name)
+		}
+	}
+
+	bad := *rp
+	bad.Pilot = int(NumPilots)
+	data, _ := bad.MarshalBinary()
+	if err := new(Replay).UnmarshalBinary(data); !errors.Is(err, ErrReplayCorrupted) {
+		t.Errorf("pilot out of range: %v", err)
+	}
+}
+
+// replayRace runs a race against AI opponents with the player on ctrl
+func replayRace(ctrl *ReplayController, ticks int, input func(tick int)) *Race {
+	r := newTestRace(3)
+	ship := NewShip(3, int(RaceClassVenom), r.Track)
+	r.PlaceOnGrid(ship, 3)
+	r.AddPilot(3, ship, ctrl)
+
+	for !r.Started() {
+		r.Step()
+	}
+	for tick := 0; tick < ticks; tick++ {
+		input(tick)
+		r.Step()
+	}
+	return r
+}
+
+func TestReplayPlayback(t *testing.T) {
+	defer engine.InputClear()
+	const ticks = 900
+
+	// Steer around the ring with some analog input
+	rec := &ReplayController{Replay: &Replay{}}
+	want := replayRace(rec, ticks, func(tick int) {
+		engine.InputSetActionState(byte(AThrust), 1)
+		engine.InputSetActionState(byte(ALeft), float32(tick%40)/80)
+	})
+	if len(rec.Replay.Frames) != ticks {
+		t.Fatalf("%d frames recorded in %d ticks", len(rec.Replay.Frames), ticks)
+	}
+
+	data, err := rec.Replay.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Replay
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// The live input is ignored during playback
+	play := &ReplayController{Replay: &loaded, Playback: true}
+	got := replayRace(play, ticks, func(tick int) {
+		engine.InputSetActionState(byte(ARight), 1)
+	})
+
+	for i := range want.Pilots {
+		w, g := want.Pilots[i], got.Pilots[i]
+		if w.Ship.Position != g.Ship.Position || w.Progress != g.Progress {
+			t.Errorf("pilot %d at %v progress %d, recorded at %v progress %d",
+				i, g.Ship.Position, g.Progress, w.Ship.Position, w.Progress)
+		}
+	}
+	if want.Pilots[3].Progress <= 0 {
+		t.Errorf("player did not move in the recording")
+	}
+}
@@ -1,13 +1,32 @@
 package game
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
 	e "github.com/adsozuan/wipeout-rw-go/engine"
 )
 
 const (
-	SaveDataMagic = 0x64736f77
+	SaveDataMagic   = 0x64736f77
+	SaveDataVersion = 4
+
+	SaveDirName  = "wipeout-rw-go"
+	SaveFileName = "save.dat"
+
+	// Names are stored as three characters plus a terminating zero
+	saveNameLen = 4
+	// Post effect presets are stored by name plus a terminating zero
+	savePostEffectLen = e.PostEffectNameMax + 1
 )
 
+// savePostEffectsV1 are the presets of the post effect indices of version 1
+var savePostEffectsV1 = []string{e.PostEffectNone, e.PostEffectCRT}
+
+var ErrSaveCorrupted = errors.New("save data corrupted")
+
 type Save struct {
 	Magic   uint32
 	IsDirty bool
@@ -18,7 +37,10 @@ type Save struct {
 	ShowFps     bool
 	Fullscreen  bool
 	ScreenRes   int
-	PostEffect  int
+	PostEffect  string
+	PsxMode     int
+	FovMode     int
+	Fov         int
 
 	HasRapierClass   uint32
 	HasBonusCircuits uint32
@@ -39,7 +61,10 @@ func NewSave() Save {
 		ShowFps:     false,
 		Fullscreen:  false,
 		ScreenRes:   0,
-		PostEffect:  0,
+		PostEffect:  e.PostEffectNone,
+		PsxMode:     0,
+		FovMode:     0,
+		Fov:         e.RenderFovDefault,
 
 		HasRapierClass:   0,
 		HasBonusCircuits: 0,
@@ -202,3 +227,228 @@ type HighScoreEntry struct {
 	Name string
 	Time float32
 }
+
+// SavePath returns the location of the save file in the user's config dir
+func SavePath() (string, error) {
+	return configPath(SaveFileName)
+}
+
+// SaveLoad reads the save file at path. A missing file is not an error; a
+// corrupted or unknown file returns the defaults along with the error.
+func SaveLoad(path string) (Save, error) {
+	var s Save
+	err := loadChecked(path, &s)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewSave(), nil
+	}
+	if err != nil {
+		return NewSave(), err
+	}
+
+	return s, nil
+}
+
+// Write stores the save atomically at path and clears the dirty flag once
+// it is written
+func (s *Save) Write(path string) error {
+	if err := writeChecked(path, s); err != nil {
+		return err
+	}
+	s.IsDirty = false
+
+	return nil
+}
+
+// saveDataSize returns the size of a save of version. Version 1 stored the
+// post effect as an index, version 3 added the psx mode and version 4 the
+// field of view.
+func saveDataSize(version uint32) int {
+	entrySize := saveNameLen + 4
+	highscoresSize := (NumHighscores*entrySize + 4) * int(NumRaceClasses) * int(NumCircuits) * int(NumHighscoreTabs)
+	postEffectSize := savePostEffectLen
+	if version == 1 {
+		postEffectSize = 1
+	}
+	psxSize := 1
+	if version < 3 {
+		psxSize = 0
+	}
+	fovSize := 2
+	if version < 4 {
+		fovSize = 0
+	}
+
+	return 4 + 4 + // magic, version
+		4 + 4 + // sfx, music volume
+		4 + // ui scale, show fps, fullscreen, screen res
+		postEffectSize +
+		psxSize +
+		fovSize + // fov mode, fov
+		4 + 4 + // has rapier class, has bonus circuits
+		int(NumGameActions)*2 +
+		saveNameLen +
+		highscoresSize +
+		4 // crc32
+}
+
+// MarshalBinary encodes the save as a checked file
+func (s *Save) MarshalBinary() ([]byte, error) {
+	bytes, p := checkedFileNew(SaveDataMagic, SaveDataVersion, saveDataSize(SaveDataVersion))
+
+	e.PutU32LE(bytes, &p, math.Float32bits(s.SfxVolume))
+	e.PutU32LE(bytes, &p, math.Float32bits(s.MusicVolume))
+	e.PutU8(bytes, &p, s.UiScale)
+	e.PutU8(bytes, &p, boolToByte(s.ShowFps))
+	e.PutU8(bytes, &p, boolToByte(s.Fullscreen))
+	e.PutU8(bytes, &p, byte(s.ScreenRes))
+	putString(bytes, &p, s.PostEffect, savePostEffectLen)
+	e.PutU8(bytes, &p, byte(s.PsxMode))
+	e.PutU8(bytes, &p, byte(s.FovMode))
+	e.PutU8(bytes, &p, byte(s.Fov))
+
+	e.PutU32LE(bytes, &p, s.HasRapierClass)
+	e.PutU32LE(bytes, &p, s.HasBonusCircuits)
+
+	for action := range s.Buttons {
+		for i := range s.Buttons[action] {
+			e.PutU8(bytes, &p, byte(s.Buttons[action][i]))
+		}
+	}
+
+	for i := range s.HighscoresName {
+		e.PutU8(bytes, &p, s.HighscoresName[i])
+	}
+
+	for class := range s.Highscores {
+		for circuit := range s.Highscores[class] {
+			for tab := range s.Highscores[class][circuit] {
+				hs := &s.Highscores[class][circuit][tab]
+				for i := range hs.Entries {
+					putName(bytes, &p, hs.Entries[i].Name)
+					e.PutU32LE(bytes, &p, math.Float32bits(hs.Entries[i].Time))
+				}
+				e.PutU32LE(bytes, &p, math.Float32bits(hs.LapRecord))
+			}
+		}
+	}
+
+	checkedFileSeal(bytes, &p)
+
+	return bytes, nil
+}
+
+// UnmarshalBinary decodes a save written by MarshalBinary, or by one of the
+// versions before it
+func (s *Save) UnmarshalBinary(bytes []byte) error {
+	version, p, err := checkedFileOpen(bytes, SaveDataMagic, 1, SaveDataVersion, ErrSaveCorrupted)
+	if err != nil {
+		return err
+	}
+	if len(bytes) != saveDataSize(version) {
+		return fmt.Errorf("%w: size %d, expected %d", ErrSaveCorrupted, len(bytes), saveDataSize(version))
+	}
+
+	ns := Save{Magic: SaveDataMagic}
+	ns.SfxVolume = math.Float32frombits(e.GetU32LE(bytes, &p))
+	ns.MusicVolume = math.Float32frombits(e.GetU32LE(bytes, &p))
+	ns.UiScale = min(e.GetU8(bytes, &p), byte(len(optionsUiScale)-1))
+	ns.ShowFps = e.GetU8(bytes, &p) != 0
+	ns.Fullscreen = e.GetU8(bytes, &p) != 0
+	ns.ScreenRes = int(e.GetU8(bytes, &p))
+	if ns.ScreenRes >= int(e.NumRenderResolution) {
+		ns.ScreenRes = int(e.RenderResolutionNative)
+	}
+	if version == 1 {
+		ns.PostEffect = e.PostEffectNone
+		if i := int(e.GetU8(bytes, &p)); i < len(savePostEffectsV1) {
+			ns.PostEffect = savePostEffectsV1[i]
+		}
+	} else {
+		ns.PostEffect = getString(bytes, &p, savePostEffectLen)
+	}
+	if version >= 3 {
+		ns.PsxMode = int(e.GetU8(bytes, &p))
+		if ns.PsxMode >= int(e.NumRenderPsx) {
+			ns.PsxMode = int(e.RenderPsxOff)
+		}
+	}
+	ns.Fov = e.RenderFovDefault
+	if version >= 4 {
+		ns.FovMode = int(e.GetU8(bytes, &p))
+		if ns.FovMode >= int(e.NumRenderFov) {
+			ns.FovMode = int(e.RenderFovHorPlus)
+		}
+		ns.Fov = int(e.GetU8(bytes, &p))
+		if ns.Fov < optionsFovMin || ns.Fov > optionToFov(len(optionsFov)-1) {
+			ns.Fov = e.RenderFovDefault
+		}
+	}
+
+	ns.HasRapierClass = e.GetU32LE(bytes, &p)
+	ns.HasBonusCircuits = e.GetU32LE(bytes, &p)
+
+	for action := range ns.Buttons {
+		for i := range ns.Buttons[action] {
+			ns.Buttons[action][i] = e.Button(e.GetU8(bytes, &p))
+		}
+	}
+
+	for i := range ns.HighscoresName {
+		ns.HighscoresName[i] = e.GetU8(bytes, &p)
+	}
+
+	for class := range ns.Highscores {
+		for circuit := range ns.Highscores[class] {
+			for tab := range ns.Highscores[class][circuit] {
+				hs := &ns.Highscores[class][circuit][tab]
+				for i := range hs.Entries {
+					hs.Entries[i].Name = getName(bytes, &p)
+					hs.Entries[i].Time = math.Float32frombits(e.GetU32LE(bytes, &p))
+				}
+				hs.LapRecord = math.Float32frombits(e.GetU32LE(bytes, &p))
+			}
+		}
+	}
+
+	*s = ns
+
+	return nil
+}
+
+func putName(bytes []byte, p *uint32, name string) {
+	putString(bytes, p, name, saveNameLen)
+}
+
+func getName(bytes []byte, p *uint32) string {
+	return getString(bytes, p, saveNameLen)
+}
+
+// putString stores str in n bytes, cut to leave room for a terminating zero
+func putString(bytes []byte, p *uint32, str string, n int) {
+	for i := 0; i < n; i++ {
+		var c byte
+		if i < len(str) && i < n-1 {
+			c = str[i]
+		}
+		e.PutU8(bytes, p, c)
+	}
+}
+
+func getString(bytes []byte, p *uint32, n int) string {
+	str := make([]byte, n)
+	l := 0
+	for i := 0; i < n; i++ {
+		str[i] = e.GetU8(bytes, p)
+		if str[i] != 0 && l == i {
+			l++
+		}
+	}
+	return string(str[:l])
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,232 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func TestSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SaveDirName, SaveFileName)
+
+	want := NewSave()
+	want.SfxVolume = 0.25
+	want.MusicVolume = 0.75
+	want.UiScale = 3
+	want.Fullscreen = true
+	want.ScreenRes = 2
+	want.PostEffect = "fifteen-bytes.."
+	want.PsxMode = int(engine.RenderPsxNearest)
+	want.FovMode = int(engine.RenderFov4by3)
+	want.Fov = 110
+	want.HasRapierClass = 1
+	want.Buttons[AThrust][0] = engine.InputKeySpace
+	want.HighscoresName = [4]byte{'A', 'D', 'S', 0}
+	want.Highscores[RaceClassRapier][CircuitFirestar][HighscoreTabRace].Entries[0] = HighScoreEntry{"XYZ", 123.5}
+	want.Highscores[RaceClassVenom][CircuitAltimaVII][HighscoreTabTimeTrial].LapRecord = 42.25
+
+	if err := want.Write(path); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if want.IsDirty {
+		t.Errorf("Write() left IsDirty set")
+	}
+
+	got, err := SaveLoad(path)
+	if err != nil {
+		t.Fatalf("SaveLoad() = %v", err)
+	}
+	if got != want {
+		t.Errorf("SaveLoad() = %+v; want %+v", got, want)
+	}
+}
+
+func TestSaveWriteFailed(t *testing.T) {
+	// The directory of the save is taken by a file
+	blocked := filepath.Join(t.TempDir(), SaveDirName)
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSave()
+	if err := s.Write(filepath.Join(blocked, SaveFileName)); err == nil {
+		t.Fatalf("Write() into a file succeeded")
+	}
+	if !s.IsDirty {
+		t.Errorf("failed Write() cleared IsDirty")
+	}
+}
+
+func TestGameWriteSaveRetry(t *testing.T) {
+	var logged bytes.Buffer
+	defer func(l *log.Logger) { Logger = l }(Logger)
+	Logger = log.New(&logged, "", 0)
+
+	blocked := filepath.Join(t.TempDir(), SaveDirName)
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := &Game{save: NewSave(), savePath: filepath.Join(blocked, SaveFileName)}
+
+	for now := 0.0; now < saveRetryInterval*2.5; now += 1.0 / 60 {
+		g.writeSave(now)
+	}
+	if n := strings.Count(logged.String(), "save: "); n != 1 {
+		t.Errorf("logged %d failures; want 1", n)
+	}
+	if !g.save.IsDirty {
+		t.Errorf("failed writes cleared IsDirty")
+	}
+
+	// Once the directory can be created, the next retry writes the save
+	if err := os.Remove(blocked); err != nil {
+		t.Fatal(err)
+	}
+	g.writeSave(g.saveRetry - 1)
+	if !g.save.IsDirty {
+		t.Errorf("wrote the save before the retry time")
+	}
+	g.writeSave(g.saveRetry)
+	if g.save.IsDirty {
+		t.Errorf("retry did not write the save")
+	}
+	if _, err := os.Stat(g.savePath); err != nil {
+		t.Errorf("save not written: %v", err)
+	}
+}
+
+func TestSaveLoadMissing(t *testing.T) {
+	got, err := SaveLoad(filepath.Join(t.TempDir(), SaveFileName))
+	if err != nil {
+		t.Fatalf("SaveLoad() = %v; want nil error", err)
+	}
+	if got != NewSave() {
+		t.Errorf("SaveLoad() did not return the defaults")
+	}
+}
+
+func TestSaveOldVersions(t *testing.T) {
+	want := NewSave()
+	want.PostEffect = engine.PostEffectCRT
+	want.HighscoresName = [4]byte{'A', 'D', 'S', 0}
+	want.IsDirty = false
+	data, _ := want.MarshalBinary()
+
+	// Version 1 stored the post effect as a single index byte, version 2 by
+	// name; neither had the psx mode. None before 4 had the field of view.
+	const postEffectPos = 4 + 4 + 4 + 4 + 4
+	rest := data[postEffectPos+savePostEffectLen+1+2 : len(data)-4]
+	settings := map[uint32][]byte{
+		1: {1},
+		2: data[postEffectPos : postEffectPos+savePostEffectLen],
+		3: data[postEffectPos : postEffectPos+savePostEffectLen+1],
+	}
+	for version, setting := range settings {
+		old := append([]byte{}, data[:postEffectPos]...)
+		old = append(old, setting...)
+		old = append(old, rest...)
+		binary.LittleEndian.PutUint32(old[4:], version)
+		old = binary.LittleEndian.AppendUint32(old, crc32.ChecksumIEEE(old))
+
+		var got Save
+		if err := got.UnmarshalBinary(old); err != nil {
+			t.Fatalf("version %d: UnmarshalBinary() = %v", version, err)
+		}
+		if got != want {
+			t.Errorf("version %d save = %+v; want %+v", version, got, want)
+		}
+	}
+}
+
+func TestSaveOutOfRange(t *testing.T) {
+	want := NewSave()
+	want.IsDirty = false
+
+	tests := []struct {
+		name  string
+		apply func(s *Save)
+	}{
+		{"screen res", func(s *Save) { s.ScreenRes = int(engine.NumRenderResolution) }},
+		{"psx mode", func(s *Save) { s.PsxMode = int(engine.NumRenderPsx) }},
+		{"fov mode", func(s *Save) { s.FovMode = int(engine.NumRenderFov) }},
+		{"fov zero", func(s *Save) { s.Fov = 0 }},
+		{"fov wide", func(s *Save) { s.Fov = 170 }},
+	}
+
+	for _, tt := range tests {
+		s := NewSave()
+		tt.apply(&s)
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Save
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: UnmarshalBinary() = %v", tt.name, err)
+		}
+		if got != want {
+			t.Errorf("%s: save = %+v; want the defaults", tt.name, got)
+		}
+	}
+
+	// The largest ui scale is kept rather than reset
+	s := NewSave()
+	s.UiScale = 200
+	data, _ := s.MarshalBinary()
+	var got Save
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("ui scale: UnmarshalBinary() = %v", err)
+	}
+	if want := byte(len(optionsUiScale) - 1); got.UiScale != want {
+		t.Errorf("ui scale = %d; want %d", got.UiScale, want)
+	}
+}
+
+func TestSaveLoadCorrupted(t *testing.T) {
+	s := NewSave()
+	valid, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := append([]byte{}, valid...)
+	badMagic[0] ^= 0xff
+	badVersion := append([]byte{}, valid...)
+	badVersion[4] = SaveDataVersion + 1
+	flipped := append([]byte{}, valid...)
+	flipped[len(flipped)/2] ^= 0x01
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"truncated", valid[:len(valid)-10]},
+		{"magic", badMagic},
+		{"version", badVersion},
+		{"checksum", flipped},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), SaveFileName)
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := SaveLoad(path)
+		if !errors.Is(err, ErrSaveCorrupted) {
+			t.Errorf("%s: SaveLoad() error = %v; want ErrSaveCorrupted", tt.name, err)
+		}
+		if got != NewSave() {
+			t.Errorf("%s: SaveLoad() did not fall back to the defaults", tt.name)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// SfxE names the sounds of the original sound bank, in the order they are
+// stored in it
+type SfxE int
+
+const (
+	SfxCrunch SfxE = iota
+	SfxEBolt
+	SfxEngineIntake
+	SfxEngineRumble
+	SfxEngineThrust
+	SfxEngineRemote
+	SfxExplosion1
+	SfxExplosion2
+	SfxImpact
+	SfxMenuMove
+	SfxMenuSelect
+	SfxMineDrop
+	SfxMissileFire
+	SfxPowerup
+	SfxShield
+	SfxSiren
+	SfxTurbulence
+	SfxVoiceCount0
+	SfxVoiceCount1
+	SfxVoiceCount2
+	SfxVoiceCount3
+	SfxVoiceCountGo
+	SfxVoiceMines
+	SfxVoiceMissile
+	SfxVoiceRockets
+	SfxVoiceRevcon
+	SfxVoiceShockwave
+	SfxVoiceSpecial
+	SfxVoiceShields
+	SfxVoiceTurbo
+	NumSfx
+)
+
+const sfxBankPath = "data/sound/wipeout.vb"
+
+func (s SfxE) String() string {
+	names := [...]string{
+		"SfxCrunch",
+		"SfxEBolt",
+		"SfxEngineIntake",
+		"SfxEngineRumble",
+		"SfxEngineThrust",
+		"SfxEngineRemote",
+		"SfxExplosion1",
+		"SfxExplosion2",
+		"SfxImpact",
+		"SfxMenuMove",
+		"SfxMenuSelect",
+		"SfxMineDrop",
+		"SfxMissileFire",
+		"SfxPowerup",
+		"SfxShield",
+		"SfxSiren",
+		"SfxTurbulence",
+		"SfxVoiceCount0",
+		"SfxVoiceCount1",
+		"SfxVoiceCount2",
+		"SfxVoiceCount3",
+		"SfxVoiceCountGo",
+		"SfxVoiceMines",
+		"SfxVoiceMissile",
+		"SfxVoiceRockets",
+		"SfxVoiceRevcon",
+		"SfxVoiceShockwave",
+		"SfxVoiceSpecial",
+		"SfxVoiceShields",
+		"SfxVoiceTurbo",
+	}
+	if s < 0 || s >= NumSfx {
+		return "Unknown"
+	}
+	return names[s]
+}
+
+// SoundBank holds the decoded sounds by name. Sounds missing from the bank
+// are nil and never play.
+type SoundBank struct {
+	Sounds [NumSfx]*engine.Sound
+}
+
+// NewSoundBank decodes the sounds of a VB bank. A bank with fewer sounds
+// than expected is still used, the error reports how many are missing.
+func NewSoundBank(data []byte) (*SoundBank, error) {
+	sounds, err := engine.VagDecodeBank(data, engine.VagSampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &SoundBank{}
+	copy(b.Sounds[:], sounds)
+	if len(sounds) < int(NumSfx) {
+		return b, fmt.Errorf("sound bank has %d of %d sounds", len(sounds), NumSfx)
+	}
+
+	return b, nil
+}
+
+// Sound returns the sound of sfx or nil
+func (b *SoundBank) Sound(sfx SfxE) *engine.Sound {
+	if b == nil || sfx < 0 || sfx >= NumSfx {
+		return nil
+	}
+	return b.Sounds[sfx]
+}
+
+// loadSfx reads the sound bank, the game runs silent without it
+func (g *Game) loadSfx() {
+	data, err := engine.LoadBinaryFile(sfxBankPath)
+	if err != nil {
+		Logger.Printf("sfx: %s", err)
+		return
+	}
+	g.sfx, err = NewSoundBank(data)
+	if err != nil {
+		Logger.Printf("sfx: %s", err)
+	}
+}
+
+// PlaySfx starts sfx centered at full volume and pitch
+func (g *Game) PlaySfx(sfx SfxE) engine.Voice {
+	return g.PlaySfxAt(sfx, 1, 0, 1, false)
+}
+
+// PlaySfx3d starts sfx at the position of e as heard from the listener
+func (g *Game) PlaySfx3d(sfx SfxE, e engine.Emitter, pitch float32, loop bool) engine.Voice {
+	return g.audio.Play3d(g.sfx.Sound(sfx), e, pitch, loop)
+}
+
+// PlaySfxAt starts sfx with the given volume, pan and pitch
+func (g *Game) PlaySfxAt(sfx SfxE, volume, pan, pitch float32, loop bool) engine.Voice {
+	return g.audio.Play(g.sfx.Sound(sfx), volume, pan, pitch, loop)
+}
@@ -0,0 +1,42 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+// silentBank returns a VB bank of count one block sounds
+func silentBank(count int) []byte {
+	data := make([]byte, count*engine.VagBlockSize)
+	for i := 0; i < count; i++ {
+		data[i*engine.VagBlockSize+1] = engine.VagFlagEnd
+	}
+	return data
+}
+
+func TestSoundBank(t *testing.T) {
+	b, err := NewSoundBank(silentBank(int(NumSfx)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sfx := SfxE(0); sfx < NumSfx; sfx++ {
+		if b.Sound(sfx) == nil {
+			t.Errorf("%s missing", sfx)
+		}
+	}
+
+	// A short bank keeps the sounds it has
+	b, err = NewSoundBank(silentBank(int(SfxMenuSelect) + 1))
+	if err == nil {
+		t.Errorf("short bank without error")
+	}
+	if b.Sound(SfxMenuSelect) == nil || b.Sound(SfxMineDrop) != nil {
+		t.Errorf("short bank sounds %v %v", b.Sound(SfxMenuSelect), b.Sound(SfxMineDrop))
+	}
+
+	var none *SoundBank
+	if none.Sound(SfxCrunch) != nil || b.Sound(NumSfx) != nil {
+		t.Errorf("missing bank or sfx returned a sound")
+	}
+}
@@ -0,0 +1,339 @@
+package game
+
+import (
+	"math"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	// ShipTick is the fixed simulation step in seconds
+	ShipTick = 1.0 / 60.0
+	// ShipMaxSteps bounds the steps run for one frame so a long stall does
+	// not make the simulation spiral
+	ShipMaxSteps = 8
+
+	// Angles in TeamAttributes are in PSX units, 4096 to a full turn
+	shipAngleUnit = gl.Float(2 * math.Pi / 4096)
+
+	ShipThrustRate      = 800
+	ShipThrustFalloff   = 400
+	ShipThrustScale     = 512
+	ShipResistanceScale = 0.5
+
+	ShipTurnScale    = 30
+	ShipTurnMaxScale = 0.5
+	ShipYawDamping   = 3
+	ShipRollFactor   = 0.3
+	ShipRollRate     = 8
+
+	ShipBrakeRate = 4
+	ShipBrakeDrag = 0.6
+	ShipBrakeTurn = 0.6
+
+	ShipGrip = 120
+
+	ShipPitchMax     = 0.35
+	ShipPitchRate    = 6
+	ShipPitchAirRate = 1
+
+	// Height the ship hovers at above the track surface and the height up to
+	// which the track pulls it back
+	ShipTrackFloat   = 256
+	ShipTrackMagnet  = ShipTrackFloat * 4
+	ShipTrackMin     = 64
+	ShipHoverSpring  = 36
+	ShipHoverDamping = 12
+	ShipGravity      = 4000
+
+	// Engine hum volume without thrust and its pitch at rest and at top speed
+	ShipEngineVolumeIdle = 0.4
+	ShipEnginePitchIdle  = 0.6
+	ShipEnginePitchTop   = 1.4
+)
+
+// ShipInput is the control state of a ship for one tick, from the player's
+// bindings or from an AI pilot. All values are in the 0..1 range.
+type ShipInput struct {
+	Up, Down, Left, Right gl.Float
+	BrakeLeft, BrakeRight gl.Float
+	Thrust                gl.Float
+	Fire                  bool
+}
+
+// ShipController produces the input of a ship for every simulation tick
+type ShipController interface {
+	Input(ship *Ship) ShipInput
+}
+
+// PlayerController reads the ship input from the user input layer
+type PlayerController struct{}
+
+func (PlayerController) Input(ship *Ship) ShipInput {
+	return ShipInput{
+		Up:         gl.Float(engine.InputState(byte(AUp))),
+		Down:       gl.Float(engine.InputState(byte(ADown))),
+		Left:       gl.Float(engine.InputState(byte(ALeft))),
+		Right:      gl.Float(engine.InputState(byte(ARight))),
+		BrakeLeft:  gl.Float(engine.InputState(byte(ABrakeLeft))),
+		BrakeRight: gl.Float(engine.InputState(byte(ABrakeRight))),
+		Thrust:     gl.Float(engine.InputState(byte(AThrust))),
+		Fire:       engine.InputState(byte(AFire)) > 0,
+	}
+}
+
+// Ship is the simulated state of one craft. It does not touch the renderer so
+// it can be stepped in tests without a GL context.
+type Ship struct {
+	Pilot      int
+	Team       int
+	Attributes TeamAttributes
+
+	Position        engine.Vec3
+	Velocity        engine.Vec3
+	Angle           engine.Vec3
+	AngularVelocity engine.Vec3
+
+	DirForward engine.Vec3
+	DirRight   engine.Vec3
+	DirUp      engine.Vec3
+
+	ThrustMag  gl.Float
+	BrakeLeft  gl.Float
+	BrakeRight gl.Float
+	Speed      gl.Float
+
+	Track   *track.Track
+	Section *track.Section
+	OnTrack bool
+
+	accumulator float64
+}
+
+func NewShip(pilot int, raceClass int, trk *track.Track) *Ship {
+	team := Def.Pilots[pilot].Team
+	s := &Ship{
+		Pilot:      pilot,
+		Team:       team,
+		Attributes: Def.Teams[team].TeamAttributes[raceClass],
+		Track:      trk,
+	}
+	s.updateDirections()
+
+	return s
+}
+
+// Place puts the ship at rest at pos facing yaw and looks up its section
+func (s *Ship) Place(pos engine.Vec3, yaw gl.Float) {
+	s.Position = pos
+	s.Velocity = engine.Vec3{}
+	s.Angle = engine.NewVec3(0, yaw, 0)
+	s.AngularVelocity = engine.Vec3{}
+	s.ThrustMag = 0
+	s.BrakeLeft = 0
+	s.BrakeRight = 0
+	s.Speed = 0
+	s.accumulator = 0
+	s.Section = nil
+	if s.Track != nil {
+		s.Section, _ = s.Track.NearestSection(pos, nil)
+	}
+	s.updateDirections()
+}
+
+// Update runs as many fixed steps as fit into tickLast, asking ctrl for the
+// input of each one. It returns the number of steps run.
+func (s *Ship) Update(tickLast float64, ctrl ShipController) int {
+	s.accumulator += tickLast
+
+	steps := 0
+	for s.accumulator >= ShipTick {
+		if steps == ShipMaxSteps {
+			s.accumulator = 0
+			break
+		}
+		s.Step(ctrl.Input(s))
+		s.accumulator -= ShipTick
+		steps++
+	}
+
+	return steps
+}
+
+// Step advances the ship by exactly one ShipTick
+func (s *Ship) Step(input ShipInput) {
+	const dt = gl.Float(ShipTick)
+	attr := &s.Attributes
+
+	// Thrust
+	if input.Thrust > 0 {
+		s.ThrustMag += input.Thrust * ShipThrustRate * dt
+	} else {
+		s.ThrustMag -= ShipThrustFalloff * dt
+	}
+	s.ThrustMag = engine.Clamp(s.ThrustMag, 0, gl.Float(attr.ThrustMax))
+
+	// Air brakes
+	s.BrakeLeft = approach(s.BrakeLeft, input.BrakeLeft, ShipBrakeRate*dt)
+	s.BrakeRight = approach(s.BrakeRight, input.BrakeRight, ShipBrakeRate*dt)
+
+	// Yaw; a positive angle turns left
+	turnRate := gl.Float(attr.TurnRate) * shipAngleUnit * ShipTurnScale
+	turnRateMax := gl.Float(attr.TurnRateMax) * shipAngleUnit * ShipTurnMaxScale
+	steer := input.Left - input.Right + (s.BrakeLeft-s.BrakeRight)*ShipBrakeTurn
+	s.AngularVelocity.Y += steer*turnRate*dt - s.AngularVelocity.Y*ShipYawDamping*dt
+	s.AngularVelocity.Y = engine.Clamp(s.AngularVelocity.Y, -turnRateMax, turnRateMax)
+	s.Angle.Y = engine.WrapAngle(s.Angle.Y + s.AngularVelocity.Y*dt)
+
+	// Bank into the turn
+	roll := -s.AngularVelocity.Y * ShipRollFactor
+	s.Angle.Z += (roll - s.Angle.Z) * min(1, ShipRollRate*dt)
+
+	s.updateDirections()
+
+	// Thrust against drag; the brakes add drag of their own
+	mass := gl.Float(attr.Mass)
+	drag := gl.Float(attr.Resistance)/mass*ShipResistanceScale + (s.BrakeLeft+s.BrakeRight)*ShipBrakeDrag
+	acc := engine.Vec3MulF(s.DirForward, s.ThrustMag*ShipThrustScale/mass)
+	acc = engine.Vec3Sub(acc, engine.Vec3MulF(s.Velocity, drag))
+
+	// Skid; the lower the skid the faster sideways motion is lost
+	if attr.Skid > 0 {
+		lateral := engine.Vec3Dot(s.Velocity, s.DirRight)
+		grip := min(1, ShipGrip/gl.Float(attr.Skid)*dt)
+		s.Velocity = engine.Vec3Sub(s.Velocity, engine.Vec3MulF(s.DirRight, lateral*grip))
+	}
+
+	face := s.trackFace()
+	if face != nil {
+		normal := face.Normal
+		height := s.trackHeight(face)
+		s.OnTrack = height < ShipTrackMagnet
+		if s.OnTrack {
+			normalSpeed := engine.Vec3Dot(s.Velocity, normal)
+			hover := (ShipTrackFloat-height)*ShipHoverSpring - normalSpeed*ShipHoverDamping
+			acc = engine.Vec3Add(acc, engine.Vec3MulF(normal, hover))
+		} else {
+			acc = engine.Vec3Sub(acc, engine.Vec3MulF(normal, ShipGravity))
+		}
+	} else {
+		// No track, fall along +y which is down
+		s.OnTrack = false
+		acc.Y += ShipGravity
+	}
+
+	s.Velocity = engine.Vec3Add(s.Velocity, engine.Vec3MulF(acc, dt))
+	s.Position = engine.Vec3Add(s.Position, engine.Vec3MulF(s.Velocity, dt))
+	s.Speed = engine.Vec3Len(s.Velocity)
+
+	if s.Track != nil {
+		s.Section, _ = s.Track.NearestSection(s.Position, s.Section)
+		face = s.trackFace()
+	}
+
+	// Never sink into the track surface
+	if face != nil {
+		height := s.trackHeight(face)
+		if height < ShipTrackMin {
+			s.Position = engine.Vec3Add(s.Position, engine.Vec3MulF(face.Normal, ShipTrackMin-height))
+			normalSpeed := engine.Vec3Dot(s.Velocity, face.Normal)
+			if normalSpeed < 0 {
+				s.Velocity = engine.Vec3Sub(s.Velocity, engine.Vec3MulF(face.Normal, normalSpeed))
+			}
+		}
+	}
+
+	// Pitch follows the track slope with some freedom from up/down, in the
+	// air only the input pitches the ship
+	pitchInput := input.Down - input.Up
+	if face != nil && s.OnTrack {
+		target := trackPitch(s.DirForward, face.Normal) + pitchInput*ShipPitchMax
+		s.Angle.X += (target - s.Angle.X) * min(1, ShipPitchRate*dt)
+	} else {
+		s.Angle.X += pitchInput * ShipPitchAirRate * dt
+	}
+	s.Angle.X = engine.WrapAngle(s.Angle.X)
+
+	s.updateDirections()
+}
+
+// Mat returns the model matrix of the ship
+func (s *Ship) Mat() engine.Mat4 {
+	mat := engine.NewMat4Identity()
+	engine.Mat4SetRollPitchYaw(&mat, s.Angle)
+	engine.Mat4SetTranslation(&mat, s.Position)
+	return mat
+}
+
+// TopSpeed returns the speed at which full thrust and resistance balance
+func (s *Ship) TopSpeed() gl.Float {
+	return gl.Float(s.Attributes.ThrustMax * ShipThrustScale / (s.Attributes.Resistance * ShipResistanceScale))
+}
+
+// EngineSound returns the volume and pitch of the engine hum for the current
+// thrust and speed
+func (s *Ship) EngineSound() (volume, pitch float32) {
+	thrust := engine.Clamp(float32(s.ThrustMag)/s.Attributes.ThrustMax, 0, 1)
+	speed := engine.Clamp(float32(s.Speed/s.TopSpeed()), 0, 1)
+
+	volume = ShipEngineVolumeIdle + (1-ShipEngineVolumeIdle)*thrust
+	pitch = ShipEnginePitchIdle + (ShipEnginePitchTop-ShipEnginePitchIdle)*speed
+	return volume, pitch
+}
+
+// Height returns the height of the ship above the surface of its section,
+// or 0 when it is not over a track.
+func (s *Ship) Height() gl.Float {
+	face := s.trackFace()
+	if face == nil {
+		return 0
+	}
+	return s.trackHeight(face)
+}
+
+func (s *Ship) trackFace() *track.Face {
+	if s.Track == nil || s.Section == nil {
+		return nil
+	}
+	return s.Track.SectionBaseFace(s.Section)
+}
+
+func (s *Ship) trackHeight(face *track.Face) gl.Float {
+	return engine.Vec3DistanceToPlane(s.Position, face.Tris[0].Vertices[0].Pos, face.Normal)
+}
+
+func (s *Ship) updateDirections() {
+	sx, cx := sincos(s.Angle.X)
+	sy, cy := sincos(s.Angle.Y)
+	sz, cz := sincos(s.Angle.Z)
+
+	s.DirForward = engine.NewVec3(-(sy * cx), -sx, cy*cx)
+	s.DirRight = engine.NewVec3(cy*cz+sy*sz*sx, -(sz * cx), sy*cz-cy*sx*sz)
+	s.DirUp = engine.NewVec3(cy*sz-sy*sx*cz, -(cx * cz), sy*sz+cy*sx*cz)
+}
+
+// trackPitch returns the pitch that keeps forward parallel to the plane
+func trackPitch(forward, normal engine.Vec3) gl.Float {
+	along := engine.Vec3Sub(forward, engine.Vec3MulF(normal, engine.Vec3Dot(forward, normal)))
+	if engine.Vec3Len(along) == 0 {
+		return 0
+	}
+	along = engine.Vec3Normalize(along)
+	return gl.Float(math.Asin(float64(engine.Clamp(-along.Y, -1, 1))))
+}
+
+func sincos(a gl.Float) (gl.Float, gl.Float) {
+	s, c := math.Sincos(float64(a))
+	return gl.Float(s), gl.Float(c)
+}
+
+// approach moves v towards target by at most step
+func approach(v, target, step gl.Float) gl.Float {
+	if v < target {
+		return min(v+step, target)
+	}
+	return max(v-step, target)
+}
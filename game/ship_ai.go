@@ -0,0 +1,188 @@
+package game
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	// Sections ahead of the ship the AI aims for
+	AiLookAhead = 3
+	// Sections after which the AI picks a new racing line
+	AiLineSections = 8
+	// Largest offset of the racing line from the section centers
+	AiLineSpread = 400
+
+	AiSteerGain    = 3
+	AiSteerDamping = 0.5
+	// Heading error in radians above which the AI uses the air brake
+	AiBrakeAngle = 0.5
+
+	// ThrustMagnitude giving a fully opened throttle
+	AiThrustMagnitudeFull = 60
+
+	// Seconds the AI races flat out after being passed
+	AiFightBackTime = 3
+)
+
+// AIController pilots a ship along the track sections. It produces the same
+// ShipInput as the player's controller; all randomness comes from its own
+// seeded source so a race can be reproduced.
+type AIController struct {
+	Setting AiSetting
+	// Ships watched for overtakes when FightBack is set
+	Rivals []*Ship
+
+	// Fraction of the team's ThrustMax this pilot races at
+	thrustLimit gl.Float
+
+	rand        *rand.Rand
+	lineOffset  gl.Float
+	lineSection *track.Section
+	lineCount   int
+
+	rivalAhead []bool
+	fightTimer gl.Float
+}
+
+// NewAIController returns a controller for the AI opponent setting of
+// raceClass. Thrust limits are relative to the strongest opponent of the
+// class, which races at the full thrust of its team.
+func NewAIController(raceClass int, opponent int, seed int64) *AIController {
+	settings := &Def.AiSettings[raceClass]
+	var strongest float32
+	for i := range settings {
+		strongest = max(strongest, settings[i].ThrustMax)
+	}
+
+	setting := settings[opponent]
+	return &AIController{
+		Setting:     setting,
+		thrustLimit: gl.Float(setting.ThrustMax / strongest),
+		rand:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+// FightingBack reports whether the AI is reacting to being overtaken
+func (ai *AIController) FightingBack() bool {
+	return ai.fightTimer > 0
+}
+
+// ThrustLimit returns the fraction of the team thrust the AI is using
+func (ai *AIController) ThrustLimit() gl.Float {
+	if ai.FightingBack() {
+		return 1
+	}
+	return ai.thrustLimit
+}
+
+func (ai *AIController) Input(ship *Ship) ShipInput {
+	var input ShipInput
+	if ship.Track == nil || ship.Section == nil {
+		return input
+	}
+
+	ai.updateFightBack(ship)
+	ai.updateLine(ship)
+
+	// Throttle, kept under the limit of this pilot
+	if ship.ThrustMag < gl.Float(ship.Attributes.ThrustMax)*ai.ThrustLimit() {
+		input.Thrust = engine.Clamp(gl.Float(ai.Setting.ThrustMagnitude)/AiThrustMagnitudeFull, 0, 1)
+	}
+
+	// Steer towards a point on the racing line a few sections ahead
+	target := ship.Section
+	for i := 0; i < AiLookAhead; i++ {
+		target = target.Next
+	}
+	next := target.Next
+	along := engine.Vec3Normalize(engine.Vec3Sub(next.Center, target.Center))
+	normal := ship.Track.SectionBaseFace(target).Normal
+	across := engine.Vec3Cross(along, normal)
+	aim := engine.Vec3Add(target.Center, engine.Vec3MulF(across, ai.lineOffset))
+
+	toAim := engine.Vec3Sub(aim, ship.Position)
+	heading := gl.Float(math.Atan2(
+		float64(engine.Vec3Dot(toAim, ship.DirRight)),
+		float64(engine.Vec3Dot(toAim, ship.DirForward)),
+	))
+
+	// Positive steers right, the yaw rate (positive turning left) damps it
+	steer := heading*AiSteerGain + ship.AngularVelocity.Y*AiSteerDamping
+	if steer > 0 {
+		input.Right = min(steer, 1)
+	} else {
+		input.Left = min(-steer, 1)
+	}
+
+	if heading > AiBrakeAngle {
+		input.BrakeRight = 1
+	} else if heading < -AiBrakeAngle {
+		input.BrakeLeft = 1
+	}
+
+	return input
+}
+
+// updateLine picks a new offset from the center line every few sections
+func (ai *AIController) updateLine(ship *Ship) {
+	if ship.Section == ai.lineSection {
+		return
+	}
+	ai.lineSection = ship.Section
+	if ai.lineCount > 0 {
+		ai.lineCount--
+		return
+	}
+	ai.lineCount = AiLineSections
+	ai.lineOffset = gl.Float(ai.rand.Float32()*2-1) * AiLineSpread
+}
+
+// updateFightBack starts racing flat out when a rival that was behind
+// moves ahead
+func (ai *AIController) updateFightBack(ship *Ship) {
+	ai.fightTimer = max(0, ai.fightTimer-ShipTick)
+	if !ai.Setting.FightBack {
+		return
+	}
+
+	if len(ai.rivalAhead) != len(ai.Rivals) {
+		ai.rivalAhead = make([]bool, len(ai.Rivals))
+		for i, rival := range ai.Rivals {
+			ai.rivalAhead[i] = sectionAhead(ship.Track, rival.Section, ship.Section)
+		}
+		return
+	}
+
+	for i, rival := range ai.Rivals {
+		ahead := sectionAhead(ship.Track, rival.Section, ship.Section)
+		if ahead && !ai.rivalAhead[i] {
+			ai.fightTimer = AiFightBackTime
+			ai.lineOffset = ai.lateralOffset(ship, rival)
+		}
+		ai.rivalAhead[i] = ahead
+	}
+}
+
+// lateralOffset returns how far rival is to the right of ship's section
+// center, the AI takes that line to block it
+func (ai *AIController) lateralOffset(ship, rival *Ship) gl.Float {
+	offset := engine.Vec3Dot(engine.Vec3Sub(rival.Position, ship.Section.Center), ship.DirRight)
+	return engine.Clamp(offset, -AiLineSpread, AiLineSpread)
+}
+
+// sectionAhead reports whether a is ahead of b on the track, less than half
+// a lap away
+func sectionAhead(t *track.Track, a, b *track.Section) bool {
+	if a == nil || b == nil || len(t.Sections) == 0 {
+		return false
+	}
+	count := len(t.Sections)
+	diff := ((a.Num-b.Num)%count + count) % count
+	return diff > 0 && diff < count/2
+}
@@ -0,0 +1,213 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	testRingRadius = 20000
+	testRingWidth  = 3000
+)
+
+// ringTrack builds a flat circular track around the origin, driven with
+// increasing angle from (radius, 0, 0)
+func ringTrack(count int, radius, width gl.Float) *track.Track {
+	t := &track.Track{
+		Faces:    make([]track.Face, count),
+		Sections: make([]track.Section, count),
+	}
+
+	point := func(i int, r gl.Float) engine.Vec3 {
+		s, c := math.Sincos(2 * math.Pi * float64(i) / float64(count))
+		return engine.NewVec3(r*gl.Float(c), 0, r*gl.Float(s))
+	}
+
+	for i := 0; i < count; i++ {
+		v := [4]engine.Vec3{
+			point(i, radius+width/2),
+			point(i, radius-width/2),
+			point(i+1, radius-width/2),
+			point(i+1, radius+width/2),
+		}
+		t.Vertices = append(t.Vertices, v[:]...)
+		t.Faces[i] = track.Face{
+			Tris: [2]engine.Tris{
+				{Vertices: [3]engine.Vertex{{Pos: v[0]}, {Pos: v[1]}, {Pos: v[2]}}},
+				{Vertices: [3]engine.Vertex{{Pos: v[3]}, {Pos: v[0]}, {Pos: v[2]}}},
+			},
+			Normal: engine.NewVec3(0, -1, 0),
+			Flags:  track.FaceTrackBase,
+		}
+		t.Sections[i] = track.Section{
+			Center:    point(i, radius),
+			FaceStart: i,
+			FaceCount: 1,
+			Num:       i,
+		}
+	}
+	for i := range t.Sections {
+		t.Sections[i].Prev = &t.Sections[(i+count-1)%count]
+		t.Sections[i].Next = &t.Sections[(i+1)%count]
+	}
+
+	return t
+}
+
+// raceAI runs all AI opponents of a class for the given time and returns
+// their ships
+func raceAI(class RaceClassE, seed int64, seconds float64) []*Ship {
+	trk := ringTrack(64, testRingRadius, testRingWidth)
+	ships := make([]*Ship, NumAIOpponents)
+	ais := make([]*AIController, NumAIOpponents)
+	for i := range ships {
+		ships[i] = NewShip(i, int(class), trk)
+		angle := -0.02 * float64(i)
+		s, c := math.Sincos(angle)
+		ships[i].Place(engine.NewVec3(testRingRadius*gl.Float(c), -ShipTrackFloat, testRingRadius*gl.Float(s)), gl.Float(angle))
+		ais[i] = NewAIController(int(class), i, seed+int64(i))
+	}
+	for i := range ais {
+		for j := range ships {
+			if i != j {
+				ais[i].Rivals = append(ais[i].Rivals, ships[j])
+			}
+		}
+	}
+
+	steps := int(seconds / ShipTick)
+	for n := 0; n < steps; n++ {
+		for i := range ships {
+			ships[i].Step(ais[i].Input(ships[i]))
+		}
+	}
+
+	return ships
+}
+
+func TestAIFollowsTrack(t *testing.T) {
+	for class := RaceClassE(0); class < NumRaceClasses; class++ {
+		t.Run(Def.RaceClasses[class].Name, func(t *testing.T) {
+			trk := ringTrack(64, testRingRadius, testRingWidth)
+			ship := NewShip(int(PilotJohnDekka), int(class), trk)
+			ship.Place(engine.NewVec3(testRingRadius, -ShipTrackFloat, 0), 0)
+			ai := NewAIController(int(class), NumAIOpponents-1, 1)
+
+			start := ship.Section
+			laps := 0
+			for n := 0; n < int(60/ShipTick); n++ {
+				prev := ship.Section
+				ship.Step(ai.Input(ship))
+				if ship.Section == start && prev != start {
+					laps++
+				}
+
+				r := math.Hypot(float64(ship.Position.X), float64(ship.Position.Z))
+				if math.Abs(r-testRingRadius) > testRingWidth/2 {
+					t.Fatalf("step %d: ship left the track at radius %.0f", n, r)
+				}
+			}
+			if laps < 1 {
+				t.Errorf("completed %d laps, want at least one", laps)
+			}
+		})
+	}
+}
+
+func TestAIThrustLimit(t *testing.T) {
+	for class := RaceClassE(0); class < NumRaceClasses; class++ {
+		t.Run(Def.RaceClasses[class].Name, func(t *testing.T) {
+			trk := ringTrack(64, testRingRadius, testRingWidth)
+			ship := NewShip(int(PilotKelSolaar), int(class), trk)
+			ship.Place(engine.NewVec3(testRingRadius, -ShipTrackFloat, 0), 0)
+			ai := NewAIController(int(class), 0, 1)
+
+			setting := Def.AiSettings[class][0]
+			strongest := Def.AiSettings[class][NumAIOpponents-1]
+			limit := gl.Float(ship.Attributes.ThrustMax * setting.ThrustMax / strongest.ThrustMax)
+			if ai.ThrustLimit() >= 1 {
+				t.Fatalf("weakest opponent thrust limit %.3f, want below 1", ai.ThrustLimit())
+			}
+
+			for n := 0; n < int(10/ShipTick); n++ {
+				ship.Step(ai.Input(ship))
+				if ship.ThrustMag > limit+ShipThrustRate*ShipTick {
+					t.Fatalf("step %d: thrust %.1f above limit %.1f", n, ship.ThrustMag, limit)
+				}
+			}
+			if ship.ThrustMag < limit*0.95 {
+				t.Errorf("thrust %.1f never reached the limit %.1f", ship.ThrustMag, limit)
+			}
+		})
+	}
+}
+
+func TestAIFightBack(t *testing.T) {
+	tests := []struct {
+		name      string
+		fightBack bool
+		want      bool
+	}{
+		{"fight back", true, true},
+		{"no fight back", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trk := ringTrack(64, testRingRadius, testRingWidth)
+			ship := NewShip(0, int(RaceClassVenom), trk)
+			ship.Section = &trk.Sections[10]
+			rival := NewShip(1, int(RaceClassVenom), trk)
+			rival.Section = &trk.Sections[8]
+
+			ai := NewAIController(int(RaceClassVenom), 0, 1)
+			ai.Setting.FightBack = tt.fightBack
+			ai.Rivals = []*Ship{rival}
+
+			ai.Input(ship)
+			if ai.FightingBack() {
+				t.Fatalf("fighting back before being passed")
+			}
+
+			rival.Section = &trk.Sections[11]
+			ai.Input(ship)
+			if got := ai.FightingBack(); got != tt.want {
+				t.Errorf("FightingBack() = %v, want %v", got, tt.want)
+			}
+			if tt.want && ai.ThrustLimit() != 1 {
+				t.Errorf("thrust limit %.3f while fighting back, want 1", ai.ThrustLimit())
+			}
+
+			for n := 0; n < int(AiFightBackTime/ShipTick)+1; n++ {
+				ai.Input(ship)
+			}
+			if ai.FightingBack() {
+				t.Errorf("still fighting back after %d seconds", AiFightBackTime)
+			}
+		})
+	}
+}
+
+func TestAIDeterministic(t *testing.T) {
+	a := raceAI(RaceClassVenom, 42, 20)
+	b := raceAI(RaceClassVenom, 42, 20)
+	c := raceAI(RaceClassVenom, 7, 20)
+
+	same := true
+	for i := range a {
+		if a[i].Position != b[i].Position || a[i].Velocity != b[i].Velocity {
+			t.Errorf("ship %d diverged with the same seed: %v != %v", i, a[i].Position, b[i].Position)
+		}
+		if a[i].Position != c[i].Position {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("different seeds produced the same race")
+	}
+}
@@ -0,0 +1,242 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/track"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+type constInput ShipInput
+
+func (c constInput) Input(ship *Ship) ShipInput {
+	return ShipInput(c)
+}
+
+// straightTrack builds a flat ring of sections laid out along +z, the
+// surface is at y = 0 with the normal pointing up (-y)
+func straightTrack(count int, length gl.Float) *track.Track {
+	t := &track.Track{
+		Faces:    make([]track.Face, count),
+		Sections: make([]track.Section, count),
+	}
+
+	for i := 0; i < count; i++ {
+		z0, z1 := gl.Float(i)*length, gl.Float(i+1)*length
+		v := [4]engine.Vec3{
+			engine.NewVec3(2000, 0, z0),
+			engine.NewVec3(-2000, 0, z0),
+			engine.NewVec3(-2000, 0, z1),
+			engine.NewVec3(2000, 0, z1),
+		}
+		t.Vertices = append(t.Vertices, v[:]...)
+		t.Faces[i] = track.Face{
+			Tris: [2]engine.Tris{
+				{Vertices: [3]engine.Vertex{{Pos: v[0]}, {Pos: v[1]}, {Pos: v[2]}}},
+				{Vertices: [3]engine.Vertex{{Pos: v[3]}, {Pos: v[0]}, {Pos: v[2]}}},
+			},
+			Normal: engine.NewVec3(0, -1, 0),
+			Flags:  track.FaceTrackBase,
+		}
+		t.Sections[i] = track.Section{
+			Center:    engine.NewVec3(0, 0, (z0+z1)/2),
+			FaceStart: i,
+			FaceCount: 1,
+			Num:       i,
+		}
+	}
+	for i := range t.Sections {
+		t.Sections[i].Prev = &t.Sections[(i+count-1)%count]
+		t.Sections[i].Next = &t.Sections[(i+1)%count]
+	}
+
+	return t
+}
+
+func stepFor(s *Ship, seconds float64, input ShipInput) {
+	steps := int(seconds / ShipTick)
+	for i := 0; i < steps; i++ {
+		s.Step(input)
+	}
+}
+
+func newTestShip(team TeamE, class RaceClassE) *Ship {
+	pilot := Def.Teams[team].Pilots[0]
+	for i := range Def.Pilots {
+		if Def.Pilots[i].Name == pilot.Name {
+			s := NewShip(i, int(class), straightTrack(160, 2000))
+			s.Place(engine.NewVec3(0, -ShipTrackFloat, 1000), 0)
+			return s
+		}
+	}
+	return nil
+}
+
+func TestShipTopSpeed(t *testing.T) {
+	for team := TeamE(0); team < NumTeams; team++ {
+		for class := RaceClassE(0); class < NumRaceClasses; class++ {
+			t.Run(Def.Teams[team].Name+" "+Def.RaceClasses[class].Name, func(t *testing.T) {
+				s := newTestShip(team, class)
+				attr := s.Attributes
+				want := gl.Float(attr.ThrustMax * ShipThrustScale / (attr.Resistance * ShipResistanceScale))
+
+				stepFor(s, 20, ShipInput{Thrust: 1})
+
+				if s.Speed < want*0.98 || s.Speed > want*1.02 {
+					t.Errorf("speed = %.0f, want about %.0f", s.Speed, want)
+				}
+				if s.Position.Z <= 1000 {
+					t.Errorf("ship did not move forward, z = %.0f", s.Position.Z)
+				}
+				if h := s.Height(); h < ShipTrackFloat*0.9 || h > ShipTrackFloat*1.1 {
+					t.Errorf("height = %.1f, want about %d", h, ShipTrackFloat)
+				}
+			})
+		}
+	}
+}
+
+func TestShipTurning(t *testing.T) {
+	for team := TeamE(0); team < NumTeams; team++ {
+		t.Run(Def.Teams[team].Name, func(t *testing.T) {
+			left := newTestShip(team, RaceClassVenom)
+			right := newTestShip(team, RaceClassVenom)
+			maxRate := gl.Float(left.Attributes.TurnRateMax) * shipAngleUnit * ShipTurnMaxScale
+
+			for i := 0; i < 60; i++ {
+				left.Step(ShipInput{Thrust: 1, Left: 1})
+				right.Step(ShipInput{Thrust: 1, Right: 1})
+				if left.AngularVelocity.Y > maxRate {
+					t.Fatalf("yaw rate %.3f above max %.3f", left.AngularVelocity.Y, maxRate)
+				}
+			}
+
+			if left.Angle.Y <= 0 {
+				t.Errorf("left yaw = %.3f, want > 0", left.Angle.Y)
+			}
+			if right.Angle.Y != -left.Angle.Y {
+				t.Errorf("right yaw = %.3f, want %.3f", right.Angle.Y, -left.Angle.Y)
+			}
+			if left.Angle.Z >= 0 {
+				t.Errorf("roll = %.3f, want banking into the turn", left.Angle.Z)
+			}
+
+			stepFor(left, 1, ShipInput{Thrust: 1})
+			if left.AngularVelocity.Y > maxRate*0.1 {
+				t.Errorf("yaw rate %.3f did not settle after releasing", left.AngularVelocity.Y)
+			}
+		})
+	}
+}
+
+func TestShipAirBrakes(t *testing.T) {
+	for team := TeamE(0); team < NumTeams; team++ {
+		t.Run(Def.Teams[team].Name, func(t *testing.T) {
+			coast := newTestShip(team, RaceClassVenom)
+			brake := newTestShip(team, RaceClassVenom)
+			stepFor(coast, 5, ShipInput{Thrust: 1})
+			stepFor(brake, 5, ShipInput{Thrust: 1})
+
+			stepFor(coast, 1, ShipInput{Thrust: 1})
+			stepFor(brake, 1, ShipInput{Thrust: 1, BrakeLeft: 1, BrakeRight: 1})
+			if brake.Speed >= coast.Speed*0.9 {
+				t.Errorf("braking speed %.0f, want well below %.0f", brake.Speed, coast.Speed)
+			}
+			if brake.Angle.Y != 0 {
+				t.Errorf("both brakes turned the ship, yaw = %.3f", brake.Angle.Y)
+			}
+
+			stepFor(brake, 1, ShipInput{Thrust: 1, BrakeLeft: 1})
+			if brake.Angle.Y <= 0 {
+				t.Errorf("left brake yaw = %.3f, want > 0", brake.Angle.Y)
+			}
+		})
+	}
+}
+
+func TestShipSkid(t *testing.T) {
+	lateral := func(team TeamE) gl.Float {
+		s := newTestShip(team, RaceClassVenom)
+		s.Velocity = engine.Vec3MulF(s.DirRight, 1000)
+		s.Step(ShipInput{})
+		return engine.Vec3Dot(s.Velocity, s.DirRight)
+	}
+
+	// Qirex skids more than AG Systems in venom class
+	ag, qirex := lateral(TeamAGSystems), lateral(TeamQirex)
+	if qirex <= ag {
+		t.Errorf("lateral speed qirex %.1f, ag %.1f, want qirex to keep more", qirex, ag)
+	}
+	if ag >= 1000 {
+		t.Errorf("lateral speed %.1f was not reduced", ag)
+	}
+}
+
+func TestShipHover(t *testing.T) {
+	s := newTestShip(TeamFeisar, RaceClassVenom)
+	s.Place(engine.NewVec3(0, -800, 1000), 0)
+
+	for i := 0; i < 300; i++ {
+		s.Step(ShipInput{})
+		if h := s.Height(); h < ShipTrackMin-0.01 {
+			t.Fatalf("step %d: height %.1f below the minimum", i, h)
+		}
+	}
+	if h := s.Height(); h < ShipTrackFloat-5 || h > ShipTrackFloat+5 {
+		t.Errorf("height = %.1f, want %d", h, ShipTrackFloat)
+	}
+	if !s.OnTrack {
+		t.Errorf("ship not on track")
+	}
+
+	// Without a track the ship falls
+	free := NewShip(0, int(RaceClassVenom), nil)
+	free.Place(engine.Vec3{}, 0)
+	free.Step(ShipInput{})
+	if free.Velocity.Y <= 0 || free.OnTrack {
+		t.Errorf("ship without track did not fall, velocity %v", free.Velocity)
+	}
+}
+
+func TestShipUpdateFixedStep(t *testing.T) {
+	input := ShipInput{Thrust: 1, Left: 0.5}
+	a := newTestShip(TeamAuricom, RaceClassRapier)
+	b := newTestShip(TeamAuricom, RaceClassRapier)
+
+	if steps := a.Update(0.06, constInput(input)); steps != 3 {
+		t.Errorf("steps = %d, want 3", steps)
+	}
+	if steps := a.Update(0.01, constInput(input)); steps != 1 {
+		t.Errorf("steps = %d, want 1", steps)
+	}
+	for i := 0; i < 4; i++ {
+		b.Step(input)
+	}
+	if a.Position != b.Position || a.Angle != b.Angle || a.Velocity != b.Velocity {
+		t.Errorf("frame stepping diverged: %v != %v", a.Position, b.Position)
+	}
+
+	if steps := a.Update(1, constInput(input)); steps != ShipMaxSteps {
+		t.Errorf("steps = %d, want %d", steps, ShipMaxSteps)
+	}
+	if steps := a.Update(0, constInput(input)); steps != 0 {
+		t.Errorf("steps after stall = %d, want 0", steps)
+	}
+}
+
+func TestShipEngineSound(t *testing.T) {
+	s := newTestShip(TeamFeisar, RaceClassVenom)
+
+	volume, pitch := s.EngineSound()
+	if volume != ShipEngineVolumeIdle || pitch != ShipEnginePitchIdle {
+		t.Errorf("at rest volume %.2f pitch %.2f", volume, pitch)
+	}
+
+	stepFor(s, 20, ShipInput{Thrust: 1})
+	volume, pitch = s.EngineSound()
+	if volume < 0.99 || pitch < ShipEnginePitchTop*0.98 || pitch > ShipEnginePitchTop {
+		t.Errorf("at top speed volume %.2f pitch %.2f", volume, pitch)
+	}
+}
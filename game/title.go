@@ -6,34 +6,46 @@ type TitleScene struct {
 	titleImage      uint16
 	startTime       float64
 	hasShownAttract bool
-	render          *engine.Render
+	g               *Game
+	render          engine.RenderBackend
 	ui              *UI
 }
 
-func NewTitleScene(startTime float64, render *engine.Render) *TitleScene {
+func NewTitleScene(startTime float64, g *Game) *TitleScene {
 
 	return &TitleScene{
 		startTime:       startTime,
-		render:          render,
+		g:               g,
+		render:          g.render,
 		hasShownAttract: false,
-		ui:              NewUI(render),
+		ui:              g.ui,
 	}
 }
 
 func (t *TitleScene) Init() error {
-	texture := ImageGetTexture("data/textures/wiptitle.tim")
+	texture := ImageGetTexture("data/textures/wiptitle.tim", t.render)
 	t.titleImage = texture
 
 	return nil
 }
 
+func (t *TitleScene) Cleanup() {
+	if err := t.render.TextureRelease(int(t.titleImage)); err != nil {
+		Logger.Printf("title: %s", err)
+	}
+}
+
 func (t *TitleScene) Update() error {
 	t.render.SetView2d()
 	err := t.render.Push2d(engine.NewVec2i(0, 0), t.render.Size(), engine.NewRGBA(128, 128, 128, 255), int(t.titleImage))
 	if err != nil {
 		return err
 	}
-	t.ui.DrawText("PRESS ENTER", t.ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -40)), UITextSize16, UIColorDefault)
+	if engine.InputPressed(byte(AMenuSelect)) || engine.InputPressed(byte(AMenuStart)) {
+		t.g.SetScene(GameSceneMainMenu)
+	}
+
+	t.ui.DrawTextCentered("PRESS ENTER", t.ui.ScaledPos(UIPosBottom|UIPosCenter, engine.NewVec2i(0, -40)), UITextSize16, UIColorDefault)
 
 	return nil
 }
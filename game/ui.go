@@ -62,10 +62,10 @@ type UI struct {
 	charSet      [UITextSizeMax]CharSet
 	scale        int
 	iconTextures [UIIconMax]uint16
-	render       *engine.Render
+	render       engine.RenderBackend
 }
 
-func NewUI(render *engine.Render) *UI {
+func NewUI(render engine.RenderBackend) *UI {
 	return &UI{
 		charSet: charSet,
 		scale:   2,
@@ -113,57 +113,61 @@ func (ui *UI) ScaledScreen() engine.Vec2i {
 	return engine.Vec2iMulF(ui.render.Size(), gl.Float(ui.scale))
 }
 
+// ScaledPos returns the screen position of offset from anchor. The anchors
+// are the edges of the render's safe area, not of the whole screen.
 func (ui *UI) ScaledPos(anchor UIPos, offset engine.Vec2i) engine.Vec2i {
-	var pos engine.Vec2i
-	screenSize := ui.render.Size()
+	pos, screenSize := ui.render.SafeArea()
 
 	if anchor&UIPosLeft != 0 {
-		pos.X = offset.X * int32(ui.scale)
+		pos.X += offset.X * int32(ui.scale)
 	} else if anchor&UIPosCenter != 0 {
-		pos.X = (screenSize.X >> 1) + offset.X*int32(ui.scale)
+		pos.X += (screenSize.X >> 1) + offset.X*int32(ui.scale)
 	} else if anchor&UIPosRight != 0 {
-		pos.X = screenSize.X + offset.X*int32(ui.scale)
+		pos.X += screenSize.X + offset.X*int32(ui.scale)
 	}
 
 	if anchor&UIPosTop != 0 {
-		pos.Y = offset.Y * int32(ui.scale)
+		pos.Y += offset.Y * int32(ui.scale)
 	} else if anchor&UIPosMiddle != 0 {
-		pos.Y = (screenSize.Y >> 1) + offset.Y*int32(ui.scale)
+		pos.Y += (screenSize.Y >> 1) + offset.Y*int32(ui.scale)
 	} else if anchor&UIPosBottom != 0 {
-		pos.Y = screenSize.Y + offset.Y*int32(ui.scale)
+		pos.Y += screenSize.Y + offset.Y*int32(ui.scale)
 	}
 
 	return pos
 }
 
+// charToGlyphIndex returns the glyph for c, or -1 for characters the font
+// does not have; those are drawn as a space.
 func charToGlyphIndex(c rune) int {
-	if c >= '0' && c <= '9' {
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= '0' && c <= '9':
 		return int(c - '0' + 26)
+	case c == ':':
+		return 36
+	case c == '.':
+		return 37
 	}
-	return int(c - 'A')
+	return -1
 }
 
 func charWidth(c rune, size UITextSize) int {
-	if c == ' ' {
+	index := charToGlyphIndex(c)
+	if index < 0 {
 		return 8
 	}
-	return int(charSet[size].Glyphs[charToGlyphIndex(c)].Width)
+	return int(charSet[size].Glyphs[index].Width)
 }
 
 func textWidth(text string, size UITextSize) int {
-	var width uint16 = 0
-	cs := &charSet[size]
-
+	width := 0
 	for _, ch := range text {
-		if ch != ' ' {
-			width += cs.Glyphs[charToGlyphIndex(ch)].Width
-		} else {
-			width += 8
-		}
-
+		width += charWidth(ch, size)
 	}
 
-	return int(width)
+	return width
 }
 
 func numberWidth(num int, size UITextSize) int {
@@ -198,8 +202,8 @@ func (ui *UI) DrawText(text string, pos engine.Vec2i, size UITextSize, color eng
 	cs := &charSet[size]
 
 	for _, char := range text {
-		if char != ' ' {
-			glyph := &cs.Glyphs[ui.charToGlyphIndex(char)]
+		if index := ui.charToGlyphIndex(char); index >= 0 {
+			glyph := &cs.Glyphs[index]
 			glyphOffset := engine.Vec2i{X: int32(glyph.Offset.X), Y: int32(glyph.Offset.Y)}
 			glyphSize := engine.Vec2i{X: int32(glyph.Width), Y: int32(cs.Height)}
 			ui.render.Push2dTile(pos, glyphOffset, glyphSize, ui.Scaled(glyphSize), color, int(cs.Texture))
@@ -238,10 +242,7 @@ func (ui *UI) DrawIcon(icon UIIconType, pos engine.Vec2i, color engine.RGBA) err
 
 // charToGlyphIndex converts a character to a glyph index.
 func (ui *UI) charToGlyphIndex(char rune) int {
-	if char >= '0' && char <= '9' {
-		return int(char-'0') + 26
-	}
-	return int(char-'A') - 1
+	return charToGlyphIndex(char)
 }
 
 var charSet [UITextSizeMax]CharSet = [UITextSizeMax]CharSet{
@@ -0,0 +1,34 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+func TestUIScaledPosSafeArea(t *testing.T) {
+	render := engine.NewRenderHeadless()
+	render.Init(engine.NewVec2i(2560, 1080))
+	ui := NewUI(render)
+
+	// The anchors of an ultrawide screen are those of 16:9 in its middle
+	offset := engine.NewVec2i(-10, -10)
+	for _, c := range []struct {
+		anchor UIPos
+		want   engine.Vec2i
+	}{
+		{UIPosLeft | UIPosTop, engine.NewVec2i(300, -20)},
+		{UIPosCenter | UIPosMiddle, engine.NewVec2i(1260, 520)},
+		{UIPosRight | UIPosBottom, engine.NewVec2i(2220, 1060)},
+	} {
+		if got := ui.ScaledPos(c.anchor, offset); got != c.want {
+			t.Errorf("anchor %d: ScaledPos() = %v; want %v", c.anchor, got, c.want)
+		}
+	}
+
+	// In 4:3 the whole area drawn to is safe
+	render.SetFov(engine.RenderFov4by3, engine.RenderFovDefault)
+	if got := ui.ScaledPos(UIPosRight|UIPosBottom, offset); got != engine.NewVec2i(1420, 1060) {
+		t.Errorf("4:3 bottom right = %v", got)
+	}
+}
@@ -0,0 +1,82 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/game"
+)
+
+// RecordFps is the frame rate of recordings started with the record action
+const RecordFps = 60
+
+// StartRecording writes every following frame to w. The game advances by
+// 1/fps seconds of simulated time per frame, however long rendering and
+// writing take.
+func (s *System) StartRecording(w engine.FrameWriter, fps int) error {
+	if s.recorder != nil {
+		return errors.New("already recording")
+	}
+	if fps <= 0 {
+		return fmt.Errorf("invalid recording rate %d", fps)
+	}
+	s.recorder = w
+	s.recordStep = 1 / float64(fps)
+
+	return nil
+}
+
+// StopRecording closes the recording and returns to real time
+func (s *System) StopRecording() error {
+	if s.recorder == nil {
+		return nil
+	}
+	err := s.recorder.Close()
+	s.recorder = nil
+
+	return err
+}
+
+func (s *System) Recording() bool {
+	return s.recorder != nil
+}
+
+// updateRecording toggles recording with the record action and captures the
+// finished frame while recording
+func (s *System) updateRecording() {
+	if engine.InputPressed(byte(game.ARecord)) {
+		if s.recorder != nil {
+			err := s.StopRecording()
+			if err != nil {
+				Logger.Printf("record: %s", err)
+			}
+			return
+		}
+
+		dir := filepath.Join(s.ScreenshotDir, "wipeout-"+time.Now().Format("20060102-150405"))
+		w, err := engine.NewPngSequenceWriter(dir)
+		if err == nil {
+			err = s.StartRecording(w, RecordFps)
+		}
+		if err != nil {
+			Logger.Printf("record: %s", err)
+			return
+		}
+		Logger.Printf("record: %s", dir)
+	}
+
+	if s.recorder == nil {
+		return
+	}
+	img, err := s.Render.Capture(engine.RenderCaptureScreen)
+	if err == nil {
+		err = s.recorder.WriteFrame(img)
+	}
+	if err != nil {
+		Logger.Printf("record: %s, recording stopped", err)
+		s.StopRecording()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"time"
 
 	"github.com/adsozuan/wipeout-rw-go/engine"
 	"github.com/adsozuan/wipeout-rw-go/game"
@@ -24,22 +25,36 @@ type System struct {
 	timeScale  float64
 	tickLast   float64
 	cycleTime  float64
-	platform   *engine.PlatformSdl
-	Render     *engine.Render
+	platform   engine.Platform
+	Render     engine.RenderBackend
+	Mixer      *engine.Mixer
 	Game       *game.Game
+
+	// ScreenshotDir is where the screenshot actions write to
+	ScreenshotDir string
+
+	recorder   engine.FrameWriter
+	recordStep float64
 }
 
-func New(platform *engine.PlatformSdl) (*System, error) {
+// New creates the system and the game running on platform and drawing with
+// r
+func New(platform engine.Platform, r engine.RenderBackend) (*System, error) {
 
 	Logger = log.New(os.Stderr, "system |", log.Ldate|log.Ltime)
 	Logger.Printf("Init")
 
 	engine.InputInit()
 
-	r := engine.NewRender()
-	r.Init(platform.GetScreenSize())
+	r.Init(platform.ScreenSize())
+
+	m := engine.NewMixer()
+	err := platform.AudioInit(m.Mix)
+	if err != nil {
+		Logger.Printf("audio: %s, sound is disabled", err)
+	}
 
-	g, err := game.NewGame(r, platform)
+	g, err := game.NewGame(r, m, platform)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +67,10 @@ func New(platform *engine.PlatformSdl) (*System, error) {
 		cycleTime:  0.0,
 		platform:   platform,
 		Render:     r,
+		Mixer:      m,
 		Game: g,
+
+		ScreenshotDir: engine.ScreenshotDir,
 	}
 
 	g.Init(s.Time())
@@ -62,6 +80,7 @@ func New(platform *engine.PlatformSdl) (*System, error) {
 
 func (s *System) Cleanup() {
 	s.Render.Cleanup()
+	s.platform.AudioCleanup()
 	engine.InputCleanUp()
 }
 
@@ -69,11 +88,35 @@ func (s *System) Exit() {
 	s.platform.Exit()
 }
 
+// Frame runs one iteration of the main loop: input, update, audio and
+// presentation
+func (s *System) Frame() error {
+	err := s.platform.PumpEvents()
+	if err != nil {
+		return err
+	}
+	err = s.platform.PrepareFrame()
+	if err != nil {
+		return err
+	}
+	s.Update()
+	err = s.platform.AudioUpdate()
+	if err != nil {
+		return err
+	}
+
+	return s.platform.EndFrame()
+}
+
 func (s *System) Update() {
 	timeRealNow := s.platform.Now()
 	realDelta := timeRealNow - s.timeReal
 	s.timeReal = timeRealNow
-	s.tickLast = math.Min(realDelta, 0.1) * s.timeScale
+	if s.recorder != nil {
+		s.tickLast = s.recordStep * s.timeScale
+	} else {
+		s.tickLast = math.Min(realDelta, 0.1) * s.timeScale
+	}
 	s.timeScaled += s.tickLast
 
 	// FIXME: This is a hack to prevent the cycleTime from growing too large, must be a better way
@@ -83,15 +126,42 @@ func (s *System) Update() {
 	}
 	s.Render.FramePrepare()
 
-	resetCycleTime := s.Game.Update()
+	resetCycleTime := s.Game.Update(s.tickLast)
 	if resetCycleTime {
 		s.ResetCycleTime()
 	}
 
 	s.Render.FrameEnd(s.cycleTime)
+	s.updateScreenshot()
+	s.updateRecording()
 	engine.InputClear()
 }
 
+// updateScreenshot captures the finished frame when one of the screenshot
+// actions was pressed
+func (s *System) updateScreenshot() {
+	var source engine.RenderCapture
+	if engine.InputPressed(byte(game.AScreenshot)) {
+		source = engine.RenderCaptureScreen
+	} else if engine.InputPressed(byte(game.AScreenshotBackBuffer)) {
+		source = engine.RenderCaptureBackBuffer
+	} else {
+		return
+	}
+
+	img, err := s.Render.Capture(source)
+	if err != nil {
+		Logger.Printf("screenshot: %s", err)
+		return
+	}
+	path, err := engine.ScreenshotWrite(s.ScreenshotDir, img, time.Now())
+	if err != nil {
+		Logger.Printf("screenshot: %s", err)
+		return
+	}
+	Logger.Printf("screenshot: %s", path)
+}
+
 func (s *System) ResetCycleTime() {
 	s.cycleTime = 0.0
 }
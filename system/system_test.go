@@ -0,0 +1,180 @@
+package system
+
+import (
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+	"github.com/adsozuan/wipeout-rw-go/game"
+)
+
+// newHeadless creates a system without a window, the save goes to a
+// temporary directory
+func newHeadless(t *testing.T) (*System, *engine.PlatformHeadless, *engine.RenderHeadless) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	p := engine.NewPlatformHeadless(engine.NewVec2i(WindowWidth, WindowHeight), 1.0/60)
+	r := engine.NewRenderHeadless()
+	s, err := New(p, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Cleanup)
+
+	return s, p, r
+}
+
+// runUntil runs frames until frame is reached
+func runUntil(t *testing.T, s *System, p *engine.PlatformHeadless, frame int) {
+	for p.Frame() < frame {
+		if err := s.Frame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSceneTransitions(t *testing.T) {
+	s, p, r := newHeadless(t)
+
+	// Title, main menu, best times of the first class and back
+	p.Press(1, engine.InputKeyReturn)
+	p.Press(3, engine.InputKeyDown)
+	p.Press(5, engine.InputKeyReturn)
+	p.Press(7, engine.InputKeyReturn)
+	p.Press(9, engine.InputKeyBackspace)
+
+	want := []struct {
+		frame int
+		scene game.GameSceneE
+	}{
+		{1, game.GameSceneTitle},
+		{3, game.GameSceneMainMenu},
+		{8, game.GameSceneMainMenu},
+		{9, game.GameSceneHighscores},
+		{11, game.GameSceneMainMenu},
+	}
+	for _, w := range want {
+		runUntil(t, s, p, w.frame)
+		if s.Game.CurrentScene != w.scene {
+			t.Errorf("frame %d: scene %s, want %s", w.frame, s.Game.CurrentScene, w.scene)
+		}
+	}
+
+	if r.Frames != p.Frame() || r.Tris == 0 {
+		t.Errorf("%d frames rendered of %d, %d tris in the last", r.Frames, p.Frame(), r.Tris)
+	}
+	if math.Abs(s.Time()-float64(p.Frame()-1)/60) > 1e-9 {
+		t.Errorf("time %.4f after %d frames", s.Time(), p.Frame())
+	}
+}
+
+func TestQuitFromMainMenu(t *testing.T) {
+	s, p, _ := newHeadless(t)
+
+	p.Press(1, engine.InputKeyReturn)
+	for frame := 3; frame < 9; frame += 2 {
+		p.Press(frame, engine.InputKeyDown)
+	}
+	p.Press(9, engine.InputKeyReturn)
+	p.Press(11, engine.InputKeyRight)
+	p.Press(13, engine.InputKeyReturn)
+
+	runUntil(t, s, p, 13)
+	if p.ExitWanted() {
+		t.Fatalf("exit before confirming")
+	}
+	runUntil(t, s, p, 14)
+	if !p.ExitWanted() {
+		t.Errorf("no exit after confirming quit")
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	s, p, _ := newHeadless(t)
+	s.ScreenshotDir = filepath.Join(t.TempDir(), "shots")
+
+	p.Press(0, engine.InputKeyF12)
+	p.Press(2, engine.InputKeyF10)
+	runUntil(t, s, p, 4)
+
+	files, err := filepath.Glob(filepath.Join(s.ScreenshotDir, "*.png"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("screenshots %v, %v", files, err)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != WindowWidth || img.Bounds().Dy() != WindowHeight {
+		t.Errorf("screenshot size %v", img.Bounds())
+	}
+}
+
+// frameCounter counts the recorded frames
+type frameCounter struct {
+	frames int
+	closed bool
+}
+
+func (w *frameCounter) WriteFrame(img *image.RGBA) error {
+	w.frames++
+	return nil
+}
+
+func (w *frameCounter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestRecording(t *testing.T) {
+	s, p, _ := newHeadless(t)
+	runUntil(t, s, p, 2)
+
+	// The platform runs at 60 fps, the recording advances at its own rate
+	w := &frameCounter{}
+	if err := s.StartRecording(w, 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartRecording(w, 25); err == nil {
+		t.Errorf("second recording started")
+	}
+	start := s.Time()
+	runUntil(t, s, p, 12)
+	if err := s.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.frames != 10 || !w.closed || s.Recording() {
+		t.Errorf("%d frames recorded, closed %v, recording %v", w.frames, w.closed, s.Recording())
+	}
+	if math.Abs(s.Time()-start-10.0/25) > 1e-9 {
+		t.Errorf("time advanced %.4f over 10 frames at 25 fps", s.Time()-start)
+	}
+}
+
+func TestRecordAction(t *testing.T) {
+	s, p, _ := newHeadless(t)
+	s.ScreenshotDir = filepath.Join(t.TempDir(), "shots")
+
+	p.Press(0, engine.InputKeyF9)
+	p.Press(4, engine.InputKeyF9)
+	runUntil(t, s, p, 6)
+
+	files, err := filepath.Glob(filepath.Join(s.ScreenshotDir, "*", "frame-*.png"))
+	if err != nil || len(files) != 4 {
+		t.Errorf("recorded frames %v, %v", files, err)
+	}
+	if s.Recording() {
+		t.Errorf("still recording")
+	}
+}
@@ -0,0 +1,362 @@
+package track
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"path/filepath"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+const (
+	Version = 8
+
+	VertexDataSize  = 16
+	FaceDataSize    = 20
+	SectionDataSize = 156
+
+	// Window of sections around a reference section searched by NearestSection
+	SearchLookBack  = 3
+	SearchLookAhead = 6
+)
+
+type FaceFlags byte
+
+const (
+	FaceTrackBase FaceFlags = 1 << iota
+	FacePickupLeft
+	FaceFlipTexture
+	FacePickupRight
+	FaceStartGrid
+	FaceBoost
+	FacePickupCollected
+	FacePickupActive
+)
+
+type SectionFlags int16
+
+const (
+	SectionJump          SectionFlags = 1
+	SectionJunctionEnd   SectionFlags = 8
+	SectionJunctionStart SectionFlags = 16
+	SectionJunction      SectionFlags = 32
+)
+
+// Face is a quad of the track surface, split into two triangles. The UVs are
+// in the 0..1 range and must be scaled to the texture size when drawn.
+type Face struct {
+	Tris    [2]engine.Tris
+	Normal  engine.Vec3
+	Flags   FaceFlags
+	Texture byte
+}
+
+type Section struct {
+	Junction  *Section
+	Prev      *Section
+	Next      *Section
+	Center    engine.Vec3
+	FaceStart int
+	FaceCount int
+	Flags     SectionFlags
+	Num       int
+}
+
+type Track struct {
+	Vertices []engine.Vec3
+	Faces    []Face
+	Sections []Section
+}
+
+// Load reads track.trv, track.trf and track.trs from the circuit's base path
+func Load(basePath string) (*Track, error) {
+	trv, err := engine.LoadBinaryFile(filepath.Join(basePath, "track.trv"))
+	if err != nil {
+		return nil, err
+	}
+	trf, err := engine.LoadBinaryFile(filepath.Join(basePath, "track.trf"))
+	if err != nil {
+		return nil, err
+	}
+	trs, err := engine.LoadBinaryFile(filepath.Join(basePath, "track.trs"))
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadFromBytes(trv, trf, trs)
+}
+
+func LoadFromBytes(trv, trf, trs []byte) (*Track, error) {
+	vertices, err := LoadVertices(trv)
+	if err != nil {
+		return nil, err
+	}
+	faces, err := LoadFaces(trf, vertices)
+	if err != nil {
+		return nil, err
+	}
+	sections, err := LoadSections(trs, len(faces))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Track{
+		Vertices: vertices,
+		Faces:    faces,
+		Sections: sections,
+	}, nil
+}
+
+func LoadVertices(bytes []byte) ([]engine.Vec3, error) {
+	if len(bytes)%VertexDataSize != 0 {
+		return nil, fmt.Errorf("track vertices: size %d is not a multiple of %d", len(bytes), VertexDataSize)
+	}
+
+	vertices := make([]engine.Vec3, len(bytes)/VertexDataSize)
+	var p uint32
+	for i := range vertices {
+		vertices[i].X = gl.Float(engine.GetI32(bytes, &p))
+		vertices[i].Y = gl.Float(engine.GetI32(bytes, &p))
+		vertices[i].Z = gl.Float(engine.GetI32(bytes, &p))
+		p += 4 // padding
+	}
+
+	return vertices, nil
+}
+
+func LoadFaces(bytes []byte, vertices []engine.Vec3) ([]Face, error) {
+	if len(bytes)%FaceDataSize != 0 {
+		return nil, fmt.Errorf("track faces: size %d is not a multiple of %d", len(bytes), FaceDataSize)
+	}
+
+	faces := make([]Face, len(bytes)/FaceDataSize)
+	var p uint32
+	for i := range faces {
+		var v [4]engine.Vec3
+		for j := range v {
+			index := int(engine.GetI16(bytes, &p))
+			if index < 0 || index >= len(vertices) {
+				return nil, fmt.Errorf("track face %d: invalid vertex index %d", i, index)
+			}
+			v[j] = vertices[index]
+		}
+
+		f := &faces[i]
+		f.Normal.X = gl.Float(engine.GetI16(bytes, &p)) / 4096.0
+		f.Normal.Y = gl.Float(engine.GetI16(bytes, &p)) / 4096.0
+		f.Normal.Z = gl.Float(engine.GetI16(bytes, &p)) / 4096.0
+		f.Texture = engine.GetU8(bytes, &p)
+		f.Flags = FaceFlags(engine.GetU8(bytes, &p))
+
+		color := engine.RGBA{
+			R: engine.GetU8(bytes, &p),
+			G: engine.GetU8(bytes, &p),
+			B: engine.GetU8(bytes, &p),
+			A: 255,
+		}
+		p++ // unused
+
+		if f.Flags&FaceBoost != 0 {
+			// Render boost pads with a blue hue
+			color = engine.RGBA{R: 60, G: 60, B: 255, A: 255}
+		}
+
+		uv := [4]engine.Vec2{engine.NewVec2(1, 0), engine.NewVec2(0, 0), engine.NewVec2(0, 1), engine.NewVec2(1, 1)}
+		if f.Flags&FaceFlipTexture != 0 {
+			uv = [4]engine.Vec2{engine.NewVec2(0, 0), engine.NewVec2(1, 0), engine.NewVec2(1, 1), engine.NewVec2(0, 1)}
+		}
+
+		f.Tris[0] = engine.Tris{
+			Vertices: [3]engine.Vertex{
+				{Pos: v[0], UV: uv[0], Color: color},
+				{Pos: v[1], UV: uv[1], Color: color},
+				{Pos: v[2], UV: uv[2], Color: color},
+			},
+		}
+		f.Tris[1] = engine.Tris{
+			Vertices: [3]engine.Vertex{
+				{Pos: v[3], UV: uv[3], Color: color},
+				{Pos: v[0], UV: uv[0], Color: color},
+				{Pos: v[2], UV: uv[2], Color: color},
+			},
+		}
+	}
+
+	return faces, nil
+}
+
+func LoadSections(bytes []byte, faceCount int) ([]Section, error) {
+	if len(bytes)%SectionDataSize != 0 {
+		return nil, fmt.Errorf("track sections: size %d is not a multiple of %d", len(bytes), SectionDataSize)
+	}
+
+	sections := make([]Section, len(bytes)/SectionDataSize)
+	sectionAt := func(i int, index int32) (*Section, error) {
+		if index < 0 || int(index) >= len(sections) {
+			return nil, fmt.Errorf("track section %d: invalid section link %d", i, index)
+		}
+		return &sections[index], nil
+	}
+
+	var p uint32
+	var err error
+	for i := range sections {
+		s := &sections[i]
+
+		junctionIndex := engine.GetI32(bytes, &p)
+		if junctionIndex != -1 {
+			if s.Junction, err = sectionAt(i, junctionIndex); err != nil {
+				return nil, err
+			}
+		}
+		if s.Prev, err = sectionAt(i, engine.GetI32(bytes, &p)); err != nil {
+			return nil, err
+		}
+		if s.Next, err = sectionAt(i, engine.GetI32(bytes, &p)); err != nil {
+			return nil, err
+		}
+
+		s.Center.X = gl.Float(engine.GetI32(bytes, &p))
+		s.Center.Y = gl.Float(engine.GetI32(bytes, &p))
+		s.Center.Z = gl.Float(engine.GetI32(bytes, &p))
+
+		version := engine.GetI16(bytes, &p)
+		if version != Version {
+			return nil, fmt.Errorf("track section %d: version %d, expected %d", i, version, Version)
+		}
+		p += 2         // padding
+		p += 4 + 4     // objects pointer, object count
+		p += 5 * 3 * 4 // view section pointers
+		p += 5 * 3 * 2 // view section counts
+		p += 4 * 2     // high list
+		p += 4 * 2     // med list
+
+		s.FaceStart = int(engine.GetI16(bytes, &p))
+		s.FaceCount = int(engine.GetI16(bytes, &p))
+		if s.FaceStart < 0 || s.FaceCount < 0 || s.FaceStart+s.FaceCount > faceCount {
+			return nil, fmt.Errorf("track section %d: faces %d+%d out of range", i, s.FaceStart, s.FaceCount)
+		}
+
+		p += 2 * 2 // global/local radius
+		s.Flags = SectionFlags(engine.GetI16(bytes, &p))
+		s.Num = int(engine.GetI16(bytes, &p))
+		p += 2 // padding
+	}
+
+	return sections, nil
+}
+
+// SectionFaces returns the faces belonging to a section
+func (t *Track) SectionFaces(s *Section) []Face {
+	return t.Faces[s.FaceStart : s.FaceStart+s.FaceCount]
+}
+
+// SectionBaseFace returns the first face of a section flagged as track base;
+// this is the face ships hover on
+func (t *Track) SectionBaseFace(s *Section) *Face {
+	faces := t.SectionFaces(s)
+	for i := range faces {
+		if faces[i].Flags&FaceTrackBase != 0 {
+			return &faces[i]
+		}
+	}
+	if len(faces) > 0 {
+		return &faces[0]
+	}
+	return nil
+}
+
+// SectionIndex returns the index of a section in t.Sections
+func (t *Track) SectionIndex(s *Section) int {
+	for i := range t.Sections {
+		if &t.Sections[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Checksum identifies the geometry of the track: a crc32 of its vertices and
+// the centers and links of its sections. Data recorded on one track can be
+// checked against it before use on another.
+func (t *Track) Checksum() uint32 {
+	bytes := make([]byte, 0, len(t.Vertices)*12+len(t.Sections)*16)
+	put := func(v uint32) {
+		bytes = append(bytes, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+	putVec3 := func(v engine.Vec3) {
+		put(math.Float32bits(float32(v.X)))
+		put(math.Float32bits(float32(v.Y)))
+		put(math.Float32bits(float32(v.Z)))
+	}
+
+	for _, v := range t.Vertices {
+		putVec3(v)
+	}
+	for i := range t.Sections {
+		s := &t.Sections[i]
+		putVec3(s.Center)
+		put(uint32(t.SectionIndex(s.Next)))
+	}
+
+	return crc32.ChecksumIEEE(bytes)
+}
+
+// NearestSection returns the section whose center is closest to pos and the
+// distance to it. With a reference section only the sections around it (and
+// along a junction branch met on the way) are searched, otherwise the whole
+// track is.
+func (t *Track) NearestSection(pos engine.Vec3, ref *Section) (*Section, gl.Float) {
+	if len(t.Sections) == 0 {
+		return nil, 0
+	}
+
+	var shortestDistance gl.Float = math.MaxFloat32
+	var nearest *Section
+
+	check := func(s *Section) {
+		d := engine.Vec3Len(engine.Vec3Sub(pos, s.Center))
+		if d < shortestDistance {
+			shortestDistance = d
+			nearest = s
+		}
+	}
+
+	if ref == nil {
+		for i := range t.Sections {
+			check(&t.Sections[i])
+		}
+		return nearest, shortestDistance
+	}
+
+	section := ref
+	for i := 0; i < SearchLookBack; i++ {
+		section = section.Prev
+	}
+
+	var junction *Section
+	for i := 0; i < SearchLookAhead; i++ {
+		if section.Junction != nil {
+			junction = section.Junction
+		}
+		check(section)
+		section = section.Next
+	}
+
+	if junction != nil {
+		section = junction
+		for i := 0; i < SearchLookAhead; i++ {
+			check(section)
+			if junction.Flags&SectionJunctionStart != 0 {
+				section = section.Next
+			} else {
+				section = section.Prev
+			}
+		}
+	}
+
+	return nearest, shortestDistance
+}
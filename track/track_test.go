@@ -0,0 +1,175 @@
+package track
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/adsozuan/wipeout-rw-go/engine"
+)
+
+const testSectionCount = 8
+
+// testTrack builds a closed loop of sections along the x axis with one base
+// face each
+func testTrack() (trv, trf, trs []byte) {
+	be := binary.BigEndian
+
+	for i := 0; i <= testSectionCount; i++ {
+		for _, z := range []int32{-500, 500} {
+			v := make([]byte, VertexDataSize)
+			be.PutUint32(v[0:], uint32(int32(i*1000)))
+			be.PutUint32(v[4:], uint32(int32(0)))
+			be.PutUint32(v[8:], uint32(z))
+			trv = append(trv, v...)
+		}
+	}
+
+	for i := 0; i < testSectionCount; i++ {
+		f := make([]byte, FaceDataSize)
+		be.PutUint16(f[0:], uint16(i*2))
+		be.PutUint16(f[2:], uint16(i*2+1))
+		be.PutUint16(f[4:], uint16(i*2+3))
+		be.PutUint16(f[6:], uint16(i*2+2))
+		be.PutUint16(f[8:], 0)
+		be.PutUint16(f[10:], uint16(0xf000)) // -4096
+		be.PutUint16(f[12:], 0)
+		f[14] = byte(i)
+		f[15] = byte(FaceTrackBase)
+		f[16], f[17], f[18] = 10, 20, 30
+		trf = append(trf, f...)
+	}
+
+	for i := 0; i < testSectionCount; i++ {
+		s := make([]byte, SectionDataSize)
+		be.PutUint32(s[0:], uint32(0xffffffff))
+		be.PutUint32(s[4:], uint32((i+testSectionCount-1)%testSectionCount))
+		be.PutUint32(s[8:], uint32((i+1)%testSectionCount))
+		be.PutUint32(s[12:], uint32(int32(i*1000+500)))
+		be.PutUint32(s[16:], 0)
+		be.PutUint32(s[20:], 0)
+		be.PutUint16(s[24:], Version)
+		be.PutUint16(s[142:], uint16(i))
+		be.PutUint16(s[144:], 1)
+		be.PutUint16(s[150:], 0)
+		be.PutUint16(s[152:], uint16(i))
+		trs = append(trs, s...)
+	}
+
+	return trv, trf, trs
+}
+
+func TestLoadFromBytes(t *testing.T) {
+	trk, err := LoadFromBytes(testTrack())
+	if err != nil {
+		t.Fatalf("LoadFromBytes() = %v", err)
+	}
+
+	if len(trk.Vertices) != (testSectionCount+1)*2 || len(trk.Faces) != testSectionCount || len(trk.Sections) != testSectionCount {
+		t.Fatalf("got %d vertices, %d faces, %d sections", len(trk.Vertices), len(trk.Faces), len(trk.Sections))
+	}
+
+	for i := range trk.Sections {
+		s := &trk.Sections[i]
+		if s.Next != &trk.Sections[(i+1)%testSectionCount] || s.Prev != &trk.Sections[(i+testSectionCount-1)%testSectionCount] {
+			t.Errorf("section %d: wrong next/prev links", i)
+		}
+		if s.Junction != nil {
+			t.Errorf("section %d: unexpected junction", i)
+		}
+		if s.Num != i || trk.SectionIndex(s) != i {
+			t.Errorf("section %d: num %d, index %d", i, s.Num, trk.SectionIndex(s))
+		}
+		if f := trk.SectionBaseFace(s); f != &trk.Faces[i] {
+			t.Errorf("section %d: wrong base face", i)
+		}
+	}
+
+	f := trk.Faces[3]
+	if f.Normal != engine.NewVec3(0, -1, 0) {
+		t.Errorf("face normal = %v; want {0 -1 0}", f.Normal)
+	}
+	if f.Texture != 3 || f.Flags != FaceTrackBase {
+		t.Errorf("face texture %d, flags %d", f.Texture, f.Flags)
+	}
+	if f.Tris[0].Vertices[0].Pos != trk.Vertices[6] || f.Tris[1].Vertices[0].Pos != trk.Vertices[8] {
+		t.Errorf("face vertices do not match the vertex list")
+	}
+	if f.Tris[0].Vertices[0].Color != engine.NewRGBA(10, 20, 30, 255) {
+		t.Errorf("face color = %v", f.Tris[0].Vertices[0].Color)
+	}
+}
+
+func TestNearestSection(t *testing.T) {
+	trk, err := LoadFromBytes(testTrack())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pos  engine.Vec3
+		ref  int
+		want int
+	}{
+		{engine.NewVec3(600, 0, 0), -1, 0},
+		{engine.NewVec3(3400, -50, 10), -1, 3},
+		{engine.NewVec3(3400, -50, 10), 2, 3},
+		// Outside the search window of the reference section
+		{engine.NewVec3(7400, 0, 0), 4, 6},
+		{engine.NewVec3(7400, 0, 0), 6, 7},
+	}
+
+	for _, tt := range tests {
+		var ref *Section
+		if tt.ref >= 0 {
+			ref = &trk.Sections[tt.ref]
+		}
+		got, _ := trk.NearestSection(tt.pos, ref)
+		if got != &trk.Sections[tt.want] {
+			t.Errorf("NearestSection(%v, %d) = %d; want %d", tt.pos, tt.ref, trk.SectionIndex(got), tt.want)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	a, err := LoadFromBytes(testTrack())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := LoadFromBytes(testTrack())
+	if a.Checksum() != b.Checksum() {
+		t.Errorf("checksum differs for the same track")
+	}
+
+	b.Sections[3].Center.Y += 1
+	if a.Checksum() == b.Checksum() {
+		t.Errorf("checksum unchanged after moving a section")
+	}
+}
+
+func TestLoadFromBytesInvalid(t *testing.T) {
+	trv, trf, trs := testTrack()
+
+	badVertex := append([]byte{}, trf...)
+	binary.BigEndian.PutUint16(badVertex[0:], 999)
+	badVersion := append([]byte{}, trs...)
+	binary.BigEndian.PutUint16(badVersion[24:], Version+1)
+	badLink := append([]byte{}, trs...)
+	binary.BigEndian.PutUint32(badLink[8:], testSectionCount)
+
+	tests := []struct {
+		name          string
+		trv, trf, trs []byte
+	}{
+		{"vertex size", trv[:len(trv)-1], trf, trs},
+		{"vertex index", trv, badVertex, trs},
+		{"section version", trv, trf, badVersion},
+		{"section link", trv, trf, badLink},
+		{"face range", trv, trf[:FaceDataSize], trs},
+	}
+
+	for _, tt := range tests {
+		if _, err := LoadFromBytes(tt.trv, tt.trf, tt.trs); err == nil {
+			t.Errorf("%s: LoadFromBytes() = nil error", tt.name)
+		}
+	}
+}